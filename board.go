@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+// longest board title in runes
+const maxTitleLength = 256
+
+const (
+	freeEmoji   = "🟢"
+	busyEmoji   = "🏗️"
+	notifyEmoji = "⚡"
+)
+
+// Board is a set of resources posted as one message with inline buttons
+type Board struct {
+	ID        string      `json:"id"`
+	ChatID    int64       `json:"chat_id"`
+	ChatTitle string      `json:"chat_title,omitempty"`
+	MessageID int         `json:"message_id"`
+	Title     string      `json:"title,omitempty"`
+	Layout    Layout      `json:"layout,omitzero"`
+	States    []State     `json:"states,omitempty"` // none for free and busy
+	Resources []*Resource `json:"resources"`
+	Notify    []int64     `json:"notify,omitempty"`
+	LastID    int         `json:"last_id"`
+	CreatedBy int64       `json:"created_by,omitempty"`
+	Version   int64       `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Resource is a single button on the board
+type Resource struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Row    int     `json:"row,omitempty"` // explicit keyboard row
+	Holder *Holder `json:"holder,omitempty"`
+	// Capacity is how many users may hold the resource at once, shared
+	// resources of several slots keep their holders in Holders
+	Capacity int       `json:"capacity,omitempty"`
+	Holders  []*Holder `json:"holders,omitempty"`
+	// Queue is who lines up for the resource while it is busy
+	Queue []*Waiter `json:"queue,omitempty"`
+	// Bookings reserve the resource ahead of time, sorted by start
+	Bookings []*Booking `json:"bookings,omitempty"`
+}
+
+// Holder is the user who marked a resource as busy
+type Holder struct {
+	ID    int64     `json:"id,omitempty"`
+	Name  string    `json:"name,omitempty"`
+	Note  string    `json:"note,omitempty"`
+	Since time.Time `json:"since"`
+	// Until is when the hold is released by itself, zero is no limit
+	Until time.Time `json:"until,omitzero"`
+	// Warned is set once the holder was told the hold is about to end
+	Warned bool `json:"warned,omitempty"`
+	// State is the index of a held state of the board, 0 is busy as well
+	State int `json:"state,omitempty"`
+}
+
+func newBoard(chatID int64, names []string) *Board {
+	now := time.Now()
+
+	board := &Board{
+		ChatID:    chatID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	for _, name := range names {
+		board.addResource(name)
+	}
+
+	return board
+}
+
+// addResource appends a resource to the last row of the board, a name
+// like "licenses*5" makes a shared resource of 5 slots
+func (board *Board) addResource(name string) *Resource {
+	board.LastID++
+
+	resource := &Resource{
+		ID: board.LastID,
+	}
+
+	if resource.Name, resource.Capacity = splitCapacity(name); resource.Capacity == 1 {
+		resource.Capacity = 0
+	}
+
+	if len(board.Resources) > 0 {
+		resource.Row = board.Resources[len(board.Resources)-1].Row
+	}
+
+	board.Resources = append(board.Resources, resource)
+
+	return resource
+}
+
+// addRow appends resources as a new explicit row of the board
+func (board *Board) addRow(names []string) {
+	row := 0
+	if len(board.Resources) > 0 {
+		row = board.Resources[len(board.Resources)-1].Row + 1
+	}
+
+	for _, name := range names {
+		board.addResource(name).Row = row
+	}
+}
+
+func (board *Board) resource(id int) *Resource {
+	for _, resource := range board.Resources {
+		if resource.ID == id {
+			return resource
+		}
+	}
+
+	return nil
+}
+
+// resourceByName finds a resource by its name ignoring case
+func (board *Board) resourceByName(name string) *Resource {
+	for _, resource := range board.Resources {
+		if strings.EqualFold(resource.Name, name) {
+			return resource
+		}
+	}
+
+	return nil
+}
+
+// removeResource drops the resource from the board, returns false if there is none
+func (board *Board) removeResource(id int) bool {
+	for i, resource := range board.Resources {
+		if resource.ID == id {
+			board.Resources = slices.Delete(board.Resources, i, i+1)
+			board.UpdatedAt = time.Now()
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// renameResource gives the resource a new name, returns false if the name
+// belongs to another resource of the board
+func (board *Board) renameResource(resource *Resource, name string) bool {
+	if other := board.resourceByName(name); other != nil && other.ID != resource.ID {
+		return false
+	}
+
+	resource.Name = name
+	board.UpdatedAt = time.Now()
+
+	return true
+}
+
+// setTitle changes the heading line of the board, an empty title removes it
+func (board *Board) setTitle(title string) {
+	board.Title = strings.Join(strings.Fields(title), " ")
+	board.UpdatedAt = time.Now()
+}
+
+// take marks resource as busy by user, returns false if it is busy already
+func (board *Board) take(resource *Resource, user models.User) bool {
+	if resource.Holder != nil {
+		return false
+	}
+
+	now := time.Now()
+
+	// the first in line has the resource kept for them for a while
+	if waiter := resource.offeredTo(); waiter != nil && waiter.ID != user.ID {
+		return false
+	}
+
+	if booking := resource.activeBooking(now); booking != nil && booking.UserID != user.ID {
+		return false
+	}
+
+	resource.leaveQueue(user.ID)
+
+	resource.Holder = &Holder{
+		ID:    user.ID,
+		Name:  fullName(user),
+		Since: now,
+	}
+	board.UpdatedAt = now
+
+	return true
+}
+
+// release marks resource as free, returns false if it is free already
+func (board *Board) release(resource *Resource) bool {
+	if resource.Holder == nil {
+		return false
+	}
+
+	resource.Holder = nil
+	board.UpdatedAt = time.Now()
+
+	// a booking going on takes the resource before the line
+	if resource.activeBooking(board.UpdatedAt) == nil {
+		resource.offer(board.UpdatedAt)
+	}
+
+	return true
+}
+
+// toggleNotify subscribes or unsubscribes user, returns new subscription state
+func (board *Board) toggleNotify(userID int64) bool {
+	board.UpdatedAt = time.Now()
+
+	if i := slices.Index(board.Notify, userID); i >= 0 {
+		board.Notify = slices.Delete(board.Notify, i, i+1)
+
+		return false
+	}
+
+	board.Notify = append(board.Notify, userID)
+
+	return true
+}
+
+func (board *Board) clone() *Board {
+	if board == nil {
+		return nil
+	}
+
+	c := *board
+	c.Notify = slices.Clone(board.Notify)
+	c.States = slices.Clone(board.States)
+	c.Resources = make([]*Resource, 0, len(board.Resources))
+
+	for _, resource := range board.Resources {
+		r := *resource
+		if resource.Holder != nil {
+			h := *resource.Holder
+			r.Holder = &h
+		}
+
+		r.Holders = nil
+		for _, holder := range resource.Holders {
+			h := *holder
+			r.Holders = append(r.Holders, &h)
+		}
+
+		r.Queue = nil
+		for _, waiter := range resource.Queue {
+			w := *waiter
+			r.Queue = append(r.Queue, &w)
+		}
+
+		r.Bookings = nil
+		for _, booking := range resource.Bookings {
+			b := *booking
+			r.Bookings = append(r.Bookings, &b)
+		}
+
+		c.Resources = append(c.Resources, &r)
+	}
+
+	return &c
+}
+
+func (board *Board) buttonText(resource *Resource) string {
+	if resource.shared() {
+		return board.states()[board.stateOf(resource)].Emoji + resource.Name + " " + resource.slotsText()
+	}
+
+	return board.states()[board.stateOf(resource)].Emoji + resource.Name
+}
+
+func (board *Board) itemText(resource *Resource) string {
+	if resource.shared() {
+		if len(resource.Holders) == 0 {
+			return board.buttonText(resource)
+		}
+
+		return fmt.Sprintf("%s (%s)", board.buttonText(resource), resource.holdersText())
+	}
+
+	if waiter := resource.offeredTo(); waiter != nil {
+		return fmt.Sprintf("%s (kept for %s until %s)%s", board.buttonText(resource), waiter.Name, waiter.OfferedUntil.Local().Format("15:04"), resource.queueText())
+	}
+
+	if resource.Holder == nil || resource.Holder.Name == "" {
+		return board.buttonText(resource) + resource.queueText()
+	}
+
+	details := resource.Holder.Name
+
+	// emoji of custom states are not known by heart
+	if len(board.States) > 0 {
+		details = board.stateLabel(resource) + " by " + details
+	}
+	if resource.Holder.Note != "" {
+		details += ": " + resource.Holder.Note
+	}
+
+	if !resource.Holder.Until.IsZero() {
+		details += ", until " + resource.Holder.untilText()
+	}
+
+	return fmt.Sprintf("%s (%s)%s", board.buttonText(resource), details, resource.queueText())
+}
+
+// untilText is the end of the hold, with the date when it is not the day
+// the hold began
+func (holder *Holder) untilText() string {
+	until := holder.Until.Local()
+	since := holder.Since.Local()
+
+	if until.Year() == since.Year() && until.YearDay() == since.YearDay() {
+		return until.Format("15:04")
+	}
+
+	return until.Format("Jan 2 15:04")
+}
+
+func (board *Board) notifyText() string {
+	if len(board.Notify) > 0 {
+		return fmt.Sprintf("%s%d", notifyEmoji, len(board.Notify))
+	}
+
+	return notifyEmoji
+}
+
+// text renders message text of the board
+func (board *Board) text() string {
+	items := make([]string, 0, len(board.Resources))
+	for _, resource := range board.Resources {
+		items = append(items, board.itemText(resource))
+	}
+
+	if board.Title != "" {
+		return board.Title + "\n" + strings.Join(items, "  ")
+	}
+
+	return strings.Join(items, "  ")
+}
+
+// splitText splits message text of a board into its title and items
+func splitText(text string) (string, []string) {
+	title, items, ok := strings.Cut(text, "\n")
+	if !ok {
+		return "", strings.Split(text, "  ")
+	}
+
+	return title, strings.Split(items, "  ")
+}
+
+// keyboard renders inline keyboard of the board, buttons carry only a short signed token
+func (board *Board) keyboard() *models.InlineKeyboardMarkup {
+	kb := &models.InlineKeyboardMarkup{}
+
+	for _, row := range board.rows() {
+		buttons := make([]models.InlineKeyboardButton, 0, len(row))
+
+		for _, resource := range row {
+			buttons = append(
+				buttons,
+				models.InlineKeyboardButton{
+					CallbackData: signCallback(board.ChatID, board.pressToken(resource).String()),
+					Text:         board.buttonText(resource),
+				},
+			)
+		}
+
+		kb.InlineKeyboard = append(kb.InlineKeyboard, buttons)
+	}
+
+	// notifications are always the last row
+	kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+		{
+			CallbackData: signCallback(board.ChatID, callbackToken{BoardID: board.ID, Action: actionNotify}.String()),
+			Text:         board.notifyText(),
+		},
+	})
+
+	return kb
+}
+
+func fullName(user models.User) string {
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
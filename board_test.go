@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_Board_takeRelease(t *testing.T) {
+	board := newBoard(1, []string{"dev1", "dev2"})
+	user := models.User{ID: 10, FirstName: "Very Long Firstname", LastName: "Even Longer Lastname"}
+
+	resource := board.resource(2)
+	if resource == nil || resource.Name != "dev2" {
+		t.Fatalf("resource(2) = %#v, want dev2", resource)
+	}
+
+	if !board.take(resource, user) {
+		t.Fatalf("take() = false, want true")
+	}
+
+	if board.take(resource, models.User{ID: 11}) {
+		t.Errorf("second take() = true, want false")
+	}
+
+	if resource.Holder.ID != 10 || resource.Holder.Name != "Very Long Firstname Even Longer Lastname" {
+		t.Errorf("holder = %#v", resource.Holder)
+	}
+
+	if got, want := board.text(), "🟢dev1  🏗️dev2 (Very Long Firstname Even Longer Lastname)"; got != want {
+		t.Errorf("text() = %v, want %v", got, want)
+	}
+
+	if !board.release(resource) {
+		t.Errorf("release() = false, want true")
+	}
+
+	if board.release(resource) {
+		t.Errorf("second release() = true, want false")
+	}
+}
+
+func Test_Board_toggleNotify(t *testing.T) {
+	board := newBoard(1, []string{"dev1"})
+
+	for i := int64(1); i <= 100; i++ {
+		if !board.toggleNotify(i) {
+			t.Fatalf("toggleNotify(%d) = false, want true", i)
+		}
+	}
+
+	if got := board.notifyText(); got != "⚡100" {
+		t.Errorf("notifyText() = %v, want ⚡100", got)
+	}
+
+	if board.toggleNotify(50) {
+		t.Errorf("toggleNotify(50) = true, want false")
+	}
+
+	if len(board.Notify) != 99 {
+		t.Errorf("len(Notify) = %d, want 99", len(board.Notify))
+	}
+}
+
+func Test_Board_keyboard(t *testing.T) {
+	board := newBoard(1, []string{"a-very-long-resource-name-that-did-not-fit-into-callback-data-before"})
+	board.ID = "zz"
+	board.take(board.Resources[0], models.User{ID: 1, FirstName: "name"})
+	board.Resources[0].Holder.Since = time.UnixMilli(36)
+
+	kb := board.keyboard()
+
+	if len(kb.InlineKeyboard) != 2 {
+		t.Fatalf("rows = %d, want 2", len(kb.InlineKeyboard))
+	}
+
+	tests := []struct {
+		button models.InlineKeyboardButton
+		text   string
+		data   string
+	}{
+		{
+			button: kb.InlineKeyboard[0][0],
+			text:   "🏗️a-very-long-resource-name-that-did-not-fit-into-callback-data-before",
+			data:   signCallback(1, "zz:1:r:@1.10"),
+		},
+		{
+			button: kb.InlineKeyboard[1][0],
+			text:   "⚡",
+			data:   signCallback(1, "zz:0:n"),
+		},
+	}
+	for _, tt := range tests {
+		if tt.button.Text != tt.text || tt.button.CallbackData != tt.data {
+			t.Errorf("button = %#v, want %s %s", tt.button, tt.text, tt.data)
+		}
+	}
+}
+
+func Test_Board_clone(t *testing.T) {
+	board := newBoard(1, []string{"dev1"})
+	board.take(board.Resources[0], models.User{ID: 1})
+	board.toggleNotify(1)
+
+	c := board.clone()
+	c.Resources[0].Holder.Name = "changed"
+	c.Notify[0] = 2
+
+	if board.Resources[0].Holder.Name == "changed" || board.Notify[0] == 2 {
+		t.Errorf("clone() shares state with original")
+	}
+}
+
+func Test_Board_renameTitle(t *testing.T) {
+	board := newBoard(1, []string{"dev1", "dev2"})
+	board.take(board.Resources[1], models.User{ID: 1, FirstName: "user"})
+
+	if board.renameResource(board.Resources[0], "DEV2") {
+		t.Errorf("renameResource() to a taken name = true, want false")
+	}
+
+	if !board.renameResource(board.Resources[1], "stage") || board.Resources[1].Holder == nil {
+		t.Errorf("renameResource() lost the holder: %#v", board.Resources[1])
+	}
+
+	board.setTitle("  test\n  servers ")
+
+	if got, want := board.text(), "test servers\n🟢dev1  🏗️stage (user)"; got != want {
+		t.Errorf("text() = %q, want %q", got, want)
+	}
+
+	title, items := splitText(board.text())
+	if title != "test servers" || len(items) != 2 || items[1] != "🏗️stage (user)" {
+		t.Errorf("splitText() = %q, %q", title, items)
+	}
+
+	board.setTitle("")
+
+	if title, items := splitText(board.text()); title != "" || len(items) != 2 {
+		t.Errorf("splitText() without title = %q, %q", title, items)
+	}
+}
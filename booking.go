@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+var errBadSlot = errors.New("the time must be like tomorrow 14:00-16:00, the day is today, tomorrow, a weekday or 2024-05-06, up to 7 days long")
+
+// Booking reserves a resource for a user ahead of time, at Start the resource
+// is taken for the user until End
+type Booking struct {
+	UserID int64     `json:"user_id"`
+	Name   string    `json:"name,omitempty"`
+	Note   string    `json:"note,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// Reminded is set once the user was told the booking starts soon
+	Reminded bool `json:"reminded,omitempty"`
+	// Blocked is set once the holder was asked to give the resource up
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+func (booking *Booking) user() models.User {
+	return models.User{ID: booking.UserID, FirstName: booking.Name}
+}
+
+// overlaps reports whether the booking shares time with start-end
+func (booking *Booking) overlaps(start, end time.Time) bool {
+	return booking.Start.Before(end) && start.Before(booking.End)
+}
+
+// slotText is "Mon May 6 14:00-16:00", the end has the date too when it is
+// another day
+func slotText(start, end time.Time) string {
+	start, end = start.Local(), end.Local()
+
+	if y, m, d := start.Date(); end.Year() != y || end.Month() != m || end.Day() != d {
+		return start.Format("Mon Jan 2 15:04") + " - " + end.Format("Mon Jan 2 15:04")
+	}
+
+	return start.Format("Mon Jan 2 15:04") + "-" + end.Format("15:04")
+}
+
+// parseSlot reads [day] HH:MM-HH:MM from words, returns the slot and how many
+// words it took. An end before the start is on the next day.
+func parseSlot(words []string, now time.Time) (time.Time, time.Time, int, error) {
+	if len(words) == 0 {
+		return time.Time{}, time.Time{}, 0, errBadSlot
+	}
+
+	local := now.Local()
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	used := 0
+
+	if d, ok := parseDay(words[0], day); ok {
+		day, used = d, 1
+	}
+
+	if len(words) <= used {
+		return time.Time{}, time.Time{}, 0, errBadSlot
+	}
+
+	from, to, ok := strings.Cut(words[used], "-")
+	if !ok {
+		return time.Time{}, time.Time{}, 0, errBadSlot
+	}
+
+	start, err := time.ParseInLocation("15:04", from, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, errBadSlot
+	}
+
+	end, err := time.ParseInLocation("15:04", to, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, errBadSlot
+	}
+
+	start = time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, time.Local)
+	end = time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, time.Local)
+
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+
+	if end.Sub(start) > maxHoldFor {
+		return time.Time{}, time.Time{}, 0, errBadSlot
+	}
+
+	return start, end, used + 1, nil
+}
+
+// parseDay reads today, tomorrow, a weekday (the next one, today included)
+// or a date like 2024-05-06
+func parseDay(word string, today time.Time) (time.Time, bool) {
+	word = strings.ToLower(word)
+
+	switch word {
+	case "today":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	}
+
+	if d, err := time.ParseInLocation("2006-01-02", word, time.Local); err == nil {
+		return d, true
+	}
+
+	if len(word) < 3 {
+		return time.Time{}, false
+	}
+
+	for i := range 7 {
+		d := today.AddDate(0, 0, i)
+		if strings.HasPrefix(strings.ToLower(d.Weekday().String()), word) {
+			return d, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// activeBooking is the booking of the resource going on at now
+func (resource *Resource) activeBooking(now time.Time) *Booking {
+	for _, booking := range resource.Bookings {
+		if !now.Before(booking.Start) && now.Before(booking.End) {
+			return booking
+		}
+	}
+
+	return nil
+}
+
+// nextBooking is the first booking of someone but userID ending after now
+func (resource *Resource) nextBooking(userID int64, now time.Time) *Booking {
+	for _, booking := range resource.Bookings {
+		if booking.UserID != userID && now.Before(booking.End) {
+			return booking
+		}
+	}
+
+	return nil
+}
+
+// book adds the booking unless it conflicts with another booking or with
+// a timed hold of someone else, returns the text for the user
+func (resource *Resource) book(booking *Booking) (string, error) {
+	if resource.shared() {
+		return fmt.Sprintf("%s is shared, take a slot of it instead", resource.Name), errNotModified
+	}
+
+	for _, other := range resource.Bookings {
+		if other.overlaps(booking.Start, booking.End) {
+			return fmt.Sprintf("%s is booked by %s on %s", resource.Name, other.Name, slotText(other.Start, other.End)), errNotModified
+		}
+	}
+
+	if holder := resource.Holder; holder != nil && holder.ID != booking.UserID && holder.Until.After(booking.Start) {
+		return fmt.Sprintf("%s is held by %s until %s", resource.Name, holder.Name, holder.untilText()), errNotModified
+	}
+
+	resource.Bookings = append(resource.Bookings, booking)
+	slices.SortFunc(resource.Bookings, func(a, b *Booking) int { return a.Start.Compare(b.Start) })
+
+	return fmt.Sprintf("%s is booked for you on %s", resource.Name, slotText(booking.Start, booking.End)), nil
+}
+
+// unbook cancels the next booking of the user, returns it or nil
+func (resource *Resource) unbook(userID int64) *Booking {
+	i := slices.IndexFunc(resource.Bookings, func(b *Booking) bool { return b.UserID == userID })
+	if i < 0 {
+		return nil
+	}
+
+	booking := resource.Bookings[i]
+	resource.Bookings = slices.Delete(resource.Bookings, i, i+1)
+
+	return booking
+}
+
+// handleBook answers /book name [day] HH:MM-HH:MM [note] and /unbook name
+func handleBook(ctx context.Context, b *bot.Bot, message *models.Message, cancel bool) {
+	if stateless {
+		replyText(ctx, b, message, "bookings need a storage, they are not kept in stateless mode")
+
+		return
+	}
+
+	command := "/book name [day] 14:00-16:00 [note]"
+	if cancel {
+		command = "/unbook name"
+	}
+
+	rows, err := splitQuoted(strings.ReplaceAll(commandArgs(message.Text), "\n", " "))
+	if err != nil || len(rows) == 0 {
+		replyText(ctx, b, message, "you must send command in format "+command)
+
+		return
+	}
+
+	words := rows[0]
+	for _, row := range rows[1:] {
+		words = append(words, row...)
+	}
+
+	now := time.Now()
+	user := sender(message)
+	booking := &Booking{UserID: user.ID, Name: fullName(user)}
+
+	if !cancel {
+		start, end, used, err := parseSlot(words[1:], now)
+		if err != nil {
+			replyText(ctx, b, message, err.Error())
+
+			return
+		}
+
+		if start.Before(now) {
+			replyText(ctx, b, message, fmt.Sprintf("%s has passed, send /take %s to take it now", start.Local().Format("Mon Jan 2 15:04"), commandName(words[0])))
+
+			return
+		}
+
+		booking.Start, booking.End = start, end
+		booking.Note = strings.Join(words[1+used:], " ")
+	}
+
+	list, err := chatBoards(message)
+	if err != nil {
+		log.Printf("error on list boards of %d: %s\n", message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	matches := matchResources(list, words[0])
+
+	switch len(matches) {
+	case 0:
+		replyText(ctx, b, message, fmt.Sprintf("there is no %s on the boards of this chat", words[0]))
+
+		return
+	case 1:
+	default:
+		replyText(ctx, b, message, fmt.Sprintf("%d items match %s: %s, be more precise", len(matches), words[0], matchNames(matches)))
+
+		return
+	}
+
+	boardID, resourceID := matches[0].Board.ID, matches[0].Resource.ID
+
+	unlock := boardLocks.Lock(boardID)
+	defer unlock()
+
+	var text string
+
+	_, err = updateBoard(boards, boardID, user, func(board *Board) error {
+		resource := board.resource(resourceID)
+		if resource == nil {
+			text = "this item was removed from the board"
+
+			return errNotModified
+		}
+
+		if !cancel {
+			var err error
+
+			text, err = resource.book(booking)
+
+			return err
+		}
+
+		cancelled := resource.unbook(user.ID)
+		if cancelled == nil {
+			text = fmt.Sprintf("you have no bookings of %s", resource.Name)
+
+			return errNotModified
+		}
+
+		text = fmt.Sprintf("your booking of %s on %s is cancelled", resource.Name, slotText(cancelled.Start, cancelled.End))
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errNotModified) {
+		log.Printf("error on book %s: %s\n", boardID, err)
+
+		text = "sorry, you cant't do that now"
+	}
+
+	replyText(ctx, b, message, text)
+}
+
+// matchNames lists matches with their boards
+func matchNames(matches []match) string {
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m.Resource.Name+" · "+m.Board.label())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// handleBookings answers /bookings [name] with upcoming bookings of the
+// resources of the chat, or of the resources called name
+func handleBookings(ctx context.Context, b *bot.Bot, message *models.Message) {
+	if stateless {
+		replyText(ctx, b, message, "bookings need a storage, they are not kept in stateless mode")
+
+		return
+	}
+
+	list, err := chatBoards(message)
+	if err != nil {
+		log.Printf("error on list boards of %d: %s\n", message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	name := strings.TrimSpace(commandArgs(message.Text))
+
+	var matches []match
+
+	if name == "" {
+		for _, board := range list {
+			for _, resource := range board.Resources {
+				matches = append(matches, match{Board: board, Resource: resource})
+			}
+		}
+	} else if matches = matchResources(list, name); len(matches) == 0 {
+		replyText(ctx, b, message, fmt.Sprintf("there is no %s on the boards of this chat", name))
+
+		return
+	}
+
+	lines := []string{}
+
+	for _, m := range matches {
+		if len(m.Resource.Bookings) == 0 {
+			continue
+		}
+
+		lines = append(lines, m.Resource.Name+":")
+
+		for _, booking := range m.Resource.Bookings {
+			line := slotText(booking.Start, booking.End) + " " + booking.Name
+			if booking.Note != "" {
+				line += ": " + booking.Note
+			}
+
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) == 0 {
+		replyText(ctx, b, message, "there are no bookings, send /book name tomorrow 14:00-16:00 to make one")
+
+		return
+	}
+
+	replyText(ctx, b, message, strings.Join(lines, "\n"))
+}
+
+// startedBooking is a booking that came to its start, Holder is who still
+// holds the resource if the booking could not take it
+type startedBooking struct {
+	Resource *Resource
+	Booking  *Booking
+	Holder   *Holder
+}
+
+// checkBookings takes resources for bookings that started, reminds users
+// of bookings that start soon and forgets bookings that ended
+func checkBookings(ctx context.Context, b *bot.Bot, boardID string, now time.Time) {
+	unlock := boardLocks.Lock(boardID)
+	defer unlock()
+
+	var started, blocked, reminded []startedBooking
+
+	board, err := updateBoard(boards, boardID, holdTimer, func(board *Board) error {
+		started, blocked, reminded = nil, nil, nil
+		changed := false
+
+		for _, resource := range board.Resources {
+			kept := []*Booking{}
+
+			for _, booking := range resource.Bookings {
+				switch {
+				case !now.Before(booking.End):
+					// the resource was never given up
+					changed = true
+				case !now.Before(booking.Start) && (resource.Holder == nil || resource.Holder.ID == booking.UserID):
+					// bookings come before the line
+					if waiter := resource.offeredTo(); waiter != nil {
+						waiter.OfferedUntil, waiter.Told = time.Time{}, false
+					}
+
+					if resource.Holder == nil {
+						if !board.take(resource, booking.user()) {
+							kept = append(kept, booking)
+
+							continue
+						}
+
+						resource.Holder.Note = booking.Note
+						started = append(started, startedBooking{Resource: resource, Booking: booking})
+					}
+
+					resource.Holder.Until = booking.End
+					resource.Holder.Warned = false
+					changed = true
+				case !now.Before(booking.Start):
+					if !booking.Blocked {
+						booking.Blocked = true
+						blocked = append(blocked, startedBooking{Resource: resource, Booking: booking, Holder: resource.Holder})
+						changed = true
+					}
+
+					kept = append(kept, booking)
+				case !booking.Reminded && booking.Start.Sub(now) <= holdWarning:
+					booking.Reminded = true
+					reminded = append(reminded, startedBooking{Resource: resource, Booking: booking})
+					changed = true
+
+					kept = append(kept, booking)
+				default:
+					kept = append(kept, booking)
+				}
+			}
+
+			if len(kept) == 0 {
+				kept = nil
+			}
+
+			resource.Bookings = kept
+		}
+
+		if !changed {
+			return errNotModified
+		}
+
+		board.UpdatedAt = now
+
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errNotModified) {
+			log.Printf("error on check bookings of %s: %s\n", boardID, err)
+		}
+
+		return
+	}
+
+	if len(started) > 0 {
+		editBoardMessage(ctx, b, board)
+	}
+
+	send := func(chatID int64, text string) {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text}); err != nil {
+			log.Printf("error on send message to %d: %s\n", chatID, err)
+		}
+	}
+
+	for _, s := range started {
+		send(s.Booking.UserID, fmt.Sprintf("your booking started, %s is yours until %s · %s", s.Resource.Name, s.Resource.Holder.untilText(), board.chatLabel()))
+		notifySubscribers(ctx, b, board, s.Resource, s.Booking.user())
+	}
+
+	for _, s := range blocked {
+		send(s.Booking.UserID, fmt.Sprintf("your booking of %s · %s started, but %s still holds it, it's yours once released", s.Resource.Name, board.chatLabel(), s.Holder.Name))
+		send(s.Holder.ID, fmt.Sprintf("%s · %s is booked by %s from %s, release it please", s.Resource.Name, board.chatLabel(), s.Booking.Name, s.Booking.Start.Local().Format("15:04")))
+	}
+
+	for _, s := range reminded {
+		send(s.Booking.UserID, fmt.Sprintf("your booking of %s · %s starts at %s", s.Resource.Name, board.chatLabel(), s.Booking.Start.Local().Format("15:04")))
+	}
+}
+
+// bookingDue reports whether checkBookings has anything to do with the board
+func (board *Board) bookingDue(now time.Time) bool {
+	for _, resource := range board.Resources {
+		for _, booking := range resource.Bookings {
+			switch {
+			case !now.Before(booking.End):
+				return true
+			case !now.Before(booking.Start):
+				if resource.Holder == nil || resource.Holder.ID == booking.UserID || !booking.Blocked {
+					return true
+				}
+			case !booking.Reminded && booking.Start.Sub(now) <= holdWarning:
+				return true
+			}
+		}
+	}
+
+	return false
+}
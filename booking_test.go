@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_parseSlot(t *testing.T) {
+	// a monday
+	now := time.Date(2024, 5, 6, 15, 0, 0, 0, time.Local)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 5, day, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		args      string
+		wantStart time.Time
+		wantEnd   time.Time
+		wantUsed  int
+		wantErr   bool
+	}{
+		{args: "16:00-17:30 demo", wantStart: at(6, 16, 0), wantEnd: at(6, 17, 30), wantUsed: 1},
+		{args: "tomorrow 14:00-16:00", wantStart: at(7, 14, 0), wantEnd: at(7, 16, 0), wantUsed: 2},
+		{args: "Wed 9:00-10:30", wantStart: at(8, 9, 0), wantEnd: at(8, 10, 30), wantUsed: 2},
+		{args: "monday 22:00-02:00", wantStart: at(6, 22, 0), wantEnd: at(7, 2, 0), wantUsed: 2},
+		{args: "2024-05-10 10:00-11:00", wantStart: at(10, 10, 0), wantEnd: at(10, 11, 0), wantUsed: 2},
+		{args: "tomorrow", wantErr: true},
+		{args: "soon 10:00-11:00", wantErr: true},
+		{args: "10-11", wantErr: true},
+		{args: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			start, end, used, err := parseSlot(strings.Fields(tt.args), now)
+			if (err != nil) != tt.wantErr || !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) || used != tt.wantUsed {
+				t.Errorf("parseSlot() = %v, %v, %d, %v, want %v, %v, %d", start, end, used, err, tt.wantStart, tt.wantEnd, tt.wantUsed)
+			}
+		})
+	}
+
+	if got := slotText(at(6, 22, 0), at(7, 2, 0)); got != "Mon May 6 22:00 - Tue May 7 02:00" {
+		t.Errorf("slotText() = %q", got)
+	}
+}
+
+func Test_Resource_book(t *testing.T) {
+	now := time.Date(2024, 5, 6, 15, 0, 0, 0, time.Local)
+	at := func(hour int) time.Time { return now.Add(time.Duration(hour-15) * time.Hour) }
+
+	board := newBoard(1, []string{"dev1"})
+	resource := board.Resources[0]
+	board.take(resource, models.User{ID: 1, FirstName: "Ann"})
+	resource.Holder.Since = now
+	resource.Holder.Until = at(17)
+
+	tests := []struct {
+		name    string
+		booking Booking
+		want    string
+		wantErr bool
+	}{
+		{name: "timed hold", booking: Booking{UserID: 2, Name: "Bob", Start: at(16), End: at(18)}, want: "dev1 is held by Ann until 17:00", wantErr: true},
+		{name: "after the hold", booking: Booking{UserID: 2, Name: "Bob", Start: at(17), End: at(18)}, want: "dev1 is booked for you on Mon May 6 17:00-18:00"},
+		{name: "holder", booking: Booking{UserID: 1, Name: "Ann", Start: at(19), End: at(20)}, want: "dev1 is booked for you on Mon May 6 19:00-20:00"},
+		{name: "overlap", booking: Booking{UserID: 3, Name: "Cid", Start: at(16), End: at(21)}, want: "dev1 is booked by Bob on Mon May 6 17:00-18:00", wantErr: true},
+		{name: "between", booking: Booking{UserID: 3, Name: "Cid", Start: at(18), End: at(19)}, want: "dev1 is booked for you on Mon May 6 18:00-19:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			booking := tt.booking
+
+			got, err := resource.book(&booking)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("book() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	names := []string{}
+	for _, booking := range resource.Bookings {
+		names = append(names, booking.Name)
+	}
+
+	if fmt.Sprint(names) != "[Bob Cid Ann]" {
+		t.Errorf("bookings = %v", names)
+	}
+
+	// a hold may not run into a booking of someone else
+	if got, err := applyHold(board, callbackToken{ResourceID: 1, Action: actionExtend, Arg: "30m"}, models.User{ID: 1}, now); err == nil {
+		t.Errorf("applyHold() = %q", got)
+	}
+
+	if cancelled := resource.unbook(3); cancelled == nil || cancelled.Name != "Cid" || len(resource.Bookings) != 2 {
+		t.Errorf("unbook() = %#v", cancelled)
+	}
+}
+
+func Test_handleBook(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	const chatID = 240
+
+	var messages []string
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 2400, "chat": map[string]any{"id": chatID}}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	ann := &models.User{ID: 24, FirstName: "Ann"}
+	bob := &models.User{ID: 25, FirstName: "Bob"}
+
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/create dev1 qa", Chat: models.Chat{ID: chatID}, From: ann}})
+
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	slot := func(from, to int) string {
+		day := func(hour int) time.Time {
+			return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), hour, 0, 0, 0, time.Local)
+		}
+
+		return slotText(day(from), day(to))
+	}
+
+	tests := []struct {
+		text string
+		from *models.User
+		want string
+	}{
+		{text: "/book", want: "you must send command in format /book name [day] 14:00-16:00 [note]"},
+		{text: "/book dev1 soon", want: errBadSlot.Error()},
+		{text: "/book prod tomorrow 14:00-16:00", want: "there is no prod on the boards of this chat"},
+		{text: "/book dev1 2020-01-01 14:00-16:00", want: "Wed Jan 1 14:00 has passed, send /take dev1 to take it now"},
+		{text: "/book dev1 tomorrow 14:00-16:00 demo day", want: "dev1 is booked for you on " + slot(14, 16)},
+		{text: "/book dev1 tomorrow 15:00-17:00", from: bob, want: "dev1 is booked by Ann on " + slot(14, 16)},
+		{text: "/book dev1 tomorrow 16:00-17:00", from: bob, want: "dev1 is booked for you on " + slot(16, 17)},
+		{text: "/bookings", want: "dev1:\n" + slot(14, 16) + " Ann: demo day\n" + slot(16, 17) + " Bob"},
+		{text: "/bookings qa", want: "there are no bookings, send /book name tomorrow 14:00-16:00 to make one"},
+		{text: "/unbook dev1", want: "your booking of dev1 on " + slot(14, 16) + " is cancelled"},
+		{text: "/unbook dev1", want: "you have no bookings of dev1"},
+		{text: "/bookings dev1", want: "dev1:\n" + slot(16, 17) + " Bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			messages = nil
+
+			from := ann
+			if tt.from != nil {
+				from = tt.from
+			}
+
+			handler(ctx, b, &models.Update{Message: &models.Message{Text: tt.text, Chat: models.Chat{ID: chatID}, From: from}})
+
+			if want := fmt.Sprint([]string{fmt.Sprintf("%d: %s", chatID, tt.want)}); fmt.Sprint(messages) != want {
+				t.Errorf("messages = %q, want %q", messages, want)
+			}
+		})
+	}
+}
+
+func Test_checkBookings(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	var (
+		messages []string
+		edits    []string
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	ann := models.User{ID: 251, FirstName: "Ann"}
+	bob := models.User{ID: 252, FirstName: "Bob"}
+	cid := models.User{ID: 253, FirstName: "Cid"}
+
+	booking := func(user models.User, start, end time.Duration) []*Booking {
+		return []*Booking{{UserID: user.ID, Name: user.FirstName, Start: now.Add(start), End: now.Add(end)}}
+	}
+
+	board := newBoard(-250, []string{"dev1", "dev2", "dev3", "dev4"})
+	board.ChatTitle = "Team"
+	board.MessageID = 2500
+	board.Notify = []int64{cid.ID}
+	board.take(board.Resources[1], ann)
+	board.Resources[0].Bookings = booking(bob, -time.Second, time.Hour)
+	board.Resources[1].Bookings = booking(bob, -time.Second, time.Hour)
+	board.Resources[2].Bookings = booking(cid, 5*time.Minute, time.Hour)
+	board.Resources[3].Bookings = booking(cid, -time.Hour, -time.Second)
+	board, _ = boards.Create(board)
+
+	// later checks of other tests must not see bookings still due
+	defer func() { _ = boards.Delete(board.ID) }()
+
+	checkHolds(ctx, b, now)
+
+	until := (&Holder{Since: now, Until: now.Add(time.Hour)}).untilText()
+	wantMessages := []string{
+		"252: your booking started, dev1 is yours until " + until + " · Team",
+		"253: 🏗️dev1 status updated by Bob",
+		"252: your booking of dev2 · Team started, but Ann still holds it, it's yours once released",
+		"251: dev2 · Team is booked by Bob from " + now.Local().Format("15:04") + ", release it please",
+		"253: your booking of dev3 · Team starts at " + now.Add(5*time.Minute).Local().Format("15:04"),
+	}
+
+	if fmt.Sprint(messages) != fmt.Sprint(wantMessages) {
+		t.Errorf("messages = %q, want %q", messages, wantMessages)
+	}
+
+	if want := "[-250: 🏗️dev1 (Bob, until " + until + ")  🏗️dev2 (Ann)  🟢dev3  🟢dev4]"; fmt.Sprint(edits) != want {
+		t.Errorf("edits = %q, want %q", edits, want)
+	}
+
+	// reminders and requests to release are sent once
+	messages, edits = nil, nil
+
+	checkHolds(ctx, b, now)
+
+	if len(messages) != 0 || len(edits) != 0 {
+		t.Errorf("messages = %q, edits = %q", messages, edits)
+	}
+
+	// a resource released during a booking goes to the booker only
+	_, _, _ = pressButton(ctx, b, callbackToken{BoardID: board.ID, ResourceID: 2, Action: actionRelease}, ann, "")
+
+	if _, text, _ := pressButton(ctx, b, callbackToken{BoardID: board.ID, ResourceID: 2, Action: actionTake}, cid, ""); text != "dev2 is booked by Bob until "+now.Add(time.Hour).Local().Format("15:04") {
+		t.Errorf("take during a booking = %q", text)
+	}
+
+	checkHolds(ctx, b, now)
+
+	board, _ = boards.Get(board.ID)
+	if holder := board.Resources[1].Holder; holder == nil || holder.ID != bob.ID || !holder.Until.Equal(now.Add(time.Hour)) {
+		t.Errorf("holder = %#v", holder)
+	}
+
+	for _, resource := range board.Resources {
+		if resource.Name != "dev3" && len(resource.Bookings) != 0 {
+			t.Errorf("bookings of %s = %v", resource.Name, resource.Bookings)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	actionTake    = "t"
+	actionRelease = "r"
+	actionNotify  = "n"
+	// confirms removal of a busy resource
+	actionRemove = "x"
+	// release from the /mine panel, only while the presser still holds it
+	actionReleaseMine = "m"
+	// release from the expiry warning, the same as actionReleaseMine
+	actionReleaseNow = "w"
+	// sets the end of a hold of the presser, Arg is the time
+	actionHoldFor = "f"
+	// moves the end of a hold of the presser, Arg is the duration
+	actionExtend = "e"
+	// joins or leaves the line for a busy resource
+	actionQueue = "q"
+	// gives up the resource kept for the first in line
+	actionSkip = "k"
+	// moves the resource to a held state of the board, Arg is its index
+	actionState = "s"
+	// takes a slot of a shared resource or returns the one of the presser
+	actionSlot = "c"
+)
+
+// holderMark separates the expected hold in Arg of release and state
+// tokens, sinceMark the start of the hold from the holder
+const (
+	holderMark = "@"
+	sinceMark  = "."
+)
+
+// callbackToken is the only thing stored in callback_data of board buttons,
+// the state itself lives in the board store
+type callbackToken struct {
+	BoardID    string
+	ResourceID int
+	Action     string
+	// Arg is an optional argument of the action
+	Arg string
+}
+
+func (t callbackToken) String() string {
+	s := t.BoardID + ":" + strconv.Itoa(t.ResourceID) + ":" + t.Action
+	if t.Arg != "" {
+		s += ":" + t.Arg
+	}
+
+	return s
+}
+
+// withHolder adds the hold the keyboard shows to Arg, "2@k3f.lx9qz2" is
+// state 2 of a resource held by user k3f since the millisecond lx9qz2, a
+// press on a stale keyboard must not change a hold taken after it was
+// drawn, even by the same user
+func (t callbackToken) withHolder(holder *Holder) callbackToken {
+	if holder != nil {
+		t.Arg += holderMark + strconv.FormatInt(holder.ID, 36) + sinceMark + strconv.FormatInt(holder.Since.UnixMilli(), 36)
+	}
+
+	return t
+}
+
+// expectedHolder cuts the hold the keyboard showed off Arg, ok is false
+// for tokens that don't carry one
+func (t callbackToken) expectedHolder() (callbackToken, holdMark, bool) {
+	arg, hold, ok := strings.Cut(t.Arg, holderMark)
+	if !ok {
+		return t, holdMark{}, false
+	}
+
+	id, since, ok := strings.Cut(hold, sinceMark)
+	if !ok {
+		return t, holdMark{}, false
+	}
+
+	holderID, err := strconv.ParseInt(id, 36, 64)
+	if err != nil {
+		return t, holdMark{}, false
+	}
+
+	sinceMilli, err := strconv.ParseInt(since, 36, 64)
+	if err != nil {
+		return t, holdMark{}, false
+	}
+
+	t.Arg = arg
+
+	return t, holdMark{ID: holderID, Since: sinceMilli}, true
+}
+
+// holdMark is the hold a keyboard was drawn for
+type holdMark struct {
+	ID    int64
+	Since int64 // unix milliseconds
+}
+
+// matches reports whether holder is still the hold the keyboard showed
+func (m holdMark) matches(holder *Holder) bool {
+	return holder != nil && holder.ID == m.ID && holder.Since.UnixMilli() == m.Since
+}
+
+func parseCallbackToken(data string) (callbackToken, bool) {
+	parts := strings.Split(data, ":")
+	if len(parts) < 3 || len(parts) > 4 || parts[0] == "" || parts[2] == "" {
+		return callbackToken{}, false
+	}
+
+	arg := ""
+	if len(parts) == 4 {
+		arg = parts[3]
+	}
+
+	resourceID, err := strconv.Atoi(parts[1])
+	if err != nil || resourceID < 0 {
+		return callbackToken{}, false
+	}
+
+	return callbackToken{
+		BoardID:    parts[0],
+		ResourceID: resourceID,
+		Action:     parts[2],
+		Arg:        arg,
+	}, true
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func Test_parseCallbackToken(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want callbackToken
+		ok   bool
+	}{
+		{
+			name: "take",
+			data: "1a:3:t",
+			want: callbackToken{BoardID: "1a", ResourceID: 3, Action: actionTake},
+			ok:   true,
+		},
+		{
+			name: "notify",
+			data: "1a:0:n",
+			want: callbackToken{BoardID: "1a", Action: actionNotify},
+			ok:   true,
+		},
+		{
+			name: "with argument",
+			data: "1a:3:f:2h",
+			want: callbackToken{BoardID: "1a", ResourceID: 3, Action: actionHoldFor, Arg: "2h"},
+			ok:   true,
+		},
+		{
+			name: "too many parts",
+			data: "1a:3:f:2h:1",
+		},
+		{
+			name: "legacy string",
+			data: "free-test",
+		},
+		{
+			name: "legacy json",
+			data: `{"c":"busy-test"}`,
+		},
+		{
+			name: "bad resource",
+			data: "1a:x:t",
+		},
+		{
+			name: "empty board",
+			data: ":1:t",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCallbackToken(tt.data)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseCallbackToken() = %#v, %v, want %#v, %v", got, ok, tt.want, tt.ok)
+			}
+
+			if ok && got.String() != tt.data {
+				t.Errorf("String() = %v, want %v", got.String(), tt.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+// most slots a shared resource may have
+const maxCapacity = 99
+
+// capacitySuffix is "*5" at the end of a name given to /create and /add
+var capacitySuffix = regexp.MustCompile(`^(.*\S)\*(\d{1,2})$`)
+
+// splitCapacity cuts the number of slots off a name like "licenses*5",
+// names without one have a single slot
+func splitCapacity(name string) (string, int) {
+	m := capacitySuffix.FindStringSubmatch(name)
+	if m == nil {
+		return name, 1
+	}
+
+	capacity, _ := strconv.Atoi(m[2])
+	if capacity < 1 || capacity > maxCapacity {
+		return name, 1
+	}
+
+	return m[1], capacity
+}
+
+// hasCapacity reports whether any of names asks for several slots
+func hasCapacity(rows [][]string) bool {
+	for _, row := range rows {
+		for _, name := range row {
+			if _, capacity := splitCapacity(name); capacity > 1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// shared reports whether the resource has several slots taken one by one
+func (resource *Resource) shared() bool {
+	return resource.Capacity > 1
+}
+
+// nameSpec is the name with the number of slots as /create takes it
+func (resource *Resource) nameSpec() string {
+	if resource.shared() {
+		return fmt.Sprintf("%s*%d", resource.Name, resource.Capacity)
+	}
+
+	return resource.Name
+}
+
+// holders are everybody who holds the resource or a slot of it
+func (resource *Resource) holders() []*Holder {
+	if resource.Holder != nil {
+		return []*Holder{resource.Holder}
+	}
+
+	return resource.Holders
+}
+
+// holderOf is the hold of userID on the resource, nil if there is none
+func (resource *Resource) holderOf(userID int64) *Holder {
+	for _, holder := range resource.holders() {
+		if holder.ID == userID {
+			return holder
+		}
+	}
+
+	return nil
+}
+
+// holderNames lists who holds the resource or its slots
+func (resource *Resource) holderNames() string {
+	names := make([]string, 0, len(resource.holders()))
+	for _, holder := range resource.holders() {
+		names = append(names, holder.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// full reports whether all slots of a shared resource are taken
+func (resource *Resource) full() bool {
+	return len(resource.Holders) >= resource.Capacity
+}
+
+// takeSlot gives user one slot of the shared resource, returns false
+// if the user has one already or there is none left
+func (board *Board) takeSlot(resource *Resource, user models.User) bool {
+	if resource.holderOf(user.ID) != nil || resource.full() {
+		return false
+	}
+
+	now := time.Now()
+
+	resource.Holders = append(resource.Holders, &Holder{
+		ID:    user.ID,
+		Name:  fullName(user),
+		Since: now,
+	})
+	board.UpdatedAt = now
+
+	return true
+}
+
+// releaseBy returns what userID holds of the resource: their slot of
+// a shared one or the whole of any other, returns false if they hold nothing
+func (board *Board) releaseBy(resource *Resource, userID int64) bool {
+	if !resource.shared() {
+		return resource.Holder != nil && resource.Holder.ID == userID && board.release(resource)
+	}
+
+	i := slices.IndexFunc(resource.Holders, func(h *Holder) bool { return h.ID == userID })
+	if i < 0 {
+		return false
+	}
+
+	resource.Holders = slices.Delete(resource.Holders, i, i+1)
+	board.UpdatedAt = time.Now()
+
+	return true
+}
+
+// slotsText is "2/5", taken slots of all
+func (resource *Resource) slotsText() string {
+	return fmt.Sprintf("%d/%d", len(resource.Holders), resource.Capacity)
+}
+
+// holdersText lists holders of the slots with their notes
+func (resource *Resource) holdersText() string {
+	names := make([]string, 0, len(resource.Holders))
+
+	for _, holder := range resource.Holders {
+		name := holder.Name
+		if holder.Note != "" {
+			name += ": " + holder.Note
+		}
+
+		names = append(names, name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// applySlot takes or returns a slot of a shared resource, a press on the
+// button takes a slot of the presser or returns the one they have
+func applySlot(board *Board, resource *Resource, token callbackToken, user models.User) (*Resource, string, error) {
+	action := token.Action
+
+	if action == actionSlot {
+		action = actionTake
+		if resource.holderOf(user.ID) != nil {
+			action = actionRelease
+		}
+	}
+
+	switch action {
+	case actionTake:
+		if resource.holderOf(user.ID) != nil {
+			return nil, fmt.Sprintf("you hold a slot of %s already", resource.Name), errNotModified
+		}
+
+		if !board.takeSlot(resource, user) {
+			return nil, fmt.Sprintf("all %d slots of %s are taken by %s", resource.Capacity, resource.Name, resource.holdersText()), errNotModified
+		}
+	case actionRelease:
+		if !board.releaseBy(resource, user.ID) {
+			return nil, fmt.Sprintf("you hold no slot of %s", resource.Name), errNotModified
+		}
+	default:
+		return nil, fmt.Sprintf("%s is shared, its slots are free or busy", resource.Name), errNotModified
+	}
+
+	return resource, fmt.Sprintf("%s updated by %s", resource.Name, fullName(user)), nil
+}
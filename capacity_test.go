@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_splitCapacity(t *testing.T) {
+	tests := []struct {
+		name         string
+		wantName     string
+		wantCapacity int
+	}{
+		{name: "licenses*5", wantName: "licenses", wantCapacity: 5},
+		{name: "ci runner*3", wantName: "ci runner", wantCapacity: 3},
+		{name: "dev1", wantName: "dev1", wantCapacity: 1},
+		{name: "a*b", wantName: "a*b", wantCapacity: 1},
+		{name: "*5", wantName: "*5", wantCapacity: 1},
+		{name: "pool*0", wantName: "pool*0", wantCapacity: 1},
+		{name: "pool*100", wantName: "pool*100", wantCapacity: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name, capacity := splitCapacity(tt.name); name != tt.wantName || capacity != tt.wantCapacity {
+				t.Errorf("splitCapacity() = %q, %d, want %q, %d", name, capacity, tt.wantName, tt.wantCapacity)
+			}
+		})
+	}
+
+	if _, err := parseRows("licenses licenses*5"); err == nil {
+		t.Errorf("parseRows() of a repeated shared name is not an error")
+	}
+}
+
+func Test_applySlot(t *testing.T) {
+	ann := models.User{ID: 1, FirstName: "Ann"}
+	bob := models.User{ID: 2, FirstName: "Bob"}
+
+	board := newBoard(1, []string{"licenses*2", "dev1"})
+	resource := board.Resources[0]
+
+	press := func(user models.User) string {
+		_, text, _ := applyAction(board, board.pressToken(resource), user)
+
+		return text
+	}
+
+	tests := []struct {
+		user     models.User
+		want     string
+		wantItem string
+	}{
+		{user: ann, want: "licenses updated by Ann", wantItem: "🟢licenses 1/2 (Ann)"},
+		{user: bob, want: "licenses updated by Bob", wantItem: "🏗️licenses 2/2 (Ann, Bob)"},
+		{user: ann, want: "licenses updated by Ann", wantItem: "🟢licenses 1/2 (Bob)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantItem, func(t *testing.T) {
+			if got := press(tt.user); got != tt.want {
+				t.Errorf("press() = %q, want %q", got, tt.want)
+			}
+
+			if got := board.itemText(resource); got != tt.wantItem {
+				t.Errorf("itemText() = %q, want %q", got, tt.wantItem)
+			}
+		})
+	}
+
+	if _, text, err := applyAction(board, callbackToken{ResourceID: resource.ID, Action: actionRelease}, ann); err == nil || text != "you hold no slot of licenses" {
+		t.Errorf("applyAction() = %q, %v", text, err)
+	}
+
+	if !board.holds(bob.ID) || board.holds(ann.ID) || !board.releaseBy(resource, bob.ID) || len(resource.holders()) != 0 {
+		t.Errorf("holders = %#v", resource.Holders)
+	}
+
+	template := templateOf(board, "pool")
+	if got := template.board(1).Resources[0]; !strings.Contains(template.String(), "licenses*2") || got.Name != "licenses" || got.Capacity != 2 {
+		t.Errorf("template = %s, resource = %#v", template, got)
+	}
+}
+
+func Test_handleCapacity(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	const chatID = 270
+
+	var (
+		messages []string
+		markups  []string
+		edits    []string
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "chat_id")+": "+formValue(body, "text"))
+		markups = append(markups, formValue(body, "reply_markup"))
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 2700, "chat": map[string]any{"id": chatID}}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	ann := &models.User{ID: 27, FirstName: "Ann"}
+	bob := &models.User{ID: 28, FirstName: "Bob"}
+	cid := &models.User{ID: 29, FirstName: "Cid"}
+	dan := &models.User{ID: 30, FirstName: "Dan"}
+
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/create licenses*3 dev1", Chat: models.Chat{ID: chatID}, From: ann}})
+
+	kb := &models.InlineKeyboardMarkup{}
+	if err := json.Unmarshal([]byte(markups[0]), kb); err != nil || kb.InlineKeyboard[0][0].Text != "🟢licenses 0/3" {
+		t.Fatalf("markup = %q, %v", markups[0], err)
+	}
+
+	board, _ := boards.GetByMessage(chatID, 2700)
+	button := kb.InlineKeyboard[0][0].CallbackData
+
+	tests := []struct {
+		text      string
+		from      *models.User
+		want      []string
+		wantEdits []string
+	}{
+		{from: ann, wantEdits: []string{"270: 🟢licenses 1/3 (Ann)  🟢dev1"}},
+		{text: "/take licenses ci", from: bob, want: []string{"270: licenses updated by Bob"}, wantEdits: []string{"270: 🟢licenses 2/3 (Ann, Bob: ci)  🟢dev1"}},
+		{text: "/take licenses", from: bob, want: []string{"270: you hold a slot of licenses already"}},
+		{text: "/take licenses", from: cid, want: []string{"270: licenses updated by Cid"}, wantEdits: []string{"270: 🏗️licenses 3/3 (Ann, Bob: ci, Cid)  🟢dev1"}},
+		{text: "/take licenses", from: dan, want: []string{"270: all 3 slots of licenses are taken by Ann, Bob: ci, Cid"}},
+		{from: ann, wantEdits: []string{"270: 🟢licenses 2/3 (Bob: ci, Cid)  🟢dev1"}},
+		{text: "/release licenses", from: ann, want: []string{"270: you hold no slot of licenses"}},
+		{text: "/queue licenses", from: dan, want: []string{"270: licenses is shared, there is no line for its slots"}},
+		{text: "/book licenses tomorrow 10:00-11:00", from: dan, want: []string{"270: licenses is shared, take a slot of it instead"}},
+		{text: "/releaseall", from: cid, want: []string{"270: released licenses"}, wantEdits: []string{"270: 🟢licenses 1/3 (Bob: ci)  🟢dev1"}},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d %s", i, tt.text), func(t *testing.T) {
+			messages, markups, edits = nil, nil, nil
+
+			if tt.text == "" {
+				handler(ctx, b, &models.Update{
+					CallbackQuery: &models.CallbackQuery{
+						Data: button,
+						From: *tt.from,
+						Message: models.MaybeInaccessibleMessage{
+							Type:    models.MaybeInaccessibleMessageTypeMessage,
+							Message: &models.Message{ID: 2700, Chat: models.Chat{ID: chatID}},
+						},
+					},
+				})
+			} else {
+				handler(ctx, b, &models.Update{Message: &models.Message{Text: tt.text, Chat: models.Chat{ID: chatID}, From: tt.from}})
+			}
+
+			if fmt.Sprint(messages) != fmt.Sprint(tt.want) {
+				t.Errorf("messages = %q, want %q", messages, tt.want)
+			}
+
+			if tt.wantEdits != nil && fmt.Sprint(edits) != fmt.Sprint(tt.wantEdits) {
+				t.Errorf("edits = %q, want %q", edits, tt.wantEdits)
+			}
+		})
+	}
+
+	if text, _, err := minePanel(bob.ID, board.CreatedAt); err != nil || !strings.HasPrefix(text, "you hold:\n🟢licenses 1/3 (Bob: ci) · ") {
+		t.Errorf("minePanel() = %q, %v", text, err)
+	}
+
+	events, _ := boards.Events(board.ID, 0)
+	texts := []string{}
+
+	for _, e := range events {
+		texts = append(texts, e.text())
+	}
+
+	want := []string{"licenses taken by Ann", "licenses taken by Bob: ci", "licenses taken by Cid", "licenses released by Ann", "licenses released by Cid"}
+	if got := texts[len(texts)-len(want):]; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+
+	replayed := replayEvents(events)[board.ID]
+	if replayed == nil || replayed.itemText(replayed.Resources[0]) != "🟢licenses 1/3 (Bob: ci)" {
+		t.Errorf("replayed = %#v", replayed)
+	}
+
+	// taken slots make the item busy for /remove and are reported by /close
+	reply := func(text string) {
+		messages, markups, edits = nil, nil, nil
+
+		handler(ctx, b, &models.Update{Message: &models.Message{
+			Text:           text,
+			Chat:           models.Chat{ID: chatID},
+			From:           ann,
+			ReplyToMessage: &models.Message{ID: 2700, Chat: models.Chat{ID: chatID}},
+		}})
+	}
+
+	reply("/remove licenses")
+
+	if want := "[270: licenses is taken by Bob, remove it anyway?]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	if board, _ = boards.Get(board.ID); len(board.Resources) != 2 {
+		t.Errorf("resources = %d, the shared item was removed", len(board.Resources))
+	}
+
+	reply("/close")
+
+	if want := "[270: 🟢licenses 1/3 (Bob: ci) · Bob just now\n🟢dev1\nclosed by Ann]"; fmt.Sprint(edits) != want {
+		t.Errorf("edits = %q, want %q", edits, want)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+var errNotAllowed = errors.New("only the creator of the board or admins of the chat can do that")
+
+// handleClose answers /close sent as a reply to a board: the keyboard is
+// removed and the final state is written into the text, the bot forgets the board
+func handleClose(ctx context.Context, b *bot.Bot, message *models.Message) {
+	board, err := retiredBoard(ctx, b, message, "/close", closeEvent)
+	if err != nil {
+		return
+	}
+
+	// stateless holds are known only since the board was posted
+	if stateless {
+		for _, resource := range board.Resources {
+			if resource.Holder != nil {
+				resource.Holder.Since = time.Time{}
+			}
+		}
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    board.ChatID,
+		MessageID: board.MessageID,
+		Text:      board.closedText(sender(message), time.Now()),
+	})
+	if err != nil {
+		log.Printf("error on close %d/%d: %s\n", board.ChatID, board.MessageID, err)
+
+		replyText(ctx, b, message, "failed to update the board message")
+
+		return
+	}
+
+	replyText(ctx, b, message, "board closed")
+}
+
+// handleDelete answers /delete sent as a reply to a board: the message
+// is deleted and the bot forgets the board
+func handleDelete(ctx context.Context, b *bot.Bot, message *models.Message) {
+	board, err := retiredBoard(ctx, b, message, "/delete", deleteEvent)
+	if err != nil {
+		return
+	}
+
+	_, err = b.DeleteMessage(ctx, &bot.DeleteMessageParams{
+		ChatID:    board.ChatID,
+		MessageID: board.MessageID,
+	})
+	if err != nil {
+		log.Printf("error on delete %d/%d: %s\n", board.ChatID, board.MessageID, err)
+
+		replyText(ctx, b, message, "the board is forgotten, but its message can't be deleted, delete it by hand")
+
+		return
+	}
+
+	replyText(ctx, b, message, "board deleted")
+}
+
+// retiredBoard checks that the sender may retire the board the message
+// replies to and removes it from the store with the event made by event,
+// problems are answered in the chat
+func retiredBoard(ctx context.Context, b *bot.Bot, message *models.Message, command string, event func(boardID string, actor models.User) Event) (*Board, error) {
+	var (
+		board *Board
+		ok    bool
+	)
+
+	if stateless {
+		if message.ReplyToMessage != nil {
+			board, ok = boardFromMessage(message.ReplyToMessage)
+		}
+	} else {
+		board, ok = repliedBoard(message)
+	}
+
+	if !ok {
+		replyText(ctx, b, message, fmt.Sprintf("reply %s to a board message", command))
+
+		return nil, errNotReply
+	}
+
+	user := sender(message)
+
+	allowed, err := mayRetire(ctx, b, board, message.Chat, user)
+	if err != nil {
+		log.Printf("error on chat member %d of %d: %s\n", user.ID, message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return nil, err
+	}
+
+	if !allowed {
+		replyText(ctx, b, message, errNotAllowed.Error())
+
+		return nil, errNotAllowed
+	}
+
+	if stateless {
+		return board, nil
+	}
+
+	unlock := boardLocks.Lock(board.ID)
+	defer unlock()
+
+	// presses done while waiting for the lock are part of the final state
+	if fresh, err := boards.Get(board.ID); err == nil {
+		board = fresh
+	}
+
+	if err := boards.Delete(board.ID, event(board.ID, user)); err != nil {
+		log.Printf("error on delete board %s: %s\n", board.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return nil, err
+	}
+
+	refreshStatus(ctx, b, board.ChatID)
+
+	return board, nil
+}
+
+// mayRetire reports whether user created the board or administers the chat,
+// in a private chat everybody is on their own
+func mayRetire(ctx context.Context, b *bot.Bot, board *Board, chat models.Chat, user models.User) (bool, error) {
+	if chat.Type == models.ChatTypePrivate || (board.CreatedBy != 0 && board.CreatedBy == user.ID) {
+		return true, nil
+	}
+
+	member, err := b.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: chat.ID, UserID: user.ID})
+	if err != nil {
+		return false, err
+	}
+
+	return member.Type == models.ChatMemberTypeOwner || member.Type == models.ChatMemberTypeAdministrator, nil
+}
+
+// closedText renders the final state of the board, one item per line
+// with how long it was held
+func (board *Board) closedText(closer models.User, now time.Time) string {
+	lines := []string{}
+
+	if board.Title != "" {
+		lines = append(lines, board.Title)
+	}
+
+	for _, resource := range board.Resources {
+		line := board.itemText(resource)
+
+		for _, holder := range resource.holders() {
+			switch {
+			case holder.Since.IsZero():
+			case resource.shared():
+				line += fmt.Sprintf(" · %s %s", holder.Name, heldFor(now.Sub(holder.Since)))
+			default:
+				line += " · " + heldFor(now.Sub(holder.Since))
+			}
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(append(lines, "closed by "+fullName(closer)), "\n")
+}
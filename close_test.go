@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_Board_closedText(t *testing.T) {
+	now := time.Now()
+	closer := models.User{ID: 1, FirstName: "Ann"}
+
+	board := newBoard(1, []string{"dev1", "dev2"})
+	board.take(board.Resources[0], models.User{ID: 2, FirstName: "Bob"})
+	board.Resources[0].Holder.Since = now.Add(-90 * time.Minute)
+
+	if got, want := board.closedText(closer, now), "🏗️dev1 (Bob) · 1h 30m\n🟢dev2\nclosed by Ann"; got != want {
+		t.Errorf("closedText() = %q, want %q", got, want)
+	}
+
+	board.Title = "Deploy"
+	board.Resources[0].Holder.Since = time.Time{}
+
+	if got, want := board.closedText(closer, now), "Deploy\n🏗️dev1 (Bob)\n🟢dev2\nclosed by Ann"; got != want {
+		t.Errorf("closedText() = %q, want %q", got, want)
+	}
+}
+
+func Test_handleCloseDelete(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	const chatID = 190
+
+	var (
+		messages  []string
+		edits     []string
+		deleted   []string
+		messageID = 1900
+		statuses  = map[string]string{"19": "member", "20": "member", "21": "administrator"}
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "text"))
+		messageID++
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": messageID, "chat": map[string]any{"id": chatID}}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "message_id")+": "+formValue(body, "text")+" "+formValue(body, "reply_markup"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/deleteMessage"] = func(body []byte) any {
+		deleted = append(deleted, formValue(body, "message_id"))
+
+		return map[string]any{"ok": true, "result": true}
+	}
+	s.hooks["/bottest_token/getChatMember"] = func(body []byte) any {
+		return map[string]any{"ok": true, "result": map[string]any{"status": statuses[formValue(body, "user_id")], "user": map[string]any{"id": 1}}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	creator := &models.User{ID: 19, FirstName: "Ann"}
+	stranger := &models.User{ID: 20, FirstName: "Bob"}
+	admin := &models.User{ID: 21, FirstName: "Eve"}
+
+	send := func(text string, from *models.User, replyTo int) {
+		message := &models.Message{Text: text, Chat: models.Chat{ID: chatID, Type: models.ChatTypeGroup}, From: from}
+		if replyTo != 0 {
+			message.ReplyToMessage = &models.Message{ID: replyTo, Chat: message.Chat}
+		}
+
+		handler(ctx, b, &models.Update{Message: message})
+	}
+
+	send("/create dev1 dev2", creator, 0)
+	send("/create qa", creator, 0)
+
+	first, _ := boards.GetByMessage(chatID, 1901)
+	if first.CreatedBy != creator.ID {
+		t.Errorf("CreatedBy = %d, want %d", first.CreatedBy, creator.ID)
+	}
+
+	send("/take dev1", stranger, 0)
+
+	tests := []struct {
+		name        string
+		text        string
+		from        *models.User
+		replyTo     int
+		want        string
+		wantEdits   []string
+		wantDeleted []string
+	}{
+		{name: "not a reply", text: "/close", from: creator, want: "reply /close to a board message"},
+		{name: "not allowed", text: "/close", from: stranger, replyTo: 1901, want: "only the creator of the board or admins of the chat can do that"},
+		{name: "creator closes", text: "/close", from: creator, replyTo: 1901, want: "board closed", wantEdits: []string{"1901: 🏗️dev1 (Bob) · just now\n🟢dev2\nclosed by Ann "}},
+		{name: "closed is forgotten", text: "/close", from: creator, replyTo: 1901, want: "reply /close to a board message"},
+		{name: "not allowed to delete", text: "/delete", from: stranger, replyTo: 1902, want: "only the creator of the board or admins of the chat can do that"},
+		{name: "admin deletes", text: "/delete", from: admin, replyTo: 1902, want: "board deleted", wantDeleted: []string{"1902"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, edits, deleted = nil, nil, nil
+
+			send(tt.text, tt.from, tt.replyTo)
+
+			if fmt.Sprint(messages) != fmt.Sprint([]string{tt.want}) {
+				t.Errorf("messages = %q, want %q", messages, tt.want)
+			}
+
+			if fmt.Sprint(edits) != fmt.Sprint(tt.wantEdits) {
+				t.Errorf("edits = %q, want %q", edits, tt.wantEdits)
+			}
+
+			if fmt.Sprint(deleted) != fmt.Sprint(tt.wantDeleted) {
+				t.Errorf("deleted = %q, want %q", deleted, tt.wantDeleted)
+			}
+		})
+	}
+
+	if list, _ := boards.List(chatID); len(list) != 0 {
+		t.Errorf("boards left: %d", len(list))
+	}
+
+	events, _ := boards.Events(first.ID, 0)
+	if last := events[len(events)-1]; last.text() != "board closed by Ann" {
+		t.Errorf("last event = %q", last.text())
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/exp/slices"
+)
+
+// callback_data limit of Telegram in bytes
+const callbackDataLimit = 64
+
+// room left for the payload next to its signature
+const payloadLimit = callbackDataLimit - len(signatureSeparator) - signatureLen
+
+const payloadVersion = 1
+
+// commands are dictionary coded into a single byte
+const (
+	cmdTake byte = iota
+	cmdRelease
+	cmdNotify
+)
+
+// holder name carried in a payload is only a fallback for the message text
+const maxPayloadHolder = 24
+
+var (
+	errBadPayload = errors.New("bad callback payload")
+	errBoardFull  = errors.New("board does not fit into callback data")
+)
+
+var payloadEncoding = base64.RawURLEncoding
+
+// callbackPayload is the state one button of a stateless board carries.
+// Subscribers of the board are spread over all buttons of the keyboard.
+type callbackPayload struct {
+	Command  byte
+	Index    int    // resource position on the board
+	Name     string // resource name, only legacy payloads have it
+	HolderID int64
+	Holder   string
+	Notify   []int64
+}
+
+// payloadSize is the number of raw bytes fitting into callback_data
+func payloadSize() int {
+	return payloadEncoding.DecodedLen(payloadLimit)
+}
+
+// appendHeader encodes everything but subscribers:
+// version, command, resource index and for busy resources the holder
+func (p callbackPayload) appendHeader(raw []byte) []byte {
+	raw = append(raw, payloadVersion, p.Command)
+
+	if p.Command == cmdNotify {
+		return raw
+	}
+
+	raw = binary.AppendUvarint(raw, uint64(p.Index))
+
+	if p.Command == cmdRelease {
+		holder := truncateName(toLatin(p.Holder), maxPayloadHolder)
+
+		raw = binary.AppendUvarint(raw, uint64(p.HolderID))
+		raw = binary.AppendUvarint(raw, uint64(len(holder)))
+		raw = append(raw, holder...)
+	}
+
+	return raw
+}
+
+// encodePayload packs p and as many of subscribers as fit, returns callback_data
+// and the subscribers left over for other buttons
+func encodePayload(p callbackPayload, subscribers []int64) (string, []int64, error) {
+	raw := p.appendHeader(make([]byte, 0, payloadSize()))
+	if len(raw) > payloadSize() {
+		return "", subscribers, errBoardFull
+	}
+
+	// sorted ids are stored as deltas, first one of the chunk as is
+	prev := int64(0)
+	for len(subscribers) > 0 {
+		next := binary.AppendUvarint(raw, uint64(subscribers[0]-prev))
+		if len(next) > payloadSize() {
+			break
+		}
+
+		raw = next
+		prev = subscribers[0]
+		subscribers = subscribers[1:]
+	}
+
+	encoded := payloadEncoding.EncodeToString(raw)
+	if !checkStringLimit(encoded, payloadLimit) {
+		return "", subscribers, errBoardFull
+	}
+
+	return encoded, subscribers, nil
+}
+
+// decodePayload reads callback_data of a stateless board, either binary
+// or one of the legacy formats
+func decodePayload(data string) (callbackPayload, error) {
+	if cbd, ok := parseLegacyCallback(data); ok {
+		return legacyPayload(cbd), nil
+	}
+
+	p := callbackPayload{}
+
+	raw, err := payloadEncoding.DecodeString(data)
+	if err != nil || len(raw) < 2 || raw[0] != payloadVersion || raw[1] > cmdNotify {
+		return p, errBadPayload
+	}
+
+	p.Command = raw[1]
+	raw = raw[2:]
+
+	if p.Command != cmdNotify {
+		index, n := binary.Uvarint(raw)
+		if n <= 0 || index >= 1<<16 {
+			return p, errBadPayload
+		}
+
+		p.Index = int(index)
+		raw = raw[n:]
+	}
+
+	if p.Command == cmdRelease {
+		holderID, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return p, errBadPayload
+		}
+
+		raw = raw[n:]
+
+		size, n := binary.Uvarint(raw)
+		if n <= 0 || size > uint64(len(raw)-n) {
+			return p, errBadPayload
+		}
+
+		p.HolderID = int64(holderID)
+		p.Holder = string(raw[n : n+int(size)])
+		raw = raw[n+int(size):]
+	}
+
+	prev := int64(0)
+	for len(raw) > 0 {
+		delta, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return p, errBadPayload
+		}
+
+		prev += int64(delta)
+		p.Notify = append(p.Notify, prev)
+		raw = raw[n:]
+	}
+
+	return p, nil
+}
+
+func legacyPayload(cbd *CallbackData) callbackPayload {
+	if strings.HasPrefix(cbd.Command, notifyEmoji) {
+		return callbackPayload{Command: cmdNotify, Notify: cbd.Notify}
+	}
+
+	name, busy := legacyResource(cbd.Command)
+	if busy {
+		return callbackPayload{Command: cmdRelease, Name: name, Holder: cbd.User, Notify: cbd.Notify}
+	}
+
+	return callbackPayload{Command: cmdTake, Name: name, Notify: cbd.Notify}
+}
+
+// encodeKeyboardPayloads returns callback_data for every resource of the board
+// and for the notify button, subscribers are spread over all of them
+func encodeKeyboardPayloads(board *Board) ([]string, string, error) {
+	subscribers := slices.Clone(board.Notify)
+	slices.Sort(subscribers)
+	subscribers = slices.Compact(subscribers)
+
+	notify, subscribers, err := encodePayload(callbackPayload{Command: cmdNotify}, subscribers)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data := make([]string, 0, len(board.Resources))
+
+	for i, resource := range board.Resources {
+		p := callbackPayload{Command: cmdTake, Index: i}
+		if resource.Holder != nil {
+			p.Command = cmdRelease
+			p.HolderID = resource.Holder.ID
+			p.Holder = resource.Holder.Name
+		}
+
+		var encoded string
+
+		encoded, subscribers, err = encodePayload(p, subscribers)
+		if err != nil {
+			return nil, "", err
+		}
+
+		data = append(data, encoded)
+	}
+
+	if len(subscribers) > 0 {
+		return nil, "", errBoardFull
+	}
+
+	return data, notify, nil
+}
+
+// truncateName cuts name to limit bytes without breaking runes
+func truncateName(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+
+	name = name[:limit]
+	for len(name) > 0 && !utf8.ValidString(name) {
+		name = name[:len(name)-1]
+	}
+
+	return name
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+func Test_decodePayload(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want callbackPayload
+		err  error
+	}{
+		{
+			name: "legacy string",
+			data: "busy-dev1",
+			want: callbackPayload{Command: cmdTake, Name: "dev1"},
+		},
+		{
+			name: "legacy json",
+			data: `{"c":"free-dev1","u":"name"}`,
+			want: callbackPayload{Command: cmdRelease, Name: "dev1", Holder: "name"},
+		},
+		{
+			name: "legacy json notify",
+			data: `{"c":"⚡2","n":[1,2]}`,
+			want: callbackPayload{Command: cmdNotify, Notify: []int64{1, 2}},
+		},
+		{
+			name: "binary notify",
+			data: payloadEncoding.EncodeToString([]byte{payloadVersion, cmdNotify, 5, 2}),
+			want: callbackPayload{Command: cmdNotify, Notify: []int64{5, 7}},
+		},
+		{
+			name: "binary release",
+			data: payloadEncoding.EncodeToString([]byte{payloadVersion, cmdRelease, 1, 9, 1, 'a'}),
+			want: callbackPayload{Command: cmdRelease, Index: 1, HolderID: 9, Holder: "a"},
+		},
+		{
+			name: "unknown version",
+			data: payloadEncoding.EncodeToString([]byte{payloadVersion + 1, cmdNotify}),
+			err:  errBadPayload,
+		},
+		{
+			name: "unknown command",
+			data: payloadEncoding.EncodeToString([]byte{payloadVersion, 9}),
+			err:  errBadPayload,
+		},
+		{
+			name: "holder overflow",
+			data: payloadEncoding.EncodeToString([]byte{payloadVersion, cmdRelease, 0, 9, 10, 'a'}),
+			err:  errBadPayload,
+		},
+		{
+			name: "token",
+			data: "1a:1:t",
+			err:  errBadPayload,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePayload(tt.data)
+			if err != tt.err {
+				t.Fatalf("decodePayload() error = %v, want %v", err, tt.err)
+			}
+
+			if err == nil && !payloadEqual(got, tt.want) {
+				t.Errorf("decodePayload() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_encodeKeyboardPayloads_capacity(t *testing.T) {
+	board := newBoard(1, []string{"dev1", "dev2", "dev3", "stage", "prod"})
+	board.take(board.Resources[0], models.User{ID: 1234567890, FirstName: "Константин", LastName: "Константинопольский"})
+
+	subscriber := func(i int) int64 {
+		return 5000000000 + int64(i)*7919
+	}
+
+	// legacy JSON carried all subscribers in the notify button
+	legacy := []int64{}
+	for {
+		data, _ := json.Marshal(CallbackData{Command: notifyEmoji, Notify: append(legacy, subscriber(len(legacy)))})
+		if len(data) > callbackDataLimit {
+			break
+		}
+
+		legacy = append(legacy, subscriber(len(legacy)))
+	}
+
+	for i := 0; ; i++ {
+		board.Notify = append(board.Notify, subscriber(i))
+
+		if _, _, err := encodeKeyboardPayloads(board); err != nil {
+			board.Notify = board.Notify[:len(board.Notify)-1]
+
+			break
+		}
+	}
+
+	if len(board.Notify) < len(legacy)*4 {
+		t.Errorf("board fits %d subscribers, legacy json fitted %d", len(board.Notify), len(legacy))
+	}
+
+	data, notify, err := encodeKeyboardPayloads(board)
+	if err != nil {
+		t.Fatalf("encodeKeyboardPayloads() error %s", err)
+	}
+
+	got := []int64{}
+	for _, d := range append(data, notify) {
+		if len(d) > callbackDataLimit {
+			t.Errorf("callback_data %s is %d bytes", d, len(d))
+		}
+
+		p, err := decodePayload(d)
+		if err != nil {
+			t.Fatalf("decodePayload(%s) error %s", d, err)
+		}
+
+		got = append(got, p.Notify...)
+	}
+
+	slices.Sort(got)
+
+	if !slices.Equal(got, board.Notify) {
+		t.Errorf("subscribers = %v, want %v", got, board.Notify)
+	}
+}
+
+func Test_truncateName(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  string
+	}{
+		{name: "short", limit: 10, want: "short"},
+		{name: "veryveryveryveryvery", limit: 8, want: "veryvery"},
+		{name: "Имя", limit: 5, want: "Им"},
+		{name: "Имя", limit: 1, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateName(tt.name, tt.limit); got != tt.want {
+				t.Errorf("truncateName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzPayloadRoundTrip(f *testing.F) {
+	f.Add(byte(cmdTake), 0, int64(0), "", int64(1), int64(2))
+	f.Add(byte(cmdRelease), 3, int64(1234567890), "Константин К.", int64(35623), int64(987654321))
+	f.Add(byte(cmdNotify), 0, int64(0), "", int64(8000000000), int64(8000000001))
+
+	f.Fuzz(func(t *testing.T, command byte, index int, holderID int64, holder string, a, b int64) {
+		if command > cmdNotify || index < 0 || index >= 1<<16 || holderID < 0 || a <= 0 || b <= 0 {
+			t.Skip()
+		}
+
+		p := callbackPayload{Command: command, Index: index, HolderID: holderID, Holder: holder}
+		subscribers := []int64{min(a, b), max(a, b)}
+
+		data, left, err := encodePayload(p, subscribers)
+		if err != nil {
+			if err != errBoardFull {
+				t.Fatalf("encodePayload() error %s", err)
+			}
+
+			return
+		}
+
+		if len(data) > callbackDataLimit {
+			t.Fatalf("encodePayload() = %d bytes", len(data))
+		}
+
+		got, err := decodePayload(data)
+		if err != nil {
+			t.Fatalf("decodePayload(%s) error %s", data, err)
+		}
+
+		want := p
+		want.Notify = subscribers[:len(subscribers)-len(left)]
+
+		switch command {
+		case cmdNotify:
+			want.Index, want.HolderID, want.Holder = 0, 0, ""
+		case cmdTake:
+			want.HolderID, want.Holder = 0, ""
+		case cmdRelease:
+			want.Holder = truncateName(toLatin(holder), maxPayloadHolder)
+		}
+
+		if !payloadEqual(got, want) {
+			t.Errorf("decodePayload() = %#v, want %#v", got, want)
+		}
+	})
+}
+
+func FuzzDecodePayload(f *testing.F) {
+	f.Add("busy-dev1")
+	f.Add(`{"c":"⚡","n":[1]}`)
+	f.Add(payloadEncoding.EncodeToString([]byte{payloadVersion, cmdRelease, 1, 9, 1, 'a', 3}))
+
+	f.Fuzz(func(t *testing.T, data string) {
+		p, err := decodePayload(data)
+		if err != nil || p.Name != "" {
+			return
+		}
+
+		// whatever decodes must encode back into the same state
+		again, left, err := encodePayload(p, p.Notify)
+		if err != nil || len(left) > 0 {
+			return
+		}
+
+		got, err := decodePayload(again)
+		if err != nil {
+			t.Fatalf("decodePayload(%s) error %s", again, err)
+		}
+
+		if got.Command != p.Command || got.Index != p.Index || got.HolderID != p.HolderID {
+			t.Errorf("decodePayload() = %#v, want %#v", got, p)
+		}
+	})
+}
+
+func payloadEqual(a, b callbackPayload) bool {
+	return a.Command == b.Command && a.Index == b.Index && a.Name == b.Name &&
+		a.HolderID == b.HolderID && a.Holder == b.Holder && slices.Equal(a.Notify, b.Notify)
+}
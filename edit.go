@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+var (
+	errNotReply     = errors.New("not a reply to a board")
+	errLastResource = errors.New("the board must keep at least one item")
+)
+
+// changeRepliedBoard applies fn to the board the message replies to and
+// renders the board in place, holders and subscribers are kept as they are.
+// When fn returns an error nothing is changed and the error is returned.
+func changeRepliedBoard(ctx context.Context, b *bot.Bot, message *models.Message, fn func(board *Board) error) (*Board, error) {
+	if stateless {
+		return changeStatelessBoard(ctx, b, message, fn)
+	}
+
+	board, ok := repliedBoard(message)
+	if !ok {
+		return nil, errNotReply
+	}
+
+	unlock := boardLocks.Lock(board.ID)
+	defer unlock()
+
+	board, err := updateBoard(boards, board.ID, sender(message), fn)
+	if err != nil {
+		return board, err
+	}
+
+	editBoardMessage(ctx, b, board)
+
+	return board, nil
+}
+
+func changeStatelessBoard(ctx context.Context, b *bot.Bot, message *models.Message, fn func(board *Board) error) (*Board, error) {
+	replied := message.ReplyToMessage
+	if replied == nil {
+		return nil, errNotReply
+	}
+
+	unlock := boardLocks.Lock(fmt.Sprintf("%d/%d", replied.Chat.ID, replied.ID))
+	defer unlock()
+
+	board, ok := boardFromMessage(replied)
+	if !ok {
+		return nil, errNotReply
+	}
+
+	if err := fn(board); err != nil {
+		return board, err
+	}
+
+	return board, editStatelessMessage(ctx, b, board)
+}
+
+// handleAdd answers /add name1 nameN sent as a reply to a board
+func handleAdd(ctx context.Context, b *bot.Bot, message *models.Message) {
+	args := commandArgs(message.Text)
+
+	rows, err := parseRows(args)
+	if err != nil {
+		replyText(ctx, b, message, fmt.Sprintf("can't add: %s", err))
+
+		return
+	}
+
+	if len(rows) == 0 {
+		replyText(ctx, b, message, "you must send command in format /add name1 name2 nameN as a reply to a board, | starts a new row")
+
+		return
+	}
+
+	if stateless && hasCapacity(rows) {
+		replyText(ctx, b, message, "shared items need a storage, stateless items are free or busy")
+
+		return
+	}
+
+	// "/add | dev5" puts dev5 on a row of its own
+	newRow := strings.HasPrefix(args, string(rowSeparator))
+
+	var added, skipped []string
+
+	_, err = changeRepliedBoard(ctx, b, message, func(board *Board) error {
+		added, skipped = nil, nil
+
+		for i, row := range rows {
+			rowStarted := i == 0 && !newRow
+
+			for _, name := range row {
+				if base, _ := splitCapacity(name); board.resourceByName(base) != nil {
+					skipped = append(skipped, name)
+
+					continue
+				}
+
+				if rowStarted {
+					board.addResource(name)
+				} else {
+					board.addRow([]string{name})
+					rowStarted = true
+				}
+
+				added = append(added, name)
+			}
+		}
+
+		if len(added) == 0 {
+			return errNotModified
+		}
+
+		return nil
+	})
+
+	lines := []string{}
+
+	switch {
+	case errors.Is(err, errNotReply):
+		replyText(ctx, b, message, "reply /add to a board message")
+
+		return
+	case errors.Is(err, errBoardFull):
+		replyText(ctx, b, message, "the board is full, nothing was added")
+
+		return
+	case err != nil && !errors.Is(err, errNotModified):
+		log.Printf("error on add to board %s\n", err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	case err == nil:
+		lines = append(lines, "added "+strings.Join(added, ", "))
+	}
+
+	for _, name := range skipped {
+		lines = append(lines, fmt.Sprintf("%s is already on the board", name))
+	}
+
+	replyText(ctx, b, message, strings.Join(lines, "\n"))
+}
+
+// handleRemove answers /remove name1 nameN sent as a reply to a board,
+// busy resources are only removed after confirmation with a button
+func handleRemove(ctx context.Context, b *bot.Bot, message *models.Message) {
+	names, err := parseNames(commandArgs(message.Text))
+	if err != nil {
+		replyText(ctx, b, message, fmt.Sprintf("can't remove: %s", err))
+
+		return
+	}
+
+	if len(names) == 0 {
+		replyText(ctx, b, message, "you must send command in format /remove name1 name2 nameN as a reply to a board")
+
+		return
+	}
+
+	var (
+		removed, missing, kept []string
+		busy                   []*Resource
+	)
+
+	board, err := changeRepliedBoard(ctx, b, message, func(board *Board) error {
+		removed, missing, kept, busy = nil, nil, nil, nil
+
+		for _, name := range names {
+			resource := board.resourceByName(name)
+
+			switch {
+			case resource == nil:
+				missing = append(missing, name)
+			case len(resource.holders()) > 0:
+				busy = append(busy, resource)
+			case len(board.Resources) == 1:
+				kept = append(kept, resource.Name)
+			default:
+				board.removeResource(resource.ID)
+				removed = append(removed, resource.Name)
+			}
+		}
+
+		if len(removed) == 0 {
+			return errNotModified
+		}
+
+		return nil
+	})
+
+	lines := []string{}
+
+	switch {
+	case errors.Is(err, errNotReply):
+		replyText(ctx, b, message, "reply /remove to a board message")
+
+		return
+	case err != nil && !errors.Is(err, errNotModified):
+		log.Printf("error on remove from board %s\n", err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	case err == nil:
+		lines = append(lines, "removed "+strings.Join(removed, ", "))
+	}
+
+	for _, name := range missing {
+		lines = append(lines, fmt.Sprintf("there is no %s on this board", name))
+	}
+
+	for _, name := range kept {
+		lines = append(lines, fmt.Sprintf("%s was kept, %s", name, errLastResource))
+	}
+
+	kb := &models.InlineKeyboardMarkup{}
+
+	for _, resource := range busy {
+		if stateless {
+			lines = append(lines, fmt.Sprintf("%s is taken by %s, release it first", resource.Name, resource.holderNames()))
+
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%s is taken by %s, remove it anyway?", resource.Name, resource.holderNames()))
+
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{
+				Text:         "remove " + resource.Name,
+				CallbackData: signCallback(board.ChatID, callbackToken{BoardID: board.ID, ResourceID: resource.ID, Action: actionRemove}.String()),
+			},
+		})
+	}
+
+	params := &bot.SendMessageParams{
+		ChatID: message.Chat.ID,
+		Text:   strings.Join(lines, "\n"),
+	}
+
+	if len(kb.InlineKeyboard) > 0 {
+		params.ReplyMarkup = kb
+	}
+
+	if _, err := b.SendMessage(ctx, params); err != nil {
+		log.Printf("error on send message %s\n", err)
+	}
+}
+
+// handleRename answers /rename old new sent as a reply to a board,
+// the resource keeps its holder and history
+func handleRename(ctx context.Context, b *bot.Bot, message *models.Message) {
+	names, err := parseNames(commandArgs(message.Text))
+	if err != nil {
+		replyText(ctx, b, message, fmt.Sprintf("can't rename: %s", err))
+
+		return
+	}
+
+	if len(names) != 2 {
+		replyText(ctx, b, message, "you must send command in format /rename old new as a reply to a board")
+
+		return
+	}
+
+	var reply string
+
+	_, err = changeRepliedBoard(ctx, b, message, func(board *Board) error {
+		resource := board.resourceByName(names[0])
+		if resource == nil {
+			reply = fmt.Sprintf("there is no %s on this board", names[0])
+
+			return errNotModified
+		}
+
+		old := resource.Name
+
+		if !board.renameResource(resource, names[1]) {
+			reply = fmt.Sprintf("%s is already on the board", names[1])
+
+			return errNotModified
+		}
+
+		reply = fmt.Sprintf("%s renamed to %s", old, names[1])
+
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errNotReply):
+		reply = "reply /rename to a board message"
+	case errors.Is(err, errBoardFull):
+		reply = "the new name does not fit into the board, try a shorter one"
+	case err != nil && !errors.Is(err, errNotModified):
+		log.Printf("error on rename %s\n", err)
+
+		reply = "sorry, you cant't do that now"
+	}
+
+	replyText(ctx, b, message, reply)
+}
+
+// handleTitle answers /title text sent as a reply to a board,
+// the title is shown above the items, /title alone removes it
+func handleTitle(ctx context.Context, b *bot.Bot, message *models.Message) {
+	title := strings.Join(strings.Fields(commandArgs(message.Text)), " ")
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		replyText(ctx, b, message, fmt.Sprintf("title is too long, keep it under %d characters", maxTitleLength))
+
+		return
+	}
+
+	_, err := changeRepliedBoard(ctx, b, message, func(board *Board) error {
+		if board.Title == title {
+			return errNotModified
+		}
+
+		board.setTitle(title)
+
+		return nil
+	})
+
+	reply := "title updated"
+	if title == "" {
+		reply = "title removed"
+	}
+
+	switch {
+	case errors.Is(err, errNotReply):
+		reply = "reply /title to a board message"
+	case errors.Is(err, errNotModified):
+		reply = "title is the same, nothing to change"
+	case err != nil:
+		log.Printf("error on title %s\n", err)
+
+		reply = "sorry, you cant't do that now"
+	}
+
+	replyText(ctx, b, message, reply)
+}
+
+// closeConfirmation replaces the confirmation message the query came from with text
+func closeConfirmation(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, text string) {
+	if query.Message.Type != models.MaybeInaccessibleMessageTypeMessage || query.Message.Message == nil {
+		return
+	}
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    query.Message.Message.Chat.ID,
+		MessageID: query.Message.Message.ID,
+		Text:      text,
+	})
+	if err != nil {
+		log.Printf("error on close confirmation %s\n", err)
+	}
+}
+
+func replyText(ctx context.Context, b *bot.Bot, message *models.Message, text string) {
+	_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: message.Chat.ID,
+		Text:   text,
+	})
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_handleAddRemove(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	var (
+		replies []string
+		markup  string
+		edits   []string
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		replies = append(replies, formValue(body, "text"))
+		markup = formValue(body, "reply_markup")
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 500, "chat": map[string]any{"id": 50}}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	holder := models.User{ID: 5, FirstName: "holder"}
+	boardMessage := &models.Message{ID: 500, Chat: models.Chat{ID: 50}}
+
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/create dev1 dev2", Chat: models.Chat{ID: 50}, From: &holder}})
+
+	board, err := boards.GetByMessage(50, 500)
+	if err != nil {
+		t.Fatalf("board was not stored")
+	}
+
+	board, _ = updateBoard(boards, board.ID, holder, func(board *Board) error {
+		board.take(board.Resources[1], holder)
+		board.toggleNotify(holder.ID)
+
+		return nil
+	})
+
+	press := func(data string) {
+		handler(ctx, b, &models.Update{
+			CallbackQuery: &models.CallbackQuery{
+				Data: data,
+				From: models.User{ID: 6, FirstName: "admin"},
+				Message: models.MaybeInaccessibleMessage{
+					Type:    models.MaybeInaccessibleMessageTypeMessage,
+					Message: &models.Message{ID: 501, Chat: models.Chat{ID: 50}},
+				},
+			},
+		})
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		reply     *models.Message
+		want      string
+		wantBoard string
+		confirm   bool
+	}{
+		{
+			name: "not a reply",
+			text: "/add dev3",
+			want: "reply /add to a board message",
+		},
+		{
+			name:  "no names",
+			text:  "/remove",
+			reply: boardMessage,
+			want:  "you must send command in format /remove name1 name2 nameN as a reply to a board",
+		},
+		{
+			name:  "repeated name",
+			text:  "/add dev3 dev4 DEV3",
+			reply: boardMessage,
+			want:  "can't add: item 3 \"DEV3\" repeats item 1",
+		},
+		{
+			name:      "add",
+			text:      "/add dev3 DEV1 dev4",
+			reply:     boardMessage,
+			want:      "added dev3, dev4\nDEV1 is already on the board",
+			wantBoard: "🟢dev1  🏗️dev2 (holder)  🟢dev3  🟢dev4",
+		},
+		{
+			name:      "nothing to add",
+			text:      "/add dev1",
+			reply:     boardMessage,
+			want:      "dev1 is already on the board",
+			wantBoard: "🟢dev1  🏗️dev2 (holder)  🟢dev3  🟢dev4",
+		},
+		{
+			name:      "remove",
+			text:      "/remove dev1 prod dev2 dev4",
+			reply:     boardMessage,
+			want:      "removed dev1, dev4\nthere is no prod on this board\ndev2 is taken by holder, remove it anyway?",
+			wantBoard: "🏗️dev2 (holder)  🟢dev3",
+			confirm:   true,
+		},
+		{
+			name:      "last item",
+			text:      "/remove dev3",
+			reply:     boardMessage,
+			want:      "removed dev3",
+			wantBoard: "🏗️dev2 (holder)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies, markup = nil, ""
+
+			handler(ctx, b, &models.Update{
+				Message: &models.Message{Text: tt.text, Chat: models.Chat{ID: 50}, From: &holder, ReplyToMessage: tt.reply},
+			})
+
+			if len(replies) != 1 || replies[0] != tt.want {
+				t.Errorf("replies = %q, want %q", replies, tt.want)
+			}
+
+			if tt.confirm != (markup != "") {
+				t.Errorf("reply markup = %q, want confirmation %v", markup, tt.confirm)
+			}
+
+			if tt.wantBoard == "" {
+				return
+			}
+
+			got, _ := boards.Get(board.ID)
+			if got.text() != tt.wantBoard {
+				t.Errorf("board = %q, want %q", got.text(), tt.wantBoard)
+			}
+
+			if dev2 := got.resourceByName("dev2"); dev2.Holder == nil || fmt.Sprint(got.Notify) != "[5]" {
+				t.Errorf("holders and subscribers were not kept: %#v %v", dev2.Holder, got.Notify)
+			}
+		})
+	}
+
+	kb := models.InlineKeyboardMarkup{}
+
+	handler(ctx, b, &models.Update{
+		Message: &models.Message{Text: "/add dev5", Chat: models.Chat{ID: 50}, From: &holder, ReplyToMessage: boardMessage},
+	})
+	handler(ctx, b, &models.Update{
+		Message: &models.Message{Text: "/remove dev2", Chat: models.Chat{ID: 50}, From: &holder, ReplyToMessage: boardMessage},
+	})
+
+	if err := json.Unmarshal([]byte(markup), &kb); err != nil || len(kb.InlineKeyboard) != 1 {
+		t.Fatalf("confirmation = %q, %v", markup, err)
+	}
+
+	edits = nil
+
+	press(kb.InlineKeyboard[0][0].CallbackData)
+
+	got, _ := boards.Get(board.ID)
+	if got.text() != "🟢dev5" {
+		t.Errorf("board after confirmation = %q", got.text())
+	}
+
+	if fmt.Sprint(edits) != "[🟢dev5 dev2 removed by admin]" {
+		t.Errorf("edits = %q", edits)
+	}
+
+	// a second press of the same confirmation changes nothing
+	edits = nil
+
+	press(kb.InlineKeyboard[0][0].CallbackData)
+
+	if fmt.Sprint(edits) != "[🟢dev5 this item was removed from the board]" {
+		t.Errorf("edits = %q", edits)
+	}
+}
+
+func Test_handleRenameTitle(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	var (
+		replies []string
+		shown   = &models.Message{ID: 600, Chat: models.Chat{ID: 60}}
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		replies = append(replies, formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 600, "chat": map[string]any{"id": 60}}}
+	}
+	// every edit becomes the message the next command replies to
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		shown.Text = formValue(body, "text")
+		shown.ReplyMarkup = &models.InlineKeyboardMarkup{}
+
+		if err := json.Unmarshal([]byte(formValue(body, "reply_markup")), shown.ReplyMarkup); err != nil {
+			t.Errorf("reply_markup error %s", err)
+		}
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	user := models.User{ID: 7, FirstName: "user"}
+
+	defer func() { stateless = false }()
+
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/create dev1 dev2", Chat: models.Chat{ID: 60}, From: &user}})
+
+	board, err := boards.GetByMessage(60, 600)
+	if err != nil {
+		t.Fatalf("board was not stored")
+	}
+
+	_, _ = updateBoard(boards, board.ID, user, func(board *Board) error {
+		board.take(board.Resources[0], user)
+
+		return nil
+	})
+
+	tests := []struct {
+		name      string
+		stateless bool
+		text      string
+		want      string
+		wantText  string
+	}{
+		{name: "usage", text: "/rename dev1", want: "you must send command in format /rename old new as a reply to a board"},
+		{name: "title", text: "/title Test   servers", want: "title updated", wantText: "Test servers\n🏗️dev1 (user)  🟢dev2"},
+		{name: "same title", text: "/title Test servers", want: "title is the same, nothing to change", wantText: "Test servers\n🏗️dev1 (user)  🟢dev2"},
+		{name: "rename", text: "/rename DEV1 prod", want: "dev1 renamed to prod", wantText: "Test servers\n🏗️prod (user)  🟢dev2"},
+		{name: "rename to taken name", text: "/rename prod dev2", want: "dev2 is already on the board", wantText: "Test servers\n🏗️prod (user)  🟢dev2"},
+		{name: "rename unknown", text: "/rename dev1 stage", want: "there is no dev1 on this board"},
+		{name: "history follows rename", text: "/history prod", want: "dev1 renamed to prod by user"},
+		{name: "stateless rename", stateless: true, text: "/rename dev2 stage", want: "dev2 renamed to stage", wantText: "Test servers\n🏗️prod (user)  🟢stage"},
+		{name: "stateless title removed", stateless: true, text: "/title", want: "title removed", wantText: "🏗️prod (user)  🟢stage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.stateless && !stateless {
+				// the same board posted by a stateless bot
+				stored, _ := boards.Get(board.ID)
+				shown.Text = stored.text()
+				shown.ReplyMarkup, _ = stored.statelessKeyboard()
+			}
+
+			stateless = tt.stateless
+
+			replies = nil
+
+			handler(ctx, b, &models.Update{
+				Message: &models.Message{Text: tt.text, Chat: models.Chat{ID: 60}, From: &user, ReplyToMessage: shown},
+			})
+
+			if len(replies) != 1 || !strings.HasSuffix(replies[0], tt.want) {
+				t.Errorf("replies = %q, want %q", replies, tt.want)
+			}
+
+			if tt.wantText != "" && shown.Text != tt.wantText {
+				t.Errorf("message text = %q, want %q", shown.Text, tt.wantText)
+			}
+		})
+	}
+
+	if button := shown.ReplyMarkup.InlineKeyboard[0][0]; button.Text != "🏗️prod" {
+		t.Errorf("button = %q, want 🏗️prod", button.Text)
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+const exportVersion = 1
+
+// exported documents larger than this are not downloaded
+const maxImportSize = 1 << 20
+
+var errBadExport = errors.New("not a boards export")
+
+// boardsExport is the JSON document /export sends and /import reads
+type boardsExport struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Boards     []*Board  `json:"boards"`
+}
+
+func exportBoards(list []*Board) ([]byte, error) {
+	return json.MarshalIndent(boardsExport{
+		Version:    exportVersion,
+		ExportedAt: time.Now().UTC(),
+		Boards:     list,
+	}, "", "  ")
+}
+
+func parseBoardsExport(data []byte) (*boardsExport, error) {
+	doc := &boardsExport{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("%w: %s", errBadExport, err)
+	}
+
+	if doc.Version != exportVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", errBadExport, doc.Version)
+	}
+
+	for i, board := range doc.Boards {
+		if board == nil || len(board.Resources) == 0 {
+			return nil, fmt.Errorf("%w: board %d has no resources", errBadExport, i+1)
+		}
+
+		if err := checkExportedBoard(board); err != nil {
+			return nil, fmt.Errorf("%w: board %d %s", errBadExport, i+1, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// checkExportedBoard holds a board of a document to the rules boards made
+// by /create follow, the document may be edited by hand
+func checkExportedBoard(board *Board) error {
+	if utf8.RuneCountInString(board.Title) > maxTitleLength {
+		return fmt.Errorf("has a title longer than %d characters", maxTitleLength)
+	}
+
+	if board.Layout.PerRow < 0 || board.Layout.PerRow > maxButtonsPerRow {
+		return fmt.Errorf("has a layout of %d per row, at most %d", board.Layout.PerRow, maxButtonsPerRow)
+	}
+
+	if len(board.States) > 0 {
+		labels := make([]string, 0, len(board.States))
+		for _, s := range board.States {
+			labels = append(labels, s.String())
+		}
+
+		states, err := parseStates(strings.Join(labels, " "))
+		if err != nil || len(states) != len(board.States) && states != nil {
+			return errors.New("has bad states")
+		}
+
+		board.States = states
+	}
+
+	ids := map[int]bool{}
+	names := map[string]bool{}
+
+	for _, resource := range board.Resources {
+		if resource == nil || resource.Name == "" {
+			return errors.New("has a resource without name")
+		}
+
+		if resource.ID <= 0 || ids[resource.ID] {
+			return fmt.Errorf("has a bad or repeated resource id %d", resource.ID)
+		}
+
+		if utf8.RuneCountInString(resource.Name) > maxNameLength || names[strings.ToLower(resource.Name)] {
+			return fmt.Errorf("has a too long or repeated resource %q", resource.Name)
+		}
+
+		// the name and the slots must read back the same from "name*N"
+		name, capacity := splitCapacity(resource.nameSpec())
+		if name != resource.Name || resource.Capacity < 0 || resource.Capacity > 1 && capacity != resource.Capacity {
+			return fmt.Errorf("has resource %q with bad capacity %d", resource.Name, resource.Capacity)
+		}
+
+		if err := checkHolders(resource); err != nil {
+			return err
+		}
+
+		ids[resource.ID] = true
+		names[strings.ToLower(resource.Name)] = true
+		board.LastID = max(board.LastID, resource.ID)
+	}
+
+	return nil
+}
+
+// checkHolders allows slots only on shared resources, one per user
+func checkHolders(resource *Resource) error {
+	if !resource.shared() && len(resource.Holders) > 0 || resource.shared() && resource.Holder != nil {
+		return fmt.Errorf("has resource %q with holders it can't have", resource.Name)
+	}
+
+	if len(resource.Holders) > max(resource.Capacity, 0) && resource.shared() {
+		return fmt.Errorf("has resource %q with more holders than slots", resource.Name)
+	}
+
+	seen := map[int64]bool{}
+
+	for _, holder := range resource.holders() {
+		if holder == nil || seen[holder.ID] {
+			return fmt.Errorf("has resource %q with a repeated holder", resource.Name)
+		}
+
+		seen[holder.ID] = true
+	}
+
+	return nil
+}
+
+// trustImport keeps of boards of a document uploaded to chat only what the
+// chat can vouch for: the importing user creates them, subscribers,
+// holders, lines and bookings are kept for members of the chat only
+func trustImport(ctx context.Context, b *bot.Bot, doc *boardsExport, chat models.Chat, actor models.User) {
+	members := map[int64]bool{}
+
+	member := func(userID int64) bool {
+		if known, ok := members[userID]; ok {
+			return known
+		}
+
+		// in a private chat only the user is there
+		known := userID == actor.ID
+		if !known && chat.Type != models.ChatTypePrivate {
+			m, err := b.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: chat.ID, UserID: userID})
+			known = err == nil && isMember(m)
+		}
+
+		members[userID] = known
+
+		return known
+	}
+
+	for _, board := range doc.Boards {
+		if board.ChatID != chat.ID {
+			board.ChatID = chat.ID
+			board.ChatTitle = ""
+		}
+
+		board.CreatedBy = actor.ID
+		board.Notify = slices.DeleteFunc(board.Notify, func(userID int64) bool { return !member(userID) })
+
+		for _, resource := range board.Resources {
+			if resource.Holder != nil && !member(resource.Holder.ID) {
+				resource.Holder = nil
+			}
+
+			resource.Holders = slices.DeleteFunc(resource.Holders, func(h *Holder) bool { return !member(h.ID) })
+			resource.Queue = slices.DeleteFunc(resource.Queue, func(w *Waiter) bool { return !member(w.ID) })
+			resource.Bookings = slices.DeleteFunc(resource.Bookings, func(booking *Booking) bool { return !member(booking.UserID) })
+		}
+	}
+}
+
+// isChatAdmin reports whether user administers the chat, in a private
+// chat everybody is on their own
+func isChatAdmin(ctx context.Context, b *bot.Bot, chat models.Chat, user models.User) (bool, error) {
+	if chat.Type == models.ChatTypePrivate {
+		return true, nil
+	}
+
+	member, err := b.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: chat.ID, UserID: user.ID})
+	if err != nil {
+		return false, err
+	}
+
+	return member.Type == models.ChatMemberTypeOwner || member.Type == models.ChatMemberTypeAdministrator, nil
+}
+
+// importBoards posts every board of doc as a new message keeping holders and
+// subscribers, into chatID or into the chat it was exported from if chatID is 0,
+// actor is who imported them
+func importBoards(ctx context.Context, b *bot.Bot, doc *boardsExport, chatID int64, actor models.User) (int, error) {
+	imported := 0
+
+	for _, exported := range doc.Boards {
+		board := exported.clone()
+		board.ID = ""
+		board.MessageID = 0
+		board.Version = 0
+
+		if chatID != 0 && chatID != board.ChatID {
+			board.ChatID = chatID
+			board.ChatTitle = ""
+			board.CreatedBy = 0
+		}
+
+		if _, err := postBoard(ctx, b, board, actor); err != nil {
+			return imported, err
+		}
+
+		imported++
+	}
+
+	return imported, nil
+}
+
+func handleExport(ctx context.Context, b *bot.Bot, message *models.Message) {
+	if stateless {
+		replyText(ctx, b, message, "boards are not stored in stateless mode, nothing to export")
+
+		return
+	}
+
+	list, err := boards.List(message.Chat.ID)
+	if err != nil {
+		log.Printf("error on list boards of %d: %s\n", message.Chat.ID, err)
+
+		return
+	}
+
+	if len(list) == 0 {
+		replyText(ctx, b, message, "there are no boards in this chat")
+
+		return
+	}
+
+	data, err := exportBoards(list)
+	if err != nil {
+		log.Printf("error on export boards %s\n", err)
+
+		return
+	}
+
+	_, err = b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID: message.Chat.ID,
+		Document: &models.InputFileUpload{
+			Filename: fmt.Sprintf("boards-%d.json", message.Chat.ID),
+			Data:     bytes.NewReader(data),
+		},
+		Caption: fmt.Sprintf("%d boards, reply /import to this document to recreate them", len(list)),
+	})
+	if err != nil {
+		log.Printf("error on send export %s\n", err)
+	}
+}
+
+func handleImport(ctx context.Context, b *bot.Bot, message *models.Message) {
+	if message.ReplyToMessage == nil || message.ReplyToMessage.Document == nil {
+		replyText(ctx, b, message, "reply /import to a document made by /export")
+
+		return
+	}
+
+	// boards of a document come with holders and subscribers of their own
+	allowed, err := isChatAdmin(ctx, b, message.Chat, sender(message))
+	if err != nil {
+		log.Printf("error on chat member %d of %d: %s\n", sender(message).ID, message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	if !allowed {
+		replyText(ctx, b, message, "only admins of the chat can import boards")
+
+		return
+	}
+
+	document := message.ReplyToMessage.Document
+	if document.FileSize > maxImportSize {
+		replyText(ctx, b, message, "the document is too large")
+
+		return
+	}
+
+	data, err := downloadFile(ctx, b, document.FileID)
+	if err != nil {
+		log.Printf("error on download %s: %s\n", document.FileID, err)
+
+		replyText(ctx, b, message, "failed to download the document")
+
+		return
+	}
+
+	doc, err := parseBoardsExport(data)
+	if err != nil {
+		replyText(ctx, b, message, err.Error())
+
+		return
+	}
+
+	trustImport(ctx, b, doc, message.Chat, sender(message))
+
+	imported, err := importBoards(ctx, b, doc, message.Chat.ID, sender(message))
+	if err != nil {
+		log.Printf("error on import boards %s\n", err)
+	}
+
+	replyText(ctx, b, message, fmt.Sprintf("imported %d of %d boards", imported, len(doc.Boards)))
+}
+
+func downloadFile(ctx context.Context, b *bot.Bot, fileID string) ([]byte, error) {
+	file, err := b.GetFile(ctx, &bot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.FileDownloadLink(file), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxImportSize))
+}
+
+// exportToFile writes all stored boards to path, for the export subcommand
+func exportToFile(path string) (int, error) {
+	list, err := boards.List(0)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := exportBoards(list)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(list), os.WriteFile(path, data, 0o644)
+}
+
+// importFromFile posts boards from path to the chats they were exported from,
+// for the import subcommand
+func importFromFile(ctx context.Context, b *bot.Bot, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	doc, err := parseBoardsExport(data)
+	if err != nil {
+		return err
+	}
+
+	imported, err := importBoards(ctx, b, doc, 0, models.User{})
+
+	log.Printf("imported %d of %d boards\n", imported, len(doc.Boards))
+
+	return err
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_parseBoardsExport(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		boards  int
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			data:   `{"version":1,"boards":[{"chat_id":1,"resources":[{"id":1,"name":"dev1","holder":{"id":2,"name":"user"}}],"notify":[2]}]}`,
+			boards: 1,
+		},
+		{
+			name:   "empty",
+			data:   `{"version":1,"boards":[]}`,
+			boards: 0,
+		},
+		{
+			name:    "not json",
+			data:    `dev1 dev2`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown version",
+			data:    `{"version":2,"boards":[]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no resources",
+			data:    `{"version":1,"boards":[{"chat_id":1}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "resource without name",
+			data:    `{"version":1,"boards":[{"chat_id":1,"resources":[{"id":1}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "repeated resource id",
+			data:    `{"version":1,"boards":[{"chat_id":1,"resources":[{"id":1,"name":"dev1"},{"id":1,"name":"dev2"}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "repeated name",
+			data:    `{"version":1,"boards":[{"chat_id":1,"resources":[{"id":1,"name":"dev1"},{"id":2,"name":"DEV1"}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "capacity out of range",
+			data:    `{"version":1,"boards":[{"chat_id":1,"resources":[{"id":1,"name":"pool","capacity":1000}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "name with capacity",
+			data:    `{"version":1,"boards":[{"chat_id":1,"resources":[{"id":1,"name":"pool*5"}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "more holders than slots",
+			data:    `{"version":1,"boards":[{"chat_id":1,"resources":[{"id":1,"name":"pool","capacity":2,"holders":[{"id":1},{"id":2},{"id":3}]}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "slots of an exclusive resource",
+			data:    `{"version":1,"boards":[{"chat_id":1,"resources":[{"id":1,"name":"dev1","holders":[{"id":1}]}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "layout out of range",
+			data:    `{"version":1,"boards":[{"chat_id":1,"resources":[{"id":1,"name":"dev1"}],"layout":{"per_row":50}}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseBoardsExport([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBoardsExport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				if !errors.Is(err, errBadExport) {
+					t.Errorf("parseBoardsExport() error = %v, want errBadExport", err)
+				}
+
+				return
+			}
+
+			if len(doc.Boards) != tt.boards {
+				t.Errorf("parseBoardsExport() boards = %d, want %d", len(doc.Boards), tt.boards)
+			}
+		})
+	}
+}
+
+func Test_exportImport(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	var messages []string
+
+	messageID := 200
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messageID++
+		messages = append(messages, formValue(body, "text"))
+
+		return map[string]any{
+			"ok":     true,
+			"result": map[string]any{"message_id": messageID, "chat": map[string]any{"id": json.RawMessage(formValue(body, "chat_id"))}},
+		}
+	}
+
+	var document []byte
+
+	s.hooks["/bottest_token/sendDocument"] = func(body []byte) any {
+		document = []byte(formValue(body, "document"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/getFile"] = func(body []byte) any {
+		return map[string]any{"ok": true, "result": map[string]any{"file_id": "doc", "file_path": "documents/boards.json"}}
+	}
+	s.hooks["/file/bottest_token/documents/boards.json"] = func(body []byte) any {
+		return json.RawMessage(document)
+	}
+
+	// 5 administers chat 20, 3 and 6 are members of it, 4 is not
+	statuses := map[string]string{"5": "administrator", "3": "member", "6": "member"}
+	s.hooks["/bottest_token/getChatMember"] = func(body []byte) any {
+		status, ok := statuses[formValue(body, "user_id")]
+		if !ok {
+			status = "left"
+		}
+
+		return map[string]any{"ok": true, "result": map[string]any{"status": status, "user": map[string]any{"id": 1}}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+
+	board := newBoard(10, []string{"dev1", "dev2"})
+	board.take(board.Resources[1], models.User{ID: 3, FirstName: "user"})
+	board.toggleNotify(3)
+	board.toggleNotify(4)
+	board.CreatedBy = 4
+
+	board, _ = boards.Create(board)
+	board.MessageID = 100
+
+	if err := boards.Save(board); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/export", Chat: models.Chat{ID: 10}}})
+
+	doc, err := parseBoardsExport(document)
+	if err != nil {
+		t.Fatalf("export is not parsed back: %s\n%s", err, document)
+	}
+
+	if len(doc.Boards) != 1 || doc.Boards[0].ID != board.ID {
+		t.Fatalf("exported boards = %#v", doc.Boards)
+	}
+
+	importBy := func(user *models.User) {
+		handler(ctx, b, &models.Update{
+			Message: &models.Message{
+				Text: "/import",
+				Chat: models.Chat{ID: 20, Type: models.ChatTypeSupergroup},
+				From: user,
+				ReplyToMessage: &models.Message{
+					Chat:     models.Chat{ID: 20},
+					Document: &models.Document{FileID: "doc", FileSize: int64(len(document))},
+				},
+			},
+		})
+	}
+
+	messages = nil
+
+	importBy(&models.User{ID: 6, FirstName: "member"})
+
+	if imported, _ := boards.List(20); len(imported) != 0 || fmt.Sprint(messages) != "[only admins of the chat can import boards]" {
+		t.Fatalf("import by a member = %d boards, %q", len(imported), messages)
+	}
+
+	importBy(&models.User{ID: 5, FirstName: "admin"})
+
+	imported, _ := boards.List(20)
+	if len(imported) != 1 {
+		t.Fatalf("imported boards = %d, want 1", len(imported))
+	}
+
+	got := imported[0]
+	if got.ID == board.ID || got.MessageID == board.MessageID {
+		t.Errorf("imported board reuses ids of the original: %#v", got)
+	}
+
+	// the holder is a member of the chat and stays, the subscriber from
+	// outside of it is dropped, the board is of the importing admin
+	if got.text() != board.text() || fmt.Sprint(got.Notify) != "[3]" || got.CreatedBy != 5 {
+		t.Errorf("imported board = %q %v by %d, want %q [3] by 5", got.text(), got.Notify, got.CreatedBy, board.text())
+	}
+
+	if !got.CreatedAt.Equal(board.CreatedAt) {
+		t.Errorf("imported created_at = %s, want %s", got.CreatedAt, board.CreatedAt)
+	}
+
+	if _, err := boards.GetByMessage(10, 100); err != nil {
+		t.Errorf("original board is gone")
+	}
+}
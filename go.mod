@@ -4,9 +4,8 @@ go 1.25.0
 
 require (
 	github.com/go-telegram/bot v1.22.0
-	github.com/tdewolff/minify/v2 v2.24.13
 	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f
 	golang.org/x/text v0.40.0
 )
 
-require github.com/tdewolff/parse/v2 v2.8.12 // indirect
+require github.com/lib/pq v1.10.9
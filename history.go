@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+// event types
+const (
+	eventCreate      = "create"
+	eventPost        = "post"
+	eventEdit        = "edit"
+	eventAdd         = "add"
+	eventRemove      = "remove"
+	eventRename      = "rename"
+	eventTitle       = "title"
+	eventTake        = "take"
+	eventRelease     = "release"
+	eventSubscribe   = "subscribe"
+	eventUnsubscribe = "unsubscribe"
+	eventDelete      = "delete"
+	eventClose       = "close"
+	eventHold        = "hold"
+	eventState       = "state"
+)
+
+// resource and subscription states in Old and New of events
+const (
+	stateFree = "free"
+	stateBusy = "busy"
+	stateOn   = "on"
+	stateOff  = "off"
+)
+
+// /history shows this many latest events
+const historyLimit = 20
+
+// Event is one change of a board in its append-only history. Create and edit
+// events carry the whole board after the change, the rest carry a delta, so
+// replaying the history of a board in order rebuilds its state.
+type Event struct {
+	Seq        int64     `json:"seq"`
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	BoardID    string    `json:"board_id"`
+	Version    int64     `json:"version,omitempty"`
+	ResourceID int       `json:"resource_id,omitempty"`
+	Resource   string    `json:"resource,omitempty"`
+	ActorID    int64     `json:"actor_id,omitempty"`
+	ActorName  string    `json:"actor_name,omitempty"`
+	Old        string    `json:"old,omitempty"`
+	New        string    `json:"new,omitempty"`
+	Holder     *Holder   `json:"holder,omitempty"`
+	Board      *Board    `json:"board,omitempty"`
+}
+
+func (e Event) clone() Event {
+	e.Board = e.Board.clone()
+
+	if e.Holder != nil {
+		h := *e.Holder
+		e.Holder = &h
+	}
+
+	return e
+}
+
+// stampEvents fills what only the storage knows: sequence numbers from seq on,
+// board ID for events of a board just created and the version after the change
+func stampEvents(events []Event, boardID string, version int64, seq int64) []Event {
+	stamped := make([]Event, 0, len(events))
+
+	for i, e := range events {
+		e = e.clone()
+		e.Seq = seq + int64(i)
+		e.Version = version
+
+		if e.BoardID == "" {
+			e.BoardID = boardID
+		}
+
+		if e.Board != nil {
+			e.Board.ID = boardID
+			e.Board.Version = version
+		}
+
+		stamped = append(stamped, e)
+	}
+
+	return stamped
+}
+
+// boardEvents describes the change from before to after made by actor,
+// before is nil for a new board
+func boardEvents(before, after *Board, actor models.User) []Event {
+	now := time.Now()
+
+	event := func(kind string, resource *Resource) Event {
+		e := Event{
+			Time:      now,
+			Type:      kind,
+			BoardID:   after.ID,
+			ActorID:   actor.ID,
+			ActorName: fullName(actor),
+		}
+
+		if resource != nil {
+			e.ResourceID = resource.ID
+			e.Resource = resource.Name
+		}
+
+		return e
+	}
+
+	if before == nil {
+		e := event(eventCreate, nil)
+		e.Board = after
+
+		return []Event{e}
+	}
+
+	events := []Event{}
+
+	if before.MessageID != after.MessageID {
+		e := event(eventPost, nil)
+		e.Old = strconv.Itoa(before.MessageID)
+		e.New = strconv.Itoa(after.MessageID)
+		events = append(events, e)
+	}
+
+	if before.Title != after.Title {
+		e := event(eventTitle, nil)
+		e.Old = before.Title
+		e.New = after.Title
+		events = append(events, e)
+	}
+
+	for _, resource := range before.Resources {
+		if after.resource(resource.ID) == nil {
+			e := event(eventRemove, resource)
+			e.Old = resource.Name
+			events = append(events, e)
+		}
+	}
+
+	for _, resource := range after.Resources {
+		old := before.resource(resource.ID)
+		if old == nil {
+			e := event(eventAdd, resource)
+			e.New = resource.Name
+			events = append(events, e)
+
+			continue
+		}
+
+		if old.Name != resource.Name {
+			e := event(eventRename, resource)
+			e.Old = old.Name
+			e.New = resource.Name
+			events = append(events, e)
+		}
+
+		if old.Holder != nil && !sameHolder(old.Holder, resource.Holder) {
+			e := event(eventRelease, resource)
+			e.Old = before.stateLabel(old)
+			e.New = after.states()[0].Label
+			e.Holder = old.Holder
+			events = append(events, e)
+		}
+
+		if resource.Holder != nil && !sameHolder(old.Holder, resource.Holder) {
+			e := event(eventTake, resource)
+			e.Old = after.states()[0].Label
+			e.New = after.stateLabel(resource)
+			e.Holder = resource.Holder
+			events = append(events, e)
+		}
+
+		if old.Holder != nil && sameHolder(old.Holder, resource.Holder) && before.stateOf(old) != after.stateOf(resource) {
+			e := event(eventState, resource)
+			e.Old = before.stateLabel(old)
+			e.New = after.stateLabel(resource)
+			e.Holder = resource.Holder
+			events = append(events, e)
+		}
+
+		if old.Holder != nil && sameHolder(old.Holder, resource.Holder) && !old.Holder.Until.Equal(resource.Holder.Until) && before.stateOf(old) == after.stateOf(resource) {
+			e := event(eventHold, resource)
+			e.Old = untilState(old.Holder)
+			e.New = untilState(resource.Holder)
+			e.Holder = resource.Holder
+			events = append(events, e)
+		}
+
+		// slots of shared resources are taken and released one by one
+		for _, holder := range old.Holders {
+			if resource.holderOf(holder.ID) == nil {
+				e := event(eventRelease, resource)
+				e.Old = stateBusy
+				e.New = stateFree
+				e.Holder = holder
+				events = append(events, e)
+			}
+		}
+
+		for _, holder := range resource.Holders {
+			if old.holderOf(holder.ID) == nil {
+				e := event(eventTake, resource)
+				e.Old = stateFree
+				e.New = stateBusy
+				e.Holder = holder
+				events = append(events, e)
+			}
+		}
+	}
+
+	// anything else but holders and subscribers is saved as a whole
+	if !bytes.Equal(boardShape(before), boardShape(after)) {
+		e := event(eventEdit, nil)
+		e.Board = after
+		events = append(events, e)
+	}
+
+	for _, userID := range after.Notify {
+		if !slices.Contains(before.Notify, userID) {
+			e := event(eventSubscribe, nil)
+			e.Old = stateOff
+			e.New = stateOn
+			e.ActorID = userID
+
+			if userID != actor.ID {
+				e.ActorName = ""
+			}
+
+			events = append(events, e)
+		}
+	}
+
+	for _, userID := range before.Notify {
+		if !slices.Contains(after.Notify, userID) {
+			e := event(eventUnsubscribe, nil)
+			e.Old = stateOn
+			e.New = stateOff
+			e.ActorID = userID
+
+			if userID != actor.ID {
+				e.ActorName = ""
+			}
+
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+// deleteEvent is the event of actor deleting the board
+func deleteEvent(boardID string, actor models.User) Event {
+	return Event{
+		Time:      time.Now(),
+		Type:      eventDelete,
+		BoardID:   boardID,
+		ActorID:   actor.ID,
+		ActorName: fullName(actor),
+	}
+}
+
+// closeEvent is the event of actor closing the board, the message is kept
+// with the final state and the board is forgotten as if deleted
+func closeEvent(boardID string, actor models.User) Event {
+	e := deleteEvent(boardID, actor)
+	e.Type = eventClose
+
+	return e
+}
+
+// untilState is the end of a hold in Old and New of events, empty for no limit
+func untilState(holder *Holder) string {
+	if holder.Until.IsZero() {
+		return ""
+	}
+
+	return holder.Until.UTC().Format(time.RFC3339)
+}
+
+func sameHolder(a, b *Holder) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.ID == b.ID && a.Name == b.Name
+}
+
+// boardShape is the board without the state events carry as deltas
+// and without queues and bookings, they are kept out of the history
+func boardShape(board *Board) []byte {
+	shape := board.clone()
+	shape.MessageID = 0
+	shape.Title = ""
+	shape.Notify = nil
+	shape.Version = 0
+	shape.UpdatedAt = time.Time{}
+
+	for _, resource := range shape.Resources {
+		resource.Holder = nil
+		resource.Holders = nil
+		resource.Queue = nil
+		resource.Bookings = nil
+	}
+
+	data, _ := json.Marshal(shape)
+
+	return data
+}
+
+// replaySlot applies a take or release of a slot of the shared resource
+func replaySlot(resource *Resource, e Event) {
+	if e.Holder == nil {
+		return
+	}
+
+	resource.Holders = slices.DeleteFunc(resource.Holders, func(h *Holder) bool { return h.ID == e.Holder.ID })
+
+	if e.Type == eventTake {
+		h := *e.Holder
+		resource.Holders = append(resource.Holders, &h)
+	}
+}
+
+// replayEvents rebuilds boards from their history, deleted boards are left out
+func replayEvents(events []Event) map[string]*Board {
+	boards := map[string]*Board{}
+
+	for _, e := range events {
+		if e.Type == eventCreate || e.Type == eventEdit {
+			if e.Board != nil {
+				boards[e.BoardID] = e.Board.clone()
+			}
+
+			continue
+		}
+
+		if e.Type == eventDelete || e.Type == eventClose {
+			delete(boards, e.BoardID)
+
+			continue
+		}
+
+		board, ok := boards[e.BoardID]
+		if !ok {
+			continue
+		}
+
+		if e.Version > board.Version {
+			board.Version = e.Version
+		}
+
+		if !e.Time.IsZero() {
+			board.UpdatedAt = e.Time
+		}
+
+		switch e.Type {
+		case eventPost:
+			board.MessageID, _ = strconv.Atoi(e.New)
+		case eventTitle:
+			board.Title = e.New
+		case eventTake, eventRelease, eventHold, eventState:
+			resource := board.resource(e.ResourceID)
+			if resource == nil {
+				continue
+			}
+
+			if resource.shared() {
+				replaySlot(resource, e)
+
+				continue
+			}
+
+			resource.Holder = nil
+
+			if e.Type != eventRelease && e.Holder != nil {
+				h := *e.Holder
+				resource.Holder = &h
+			}
+		case eventSubscribe:
+			if !slices.Contains(board.Notify, e.ActorID) {
+				board.Notify = append(board.Notify, e.ActorID)
+			}
+		case eventUnsubscribe:
+			if i := slices.Index(board.Notify, e.ActorID); i >= 0 {
+				board.Notify = slices.Delete(board.Notify, i, i+1)
+			}
+		}
+	}
+
+	return boards
+}
+
+func (e Event) text() string {
+	actor := e.ActorName
+	if actor == "" {
+		actor = strconv.FormatInt(e.ActorID, 10)
+	}
+
+	switch e.Type {
+	case eventCreate:
+		return fmt.Sprintf("board created by %s", actor)
+	case eventPost:
+		return "board posted"
+	case eventEdit:
+		return fmt.Sprintf("board edited by %s", actor)
+	case eventAdd:
+		return fmt.Sprintf("%s added by %s", e.New, actor)
+	case eventRemove:
+		return fmt.Sprintf("%s removed by %s", e.Old, actor)
+	case eventRename:
+		return fmt.Sprintf("%s renamed to %s by %s", e.Old, e.New, actor)
+	case eventTitle:
+		if e.New == "" {
+			return fmt.Sprintf("title removed by %s", actor)
+		}
+
+		return fmt.Sprintf("title set to %q by %s", e.New, actor)
+	case eventTake:
+		if e.Holder != nil && e.Holder.Name != "" {
+			actor = e.Holder.Name
+		}
+
+		// takes straight into a custom state
+		if e.New != "" && e.New != stateBusy {
+			return fmt.Sprintf("%s marked %s by %s", e.Resource, e.New, actor)
+		}
+
+		if e.Holder != nil && e.Holder.Note != "" {
+			return fmt.Sprintf("%s taken by %s: %s", e.Resource, actor, e.Holder.Note)
+		}
+
+		return fmt.Sprintf("%s taken by %s", e.Resource, actor)
+	case eventRelease:
+		return fmt.Sprintf("%s released by %s", e.Resource, actor)
+	case eventHold:
+		if e.Holder == nil || e.Holder.Until.IsZero() {
+			return fmt.Sprintf("%s held with no time limit by %s", e.Resource, actor)
+		}
+
+		return fmt.Sprintf("%s held until %s by %s", e.Resource, e.Holder.untilText(), actor)
+	case eventState:
+		return fmt.Sprintf("%s marked %s by %s", e.Resource, e.New, actor)
+	case eventSubscribe:
+		return fmt.Sprintf("%s enabled notifications", actor)
+	case eventUnsubscribe:
+		return fmt.Sprintf("%s disabled notifications", actor)
+	case eventDelete:
+		return fmt.Sprintf("board deleted by %s", actor)
+	case eventClose:
+		return fmt.Sprintf("board closed by %s", actor)
+	}
+
+	return e.Type
+}
+
+// handleHistory answers /history [name] sent as a reply to a board
+// with the latest events of the board or of one of its resources
+func handleHistory(ctx context.Context, b *bot.Bot, message *models.Message) {
+	board, ok := repliedBoard(message)
+	if !ok {
+		replyText(ctx, b, message, "reply /history to a board message")
+
+		return
+	}
+
+	resourceID := 0
+
+	if name := commandArgs(message.Text); name != "" {
+		resource := board.resourceByName(name)
+		if resource == nil {
+			replyText(ctx, b, message, fmt.Sprintf("there is no %s on this board", name))
+
+			return
+		}
+
+		resourceID = resource.ID
+	}
+
+	events, err := boards.Events(board.ID, resourceID)
+	if err != nil {
+		log.Printf("error on history of %s: %s\n", board.ID, err)
+
+		return
+	}
+
+	if len(events) == 0 {
+		replyText(ctx, b, message, "no history yet")
+
+		return
+	}
+
+	if len(events) > historyLimit {
+		events = events[len(events)-historyLimit:]
+	}
+
+	lines := make([]string, 0, len(events))
+	for _, e := range events {
+		lines = append(lines, e.Time.Format("2006-01-02 15:04")+" "+e.text())
+	}
+
+	replyText(ctx, b, message, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_boardEvents(t *testing.T) {
+	user := models.User{ID: 3, FirstName: "user"}
+	other := models.User{ID: 4, FirstName: "other"}
+
+	tests := []struct {
+		name   string
+		change func(board *Board)
+		want   string
+	}{
+		{
+			name:   "nothing",
+			change: func(board *Board) {},
+			want:   "[]",
+		},
+		{
+			name:   "take",
+			change: func(board *Board) { board.take(board.Resources[0], user) },
+			want:   "[take:dev1:free>busy]",
+		},
+		{
+			name:   "release",
+			change: func(board *Board) { board.release(board.Resources[1]) },
+			want:   "[release:dev2:busy>free]",
+		},
+		{
+			name: "holder changed",
+			change: func(board *Board) {
+				board.release(board.Resources[1])
+				board.take(board.Resources[1], user)
+			},
+			want: "[release:dev2:busy>free take:dev2:free>busy]",
+		},
+		{
+			name:   "subscribe",
+			change: func(board *Board) { board.toggleNotify(user.ID) },
+			want:   "[subscribe::off>on]",
+		},
+		{
+			name:   "unsubscribe",
+			change: func(board *Board) { board.toggleNotify(other.ID) },
+			want:   "[unsubscribe::on>off]",
+		},
+		{
+			name:   "post",
+			change: func(board *Board) { board.MessageID = 8 },
+			want:   "[post::7>8]",
+		},
+		{
+			name:   "title",
+			change: func(board *Board) { board.setTitle("servers") },
+			want:   "[title::>servers]",
+		},
+		{
+			name: "add, remove and rename",
+			change: func(board *Board) {
+				board.Resources[0].Name = "dev0"
+				board.Resources = board.Resources[:1]
+				board.addResource("dev3")
+			},
+			want: "[remove:dev2:dev2> rename:dev0:dev1>dev0 add:dev3:>dev3 edit::>]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := newBoard(1, []string{"dev1", "dev2"})
+			before.ID = "b"
+			before.MessageID = 7
+			before.take(before.Resources[1], other)
+			before.toggleNotify(other.ID)
+
+			after := before.clone()
+			tt.change(after)
+
+			got := []string{}
+			for _, e := range boardEvents(before, after, user) {
+				got = append(got, fmt.Sprintf("%s:%s:%s>%s", e.Type, e.Resource, e.Old, e.New))
+
+				if e.BoardID != "b" {
+					t.Errorf("event of board %q", e.BoardID)
+				}
+			}
+
+			if fmt.Sprint(got) != tt.want {
+				t.Errorf("boardEvents() = %v, want %v", got, tt.want)
+			}
+
+			// replaying the change over the old board gives the new one
+			history := append(stampEvents(boardEvents(nil, before, user), "b", 1, 1), stampEvents(boardEvents(before, after, user), "b", 2, 2)...)
+
+			replayed := replayEvents(history)["b"]
+			if replayed.text() != after.text() || fmt.Sprint(replayed.Notify) != fmt.Sprint(after.Notify) || replayed.MessageID != after.MessageID {
+				t.Errorf("replayed = %q %v %d, want %q %v %d", replayed.text(), replayed.Notify, replayed.MessageID, after.text(), after.Notify, after.MessageID)
+			}
+		})
+	}
+}
+
+func Test_handleHistory(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	replies := []string{}
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		replies = append(replies, formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 300, "chat": map[string]any{"id": 30}}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	user := &models.User{ID: 3, FirstName: "Creator"}
+
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/create dev1 dev2", Chat: models.Chat{ID: 30}, From: user}})
+
+	board, err := boards.GetByMessage(30, 300)
+	if err != nil {
+		t.Fatalf("board was not stored")
+	}
+
+	for _, button := range []models.InlineKeyboardButton{board.keyboard().InlineKeyboard[0][1], board.keyboard().InlineKeyboard[1][0]} {
+		handler(ctx, b, &models.Update{
+			CallbackQuery: &models.CallbackQuery{
+				Data: button.CallbackData,
+				From: models.User{ID: 4, FirstName: "Presser"},
+				Message: models.MaybeInaccessibleMessage{
+					Type:    models.MaybeInaccessibleMessageTypeMessage,
+					Message: &models.Message{ID: 300, Chat: models.Chat{ID: 30}},
+				},
+			},
+		})
+	}
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "/history", want: []string{"board created by Creator", "board posted", "dev2 taken by Presser", "Presser enabled notifications"}},
+		{text: "/history dev2", want: []string{"dev2 taken by Presser"}},
+		{text: "/history dev1", want: []string{"no history yet"}},
+		{text: "/history prod", want: []string{"there is no prod on this board"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			replies = replies[:0]
+
+			handler(ctx, b, &models.Update{
+				Message: &models.Message{
+					Text:           tt.text,
+					Chat:           models.Chat{ID: 30},
+					ReplyToMessage: &models.Message{ID: 300, Chat: models.Chat{ID: 30}},
+				},
+			})
+
+			if len(replies) != 1 {
+				t.Fatalf("replies = %v", replies)
+			}
+
+			lines := strings.Split(replies[0], "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("history = %q, want %v", replies[0], tt.want)
+			}
+
+			for i, line := range lines {
+				if !strings.HasSuffix(line, tt.want[i]) {
+					t.Errorf("line %d = %q, want %q", i, line, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	journalFileName  = "boards.journal"
+	snapshotFileName = "boards.snapshot"
+
+	// journal is folded into a new snapshot after this many records
+	compactEvery = 1000
+)
+
+const (
+	opPut      = "put"
+	opDelete   = "del"
+	opSeq      = "seq"
+	opEvents   = "events"
+	opSettings = "settings"
+)
+
+// history is written into the snapshot in records of this many events
+const eventsPerRecord = 100
+
+var errCorrupted = errors.New("corrupted record")
+
+// journalRecord is one line of the journal or snapshot file,
+// put and del records carry the whole board so replay is idempotent,
+// any record may carry events appended to history with the change
+type journalRecord struct {
+	Op     string  `json:"op"`
+	LastID uint64  `json:"last_id,omitempty"`
+	ID     string  `json:"id,omitempty"`
+	Board  *Board  `json:"board,omitempty"`
+	Events []Event `json:"events,omitempty"`
+	// Settings of a chat for settings records
+	Settings *ChatSettings `json:"settings,omitempty"`
+}
+
+// journal is an append-only file of records, every append is fsynced before
+// the change becomes visible. Each line is "<crc32> <json>\n", so a torn write
+// after power loss is detected and dropped at startup.
+type journal struct {
+	dir     string
+	file    *os.File
+	records int
+}
+
+// openJournal replays snapshot and journal from dir into apply
+// and opens the journal for appending
+func openJournal(dir string, apply func(journalRecord)) (*journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	j := &journal{dir: dir}
+
+	for _, name := range []string{snapshotFileName, journalFileName} {
+		records, size, err := readRecords(j.path(name))
+		for _, rec := range records {
+			apply(rec)
+		}
+
+		if name == journalFileName {
+			j.records = len(records)
+		}
+
+		switch {
+		case errors.Is(err, errCorrupted):
+			aside := fmt.Sprintf("%s.corrupt-%d", j.path(name), time.Now().Unix())
+			log.Printf("error: %s is corrupted after %d records (%s), moved to %s\n", name, len(records), err, aside)
+
+			if err := os.Rename(j.path(name), aside); err != nil {
+				return nil, err
+			}
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			log.Printf("%s has a torn tail after %d records, truncating\n", name, len(records))
+
+			if err := os.Truncate(j.path(name), size); err != nil {
+				return nil, err
+			}
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(j.path(journalFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	j.file = file
+
+	return j, nil
+}
+
+// replayJournal applies valid records of snapshot and journal in dir
+// and changes nothing on disk, records after damage are skipped
+func replayJournal(dir string, apply func(journalRecord)) error {
+	for _, name := range []string{snapshotFileName, journalFileName} {
+		records, _, err := readRecords(filepath.Join(dir, name))
+		for _, rec := range records {
+			apply(rec)
+		}
+
+		switch {
+		case errors.Is(err, errCorrupted) || errors.Is(err, io.ErrUnexpectedEOF):
+			log.Printf("%s is damaged after %d records (%s), read up to it\n", name, len(records), err)
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (j *journal) path(name string) string {
+	return filepath.Join(j.dir, name)
+}
+
+// append writes record to the journal and waits for it to reach the disk
+func (j *journal) append(rec journalRecord) error {
+	line, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.file.Write(line); err != nil {
+		return err
+	}
+
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+
+	j.records++
+
+	return nil
+}
+
+// compact atomically replaces the snapshot with records and empties the journal
+func (j *journal) compact(records []journalRecord) error {
+	tmp := j.path(snapshotFileName + ".tmp")
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+
+	for _, rec := range records {
+		line, err := encodeRecord(rec)
+		if err != nil {
+			_ = file.Close()
+
+			return err
+		}
+
+		if _, err := w.Write(line); err != nil {
+			_ = file.Close()
+
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, j.path(snapshotFileName)); err != nil {
+		return err
+	}
+
+	if err := syncDir(j.dir); err != nil {
+		return err
+	}
+
+	// a crash before this point only leaves journal records which are
+	// already in the snapshot, boards are put again as they were and
+	// events already loaded are skipped by their Seq
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+
+	j.records = 0
+
+	return nil
+}
+
+func (j *journal) Close() error {
+	return j.file.Close()
+}
+
+func encodeRecord(rec journalRecord) ([]byte, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return fmt.Appendf(nil, "%08x %s\n", crc32.ChecksumIEEE(data), data), nil
+}
+
+func decodeRecord(line []byte) (journalRecord, error) {
+	rec := journalRecord{}
+
+	if len(line) < 10 || line[8] != ' ' {
+		return rec, errCorrupted
+	}
+
+	sum, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil {
+		return rec, errCorrupted
+	}
+
+	data := line[9:]
+	if crc32.ChecksumIEEE(data) != uint32(sum) {
+		return rec, errCorrupted
+	}
+
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, errCorrupted
+	}
+
+	return rec, nil
+}
+
+// readRecords returns valid records of the file and the size of the valid part.
+// A damaged last line is reported as io.ErrUnexpectedEOF, damage anywhere
+// else as errCorrupted.
+func readRecords(path string) ([]journalRecord, int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	records := []journalRecord{}
+	size := int64(0)
+
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			return records, size, io.ErrUnexpectedEOF
+		}
+
+		rec, err := decodeRecord(data[:end])
+		if err != nil {
+			if end == len(data)-1 {
+				return records, size, io.ErrUnexpectedEOF
+			}
+
+			return records, size, fmt.Errorf("%w at offset %d", errCorrupted, size)
+		}
+
+		records = append(records, rec)
+		size += int64(end + 1)
+		data = data[end+1:]
+	}
+
+	return records, size, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+
+	return d.Sync()
+}
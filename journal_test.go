@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func writeJournal(t *testing.T, dir string, records ...journalRecord) string {
+	t.Helper()
+
+	data := []byte{}
+	for _, rec := range records {
+		line, err := encodeRecord(rec)
+		if err != nil {
+			t.Fatalf("encodeRecord() error %s", err)
+		}
+
+		data = append(data, line...)
+	}
+
+	path := filepath.Join(dir, journalFileName)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile() error %s", err)
+	}
+
+	return path
+}
+
+func Test_readRecords(t *testing.T) {
+	records := []journalRecord{
+		{Op: opPut, LastID: 1, Board: &Board{ID: "1"}},
+		{Op: opPut, LastID: 2, Board: &Board{ID: "2"}},
+		{Op: opDelete, ID: "1"},
+	}
+
+	tests := []struct {
+		name    string
+		damage  func(data []byte) []byte
+		records int
+		err     error
+	}{
+		{
+			name:    "clean",
+			damage:  func(data []byte) []byte { return data },
+			records: 3,
+		},
+		{
+			name:    "torn write",
+			damage:  func(data []byte) []byte { return data[:len(data)-5] },
+			records: 2,
+			err:     io.ErrUnexpectedEOF,
+		},
+		{
+			name: "torn checksum of last record",
+			damage: func(data []byte) []byte {
+				i := strings.LastIndex(string(data[:len(data)-1]), "\n") + 1
+				data[i] = 'x'
+
+				return data
+			},
+			records: 2,
+			err:     io.ErrUnexpectedEOF,
+		},
+		{
+			name: "flipped byte in the middle",
+			damage: func(data []byte) []byte {
+				i := strings.Index(string(data), `"2"`)
+				data[i+1] = '3'
+
+				return data
+			},
+			records: 1,
+			err:     errCorrupted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeJournal(t, t.TempDir(), records...)
+
+			data, _ := os.ReadFile(path)
+			if err := os.WriteFile(path, tt.damage(data), 0o644); err != nil {
+				t.Fatalf("WriteFile() error %s", err)
+			}
+
+			got, _, err := readRecords(path)
+			if len(got) != tt.records || !errors.Is(err, tt.err) {
+				t.Errorf("readRecords() = %d records, %v, want %d, %v", len(got), err, tt.records, tt.err)
+			}
+		})
+	}
+}
+
+func Test_openJournal_recovery(t *testing.T) {
+	dir := t.TempDir()
+	path := writeJournal(t, dir,
+		journalRecord{Op: opPut, LastID: 1, Board: &Board{ID: "1", ChatID: 1, MessageID: 1}},
+		journalRecord{Op: opPut, LastID: 2, Board: &Board{ID: "2", ChatID: 1, MessageID: 2}},
+	)
+
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, append(data, []byte(`0badc0de {"op":"put","last_id":3,"bo`)...), 0o644); err != nil {
+		t.Fatalf("WriteFile() error %s", err)
+	}
+
+	s, err := openBoardStore(dir)
+	if err != nil {
+		t.Fatalf("openBoardStore() error %s", err)
+	}
+	defer s.Close()
+
+	if len(s.boards) != 2 || s.lastID != 2 {
+		t.Errorf("boards = %d, lastID = %d, want 2, 2", len(s.boards), s.lastID)
+	}
+
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("journal was not compacted at startup, size %d", info.Size())
+	}
+}
+
+func Test_openJournal_corrupted(t *testing.T) {
+	dir := t.TempDir()
+	path := writeJournal(t, dir,
+		journalRecord{Op: opPut, LastID: 1, Board: &Board{ID: "1"}},
+		journalRecord{Op: opPut, LastID: 2, Board: &Board{ID: "2"}},
+		journalRecord{Op: opPut, LastID: 3, Board: &Board{ID: "3"}},
+	)
+
+	data, _ := os.ReadFile(path)
+	data[strings.Index(string(data), `"2"`)+1] = '7'
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile() error %s", err)
+	}
+
+	s, err := openBoardStore(dir)
+	if err != nil {
+		t.Fatalf("openBoardStore() error %s", err)
+	}
+	defer s.Close()
+
+	if _, err := s.Get("1"); err != nil || len(s.boards) != 1 {
+		t.Errorf("boards = %d, want only the record before damage", len(s.boards))
+	}
+
+	aside, _ := filepath.Glob(filepath.Join(dir, journalFileName+".corrupt-*"))
+	if len(aside) != 1 {
+		t.Errorf("damaged journal was not kept aside, found %v", aside)
+	}
+}
+
+func Test_journal_compact(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := openBoardStore(dir)
+	if err != nil {
+		t.Fatalf("openBoardStore() error %s", err)
+	}
+
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+	for i := 0; i < compactEvery+1; i++ {
+		_, err := updateBoard(s, board.ID, models.User{ID: 1}, func(board *Board) error {
+			board.toggleNotify(1)
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("updateBoard() error %s", err)
+		}
+	}
+
+	if s.journal.records > compactEvery {
+		t.Errorf("journal has %d records, want compaction", s.journal.records)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error %s", err)
+	}
+
+	// sequence, board and history in chunks
+	records, _, err := readRecords(filepath.Join(dir, snapshotFileName))
+	if want := 2 + (compactEvery+1+eventsPerRecord-1)/eventsPerRecord; err != nil || len(records) != want {
+		t.Errorf("snapshot = %d records, %v, want %d", len(records), err, want)
+	}
+
+	s, err = openBoardStore(dir)
+	if err != nil {
+		t.Fatalf("openBoardStore() error %s", err)
+	}
+	defer s.Close()
+
+	if events, _ := s.Events(board.ID, 0); len(events) != compactEvery+1 || events[len(events)-1].Seq != compactEvery+1 {
+		t.Errorf("history after compaction = %d events", len(events))
+	}
+}
+
+func Test_journal_compact_interrupted(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := openBoardStore(dir)
+	if err != nil {
+		t.Fatalf("openBoardStore() error %s", err)
+	}
+
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+
+	// subscribed and unsubscribed, two events
+	for i := 0; i < 2; i++ {
+		if _, err := updateBoard(s, board.ID, models.User{ID: 1}, func(board *Board) error {
+			board.toggleNotify(1)
+
+			return nil
+		}); err != nil {
+			t.Fatalf("updateBoard() error %s", err)
+		}
+	}
+
+	journal, _ := os.ReadFile(filepath.Join(dir, journalFileName))
+
+	s.mu.Lock()
+	err = s.compact()
+	s.mu.Unlock()
+
+	if err != nil {
+		t.Fatalf("compact() error %s", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error %s", err)
+	}
+
+	// a crash after the snapshot was renamed but before the journal was emptied
+	if err := os.WriteFile(filepath.Join(dir, journalFileName), journal, 0o644); err != nil {
+		t.Fatalf("WriteFile() error %s", err)
+	}
+
+	s, err = openBoardStore(dir)
+	if err != nil {
+		t.Fatalf("openBoardStore() error %s", err)
+	}
+	defer s.Close()
+
+	if events, _ := s.Events(board.ID, 0); len(events) != 2 {
+		t.Errorf("events after an interrupted compaction = %d, want 2", len(events))
+	}
+}
+
+func Test_readBoardStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := openBoardStore(dir)
+	if err != nil {
+		t.Fatalf("openBoardStore() error %s", err)
+	}
+	defer s.Close()
+
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+
+	snapshot, _ := os.ReadFile(filepath.Join(dir, snapshotFileName))
+	journal, _ := os.ReadFile(filepath.Join(dir, journalFileName))
+
+	// the bot keeps the journal open while export reads it
+	r, err := readBoardStore(dir)
+	if err != nil {
+		t.Fatalf("readBoardStore() error %s", err)
+	}
+
+	if got, err := r.Get(board.ID); err != nil || got.text() != board.text() {
+		t.Errorf("Get() = %v, %v", got, err)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error %s", err)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dir, snapshotFileName)); string(got) != string(snapshot) {
+		t.Errorf("snapshot was rewritten")
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dir, journalFileName)); string(got) != string(journal) || len(journal) == 0 {
+		t.Errorf("journal was rewritten, %d bytes", len(journal))
+	}
+}
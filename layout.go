@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// auto layout keeps rows within this many characters,
+// every button of a row is as wide as the widest one
+const autoRowWidth = 32
+
+// Telegram shows at most this many buttons in a row
+const maxButtonsPerRow = 8
+
+// Layout tells how resource buttons are wrapped into rows,
+// the zero Layout keeps every explicit row in one line
+type Layout struct {
+	// Auto wraps rows by width of button labels
+	Auto bool `json:"auto,omitempty"`
+	// PerRow limits buttons in a row, 0 is no limit
+	PerRow int `json:"per_row,omitempty"`
+}
+
+// ChatSettings are the defaults a chat picked for its new boards,
+// its saved templates and the summary message of its boards
+type ChatSettings struct {
+	ChatID          int64      `json:"chat_id"`
+	Layout          Layout     `json:"layout,omitzero"`
+	Templates       []Template `json:"templates,omitempty"`
+	StatusMessageID int        `json:"status_message_id,omitempty"`
+}
+
+func (layout Layout) String() string {
+	switch {
+	case layout.Auto && layout.PerRow > 0:
+		return fmt.Sprintf("auto, at most %d per row", layout.PerRow)
+	case layout.Auto:
+		return "auto"
+	case layout.PerRow > 0:
+		return fmt.Sprintf("%d per row", layout.PerRow)
+	}
+
+	return "one row"
+}
+
+// parseLayout reads "off", "auto", "N" or "auto N"
+func parseLayout(args string) (Layout, error) {
+	layout := Layout{}
+
+	for _, arg := range strings.Fields(strings.ToLower(args)) {
+		switch arg {
+		case "off", "row":
+			return Layout{}, nil
+		case "auto":
+			layout.Auto = true
+		default:
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > maxButtonsPerRow {
+				return Layout{}, fmt.Errorf("%q is not a layout, use off, auto or a number of buttons from 1 to %d", arg, maxButtonsPerRow)
+			}
+
+			layout.PerRow = n
+		}
+	}
+
+	return layout, nil
+}
+
+// rows splits resources into keyboard rows, explicit rows of the board
+// are kept and each of them is wrapped by the layout
+func (board *Board) rows() [][]*Resource {
+	rows := board.explicitRows()
+
+	wrapped := make([][]*Resource, 0, len(rows))
+	for _, row := range rows {
+		wrapped = append(wrapped, board.Layout.wrap(row)...)
+	}
+
+	return wrapped
+}
+
+// explicitRows groups resources by the rows they were created in
+func (board *Board) explicitRows() [][]*Resource {
+	rows := [][]*Resource{}
+
+	for i, resource := range board.Resources {
+		if i == 0 || resource.Row != board.Resources[i-1].Row {
+			rows = append(rows, nil)
+		}
+
+		rows[len(rows)-1] = append(rows[len(rows)-1], resource)
+	}
+
+	return rows
+}
+
+func (layout Layout) wrap(row []*Resource) [][]*Resource {
+	wrapped := [][]*Resource{}
+	current := []*Resource{}
+	widest := 0
+
+	for _, resource := range row {
+		width := labelWidth(resource)
+		full := layout.PerRow > 0 && len(current) >= layout.PerRow
+		wide := layout.Auto && max(widest, width)*(len(current)+1) > autoRowWidth
+
+		if len(current) > 0 && (full || wide) {
+			wrapped = append(wrapped, current)
+			current, widest = []*Resource{}, 0
+		}
+
+		current = append(current, resource)
+		widest = max(widest, width)
+	}
+
+	if len(current) > 0 {
+		wrapped = append(wrapped, current)
+	}
+
+	return wrapped
+}
+
+// labelWidth does not depend on the state, so taking a resource
+// does not move buttons around
+func labelWidth(resource *Resource) int {
+	return utf8.RuneCountInString(resource.Name) + 2
+}
+
+// handleLayout answers /layout [off|auto|N|auto N]. As a reply it changes
+// the board, otherwise the default of new boards of the chat.
+func handleLayout(ctx context.Context, b *bot.Bot, message *models.Message) {
+	args := commandArgs(message.Text)
+
+	layout, err := parseLayout(args)
+	if err != nil {
+		replyText(ctx, b, message, err.Error())
+
+		return
+	}
+
+	if message.ReplyToMessage != nil {
+		var current Layout
+
+		_, err := changeRepliedBoard(ctx, b, message, func(board *Board) error {
+			current = board.Layout
+
+			if args == "" || board.Layout == layout {
+				return errNotModified
+			}
+
+			board.Layout = layout
+
+			return nil
+		})
+
+		switch {
+		case errors.Is(err, errNotReply):
+			replyText(ctx, b, message, "can't find a board in this message")
+		case errors.Is(err, errNotModified):
+			replyText(ctx, b, message, "board layout is "+current.String())
+		case errors.Is(err, errBoardFull):
+			replyText(ctx, b, message, "the board does not fit into this layout")
+		case err != nil:
+			log.Printf("error on layout %s\n", err)
+
+			replyText(ctx, b, message, "sorry, you cant't do that now")
+		default:
+			replyText(ctx, b, message, "board layout is "+layout.String()+" now")
+		}
+
+		return
+	}
+
+	if stateless {
+		replyText(ctx, b, message, "reply /layout to a board, chat defaults need a storage")
+
+		return
+	}
+
+	unlock := boardLocks.Lock(settingsLockKey(message.Chat.ID))
+	defer unlock()
+
+	settings, err := boards.Settings(message.Chat.ID)
+	if err != nil {
+		log.Printf("error on chat settings %d: %s\n", message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	if args == "" {
+		replyText(ctx, b, message, "new boards of this chat use layout "+settings.Layout.String())
+
+		return
+	}
+
+	settings.Layout = layout
+
+	if err := boards.SaveSettings(settings); err != nil {
+		log.Printf("error on chat settings %d: %s\n", message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	replyText(ctx, b, message, "new boards of this chat use layout "+layout.String())
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// shape renders rows of a keyboard as [a b] [c]
+func shape(kb *models.InlineKeyboardMarkup) string {
+	rows := []string{}
+
+	for _, row := range kb.InlineKeyboard {
+		texts := []string{}
+		for _, button := range row {
+			texts = append(texts, button.Text)
+		}
+
+		rows = append(rows, fmt.Sprint(texts))
+	}
+
+	return fmt.Sprint(rows)
+}
+
+func Test_Board_rows(t *testing.T) {
+	tests := []struct {
+		name   string
+		rows   [][]string
+		layout Layout
+		want   string
+	}{
+		{
+			name: "one row",
+			rows: [][]string{{"dev1", "dev2", "dev3", "dev4", "dev5", "dev6"}},
+			want: "[[🟢dev1 🟢dev2 🟢dev3 🟢dev4 🟢dev5 🟢dev6] [⚡]]",
+		},
+		{
+			name: "explicit rows",
+			rows: [][]string{{"dev1", "dev2"}, {"prod"}},
+			want: "[[🟢dev1 🟢dev2] [🟢prod] [⚡]]",
+		},
+		{
+			name:   "per row",
+			rows:   [][]string{{"dev1", "dev2", "dev3", "dev4", "dev5"}, {"prod"}},
+			layout: Layout{PerRow: 2},
+			want:   "[[🟢dev1 🟢dev2] [🟢dev3 🟢dev4] [🟢dev5] [🟢prod] [⚡]]",
+		},
+		{
+			name:   "auto",
+			rows:   [][]string{{"dev1", "dev2", "dev3", "dev4", "dev5", "dev6", "a-long-staging-name", "qa"}},
+			layout: Layout{Auto: true},
+			want:   "[[🟢dev1 🟢dev2 🟢dev3 🟢dev4 🟢dev5] [🟢dev6] [🟢a-long-staging-name] [🟢qa] [⚡]]",
+		},
+		{
+			name:   "auto with limit",
+			rows:   [][]string{{"dev1", "dev2", "dev3", "dev4", "dev5"}},
+			layout: Layout{Auto: true, PerRow: 3},
+			want:   "[[🟢dev1 🟢dev2 🟢dev3] [🟢dev4 🟢dev5] [⚡]]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board := newBoard(1, nil)
+			board.Layout = tt.layout
+
+			for _, row := range tt.rows {
+				board.addRow(row)
+			}
+
+			if got := shape(board.keyboard()); got != tt.want {
+				t.Errorf("keyboard() = %s, want %s", got, tt.want)
+			}
+
+			// taking a resource does not move buttons
+			board.take(board.Resources[0], models.User{ID: 1})
+
+			kb, err := board.statelessKeyboard()
+			if err != nil {
+				t.Fatalf("statelessKeyboard() error %s", err)
+			}
+
+			if shape(kb) != shape(board.keyboard()) {
+				t.Errorf("statelessKeyboard() = %s, want %s", shape(kb), shape(board.keyboard()))
+			}
+
+			// a stateless board keeps the rows it was shown with
+			restored, ok := boardFromMessage(&models.Message{Chat: models.Chat{ID: 1}, Text: board.text(), ReplyMarkup: kb})
+			if !ok {
+				t.Fatalf("boardFromMessage() failed")
+			}
+
+			restoredKb, _ := restored.statelessKeyboard()
+			if shape(restoredKb) != shape(kb) {
+				t.Errorf("restored rows = %s, want %s", shape(restoredKb), shape(kb))
+			}
+		})
+	}
+}
+
+func Test_parseLayout(t *testing.T) {
+	tests := []struct {
+		args    string
+		want    Layout
+		wantErr bool
+	}{
+		{args: "", want: Layout{}},
+		{args: "off", want: Layout{}},
+		{args: "auto", want: Layout{Auto: true}},
+		{args: "3", want: Layout{PerRow: 3}},
+		{args: "Auto 4", want: Layout{Auto: true, PerRow: 4}},
+		{args: "9", wantErr: true},
+		{args: "wide", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLayout(tt.args)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseLayout(%q) = %#v, %v, want %#v", tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func Test_handleLayout(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	var (
+		replies []string
+		sent    = &models.InlineKeyboardMarkup{}
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		replies = append(replies, formValue(body, "text"))
+
+		if markup := formValue(body, "reply_markup"); markup != "" {
+			_ = json.Unmarshal([]byte(markup), sent)
+		}
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 700, "chat": map[string]any{"id": 70}}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		_ = json.Unmarshal([]byte(formValue(body, "reply_markup")), sent)
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	boardMessage := &models.Message{ID: 700, Chat: models.Chat{ID: 70}}
+
+	tests := []struct {
+		text      string
+		reply     *models.Message
+		want      string
+		wantShape string
+	}{
+		{text: "/layout", want: "new boards of this chat use layout one row"},
+		{text: "/layout 2", want: "new boards of this chat use layout 2 per row"},
+		{text: "/layout 20", want: `"20" is not a layout, use off, auto or a number of buttons from 1 to 8`},
+		{text: "/create dev1 dev2 dev3 | prod", want: "🟢dev1  🟢dev2  🟢dev3  🟢prod", wantShape: "[[🟢dev1 🟢dev2] [🟢dev3] [🟢prod] [⚡]]"},
+		{text: "/layout", reply: boardMessage, want: "board layout is 2 per row"},
+		{text: "/layout off", reply: boardMessage, want: "board layout is one row now", wantShape: "[[🟢dev1 🟢dev2 🟢dev3] [🟢prod] [⚡]]"},
+		{text: "/add | qa stage", reply: boardMessage, want: "added qa, stage", wantShape: "[[🟢dev1 🟢dev2 🟢dev3] [🟢prod] [🟢qa 🟢stage] [⚡]]"},
+		{text: "/add ci", reply: boardMessage, want: "added ci", wantShape: "[[🟢dev1 🟢dev2 🟢dev3] [🟢prod] [🟢qa 🟢stage 🟢ci] [⚡]]"},
+		{text: "/layout off", reply: boardMessage, want: "board layout is one row"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			replies = nil
+
+			handler(ctx, b, &models.Update{Message: &models.Message{Text: tt.text, Chat: models.Chat{ID: 70}, ReplyToMessage: tt.reply}})
+
+			if len(replies) != 1 || replies[0] != tt.want {
+				t.Errorf("replies = %q, want %q", replies, tt.want)
+			}
+
+			if tt.wantShape != "" && shape(sent) != tt.wantShape {
+				t.Errorf("keyboard = %s, want %s", shape(sent), tt.wantShape)
+			}
+		})
+	}
+}
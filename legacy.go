@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// parseLegacyCallback reads both historical formats of callback_data:
+// plain "free-<name>"/"busy-<name>" strings and JSON CallbackData
+func parseLegacyCallback(data string) (*CallbackData, bool) {
+	if strings.HasPrefix(data, "free-") || strings.HasPrefix(data, "busy-") || strings.HasPrefix(data, notifyEmoji) {
+		return &CallbackData{Command: data}, true
+	}
+
+	cbd := &CallbackData{}
+	if err := json.Unmarshal([]byte(data), cbd); err != nil || cbd.Command == "" {
+		return nil, false
+	}
+
+	return cbd, true
+}
+
+// migrateLegacyBoard imports the board of a pressed legacy or stateless button into the store
+// (once per message) and returns the token the button would have in the current format
+func migrateLegacyBoard(query *models.CallbackQuery) (callbackToken, bool) {
+	pressed, err := decodePayload(query.Data)
+	if err != nil || query.Message.Type != models.MaybeInaccessibleMessageTypeMessage || query.Message.Message == nil {
+		return callbackToken{}, false
+	}
+
+	message := query.Message.Message
+
+	// two first presses on the same legacy board must not import it twice
+	unlock := boardLocks.Lock(fmt.Sprintf("%d/%d", message.Chat.ID, message.ID))
+	defer unlock()
+
+	board, err := boards.GetByMessage(message.Chat.ID, message.ID)
+	if errors.Is(err, errBoardNotFound) {
+		var ok bool
+
+		board, ok = boardFromMessage(message)
+		if !ok {
+			return callbackToken{}, false
+		}
+
+		if board, err = boards.Create(board, boardEvents(nil, board, query.From)...); err != nil {
+			log.Printf("error on import legacy board %s\n", err)
+
+			return callbackToken{}, false
+		}
+
+		log.Printf("imported legacy board %d/%d as %s\n", board.ChatID, board.MessageID, board.ID)
+	}
+
+	if err != nil {
+		log.Printf("error on get board of %d/%d: %s\n", message.Chat.ID, message.ID, err)
+
+		return callbackToken{}, false
+	}
+
+	if pressed.Command == cmdNotify {
+		return callbackToken{BoardID: board.ID, Action: actionNotify}, true
+	}
+
+	resource := pressedResource(board, pressed)
+	if resource == nil {
+		return callbackToken{}, false
+	}
+
+	token := payloadToken(resource, pressed)
+	token.BoardID = board.ID
+
+	return token, true
+}
+
+// legacyResource returns resource name of the command and whether it is busy,
+// busy resources carried the command that frees them
+func legacyResource(command string) (string, bool) {
+	if name, ok := strings.CutPrefix(command, "free-"); ok {
+		return name, true
+	}
+
+	return strings.TrimPrefix(command, "busy-"), false
+}
+
+// legacyHolderFromText finds "<button text> (<holder>)" among message items
+func legacyHolderFromText(items []string, buttonText string) string {
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+
+		if holder, ok := strings.CutPrefix(item, buttonText+" ("); ok && strings.HasSuffix(holder, ")") {
+			return strings.TrimSuffix(holder, ")")
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+type legacyCase struct {
+	Name    string         `json:"name"`
+	Message models.Message `json:"message"`
+	Want    struct {
+		Resources []struct {
+			Name   string `json:"name"`
+			Holder string `json:"holder"`
+		} `json:"resources"`
+		Notify []int64 `json:"notify"`
+	} `json:"want"`
+}
+
+func loadLegacyCorpus(t *testing.T) []legacyCase {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/legacy_keyboards.json")
+	if err != nil {
+		t.Fatalf("ReadFile() error %s", err)
+	}
+
+	cases := []legacyCase{}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatalf("Unmarshal() error %s", err)
+	}
+
+	return cases
+}
+
+func Test_boardFromMessage_legacy(t *testing.T) {
+	for _, tt := range loadLegacyCorpus(t) {
+		t.Run(tt.Name, func(t *testing.T) {
+			board, ok := boardFromMessage(&tt.Message)
+			if !ok {
+				t.Fatalf("boardFromMessage() = false")
+			}
+
+			if board.ChatID != tt.Message.Chat.ID || board.MessageID != tt.Message.ID {
+				t.Errorf("board is bound to %d/%d", board.ChatID, board.MessageID)
+			}
+
+			if len(board.Resources) != len(tt.Want.Resources) {
+				t.Fatalf("resources = %d, want %d", len(board.Resources), len(tt.Want.Resources))
+			}
+
+			for i, want := range tt.Want.Resources {
+				got := board.Resources[i]
+
+				holder := ""
+				if got.Holder != nil {
+					holder = got.Holder.Name
+				}
+
+				if got.Name != want.Name || holder != want.Holder {
+					t.Errorf("resource %d = %s (%s), want %s (%s)", i, got.Name, holder, want.Name, want.Holder)
+				}
+
+				// nothing is lost once rendered in the current format
+				if holder != "" && !strings.Contains(board.text(), got.Name+" ("+holder+")") {
+					t.Errorf("text() = %s, lost holder of %s", board.text(), got.Name)
+				}
+			}
+
+			if !slices.Equal(board.Notify, tt.Want.Notify) {
+				t.Errorf("notify = %v, want %v", board.Notify, tt.Want.Notify)
+			}
+		})
+	}
+}
+
+func Test_migrateLegacyBoard(t *testing.T) {
+	for _, tt := range loadLegacyCorpus(t) {
+		t.Run(tt.Name, func(t *testing.T) {
+			for _, row := range tt.Message.ReplyMarkup.InlineKeyboard {
+				for _, button := range row {
+					token, ok := migrateLegacyBoard(&models.CallbackQuery{
+						Data: button.CallbackData,
+						Message: models.MaybeInaccessibleMessage{
+							Type:    models.MaybeInaccessibleMessageTypeMessage,
+							Message: &tt.Message,
+						},
+					})
+					if !ok {
+						t.Fatalf("migrateLegacyBoard(%s) = false", button.CallbackData)
+					}
+
+					board, _ := boards.Get(token.BoardID)
+
+					// pressed button must map to the same button of the migrated board
+					want := button.Text
+					got := ""
+
+					for _, row := range board.keyboard().InlineKeyboard {
+						for _, b := range row {
+							if trustedCallbackData(board.ChatID, b.CallbackData) == token.String() {
+								got = b.Text
+							}
+						}
+					}
+
+					if strings.ReplaceAll(want, " ", "") != strings.ReplaceAll(got, " ", "") && !strings.HasPrefix(want, notifyEmoji) {
+						t.Errorf("%s mapped to %s", want, got)
+					}
+				}
+			}
+
+			if board, err := boards.GetByMessage(tt.Message.Chat.ID, tt.Message.ID); err == nil {
+				if err := boards.Delete(board.ID); err != nil {
+					t.Fatalf("Delete() error %s", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_parseLegacyCallback(t *testing.T) {
+	tests := []struct {
+		data string
+		want *CallbackData
+	}{
+		{data: "free-test", want: &CallbackData{Command: "free-test"}},
+		{data: "busy-test", want: &CallbackData{Command: "busy-test"}},
+		{data: `{"c": "free-test", "u": "name"}`, want: &CallbackData{Command: "free-test", User: "name"}},
+		{data: `{"c":"⚡2","n":[1,2]}`, want: &CallbackData{Command: "⚡2", Notify: []int64{1, 2}}},
+		{data: `{"c": "free-test"`},
+		{data: `{}`},
+		{data: "1:2:t"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			got, ok := parseLegacyCallback(tt.data)
+			if ok != (tt.want != nil) {
+				t.Fatalf("parseLegacyCallback() ok = %v", ok)
+			}
+
+			if ok && (got.Command != tt.want.Command || got.User != tt.want.User || !slices.Equal(got.Notify, tt.want.Notify)) {
+				t.Errorf("parseLegacyCallback() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_handler_legacyPress(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	message := loadLegacyCorpus(t)[3].Message
+
+	handler(context.Background(), b, &models.Update{
+		CallbackQuery: &models.CallbackQuery{
+			Data: message.ReplyMarkup.InlineKeyboard[0][1].CallbackData,
+			From: models.User{ID: 35623, FirstName: "Daniel"},
+			Message: models.MaybeInaccessibleMessage{
+				Type:    models.MaybeInaccessibleMessageTypeMessage,
+				Message: &message,
+			},
+		},
+	})
+
+	board, err := boards.GetByMessage(message.Chat.ID, message.ID)
+	if err != nil {
+		t.Fatalf("legacy board was not migrated")
+	}
+
+	if got, want := board.text(), "🏗️testing-1 (UmяOтчecтвo Фamuлuя)  🏗️testing-2 (Daniel)  🏗️prod (veryveryveryveryvery v.)"; got != want {
+		t.Errorf("text() = %v, want %v", got, want)
+	}
+
+	// the presser is a subscriber too, only two others are notified,
+	// the presser is asked for how long instead
+	if s.hooksCalls["/bottest_token/sendMessage"] != 3 {
+		t.Errorf("sendMessage calls = %d, want 3", s.hooksCalls["/bottest_token/sendMessage"])
+	}
+}
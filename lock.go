@@ -0,0 +1,46 @@
+package main
+
+import "sync"
+
+// keyedMutex serializes work per key, e.g. all presses on the same board
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: map[string]*keyedLock{}}
+}
+
+// Lock waits for the key and returns the function releasing it
+func (m *keyedMutex) Lock(key string) func() {
+	m.mu.Lock()
+
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		m.locks[key] = l
+	}
+
+	l.refs++
+	m.mu.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+	}
+}
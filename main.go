@@ -1,30 +1,47 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
-	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
-	jsonminifier "github.com/tdewolff/minify/v2/json"
-	"golang.org/x/exp/slices"
 )
 
-const ConfigFileName = "/data/options.json"
+const (
+	ConfigFileName = "/data/options.json"
+	DataDir        = "/data"
+)
+
+const editAttempts = 3
+
+var (
+	boards     Storage = newBoardStore()
+	boardLocks         = newKeyedMutex()
+)
 
 // Config ...
 type Config struct {
-	Token string `json:"TOKEN"`
+	Token     string `json:"TOKEN"`
+	Secret    string `json:"SECRET"`
+	Stateless bool   `json:"STATELESS"`
+	// memory, file or sql, file in DATA_DIR if empty
+	Storage        string `json:"STORAGE"`
+	DatabaseDriver string `json:"DATABASE_DRIVER"`
+	DatabaseURL    string `json:"DATABASE_URL"`
 }
 
 type CallbackData struct {
@@ -35,8 +52,18 @@ type CallbackData struct {
 
 func main() {
 	token := ""
+	secret := ""
+	storage := StorageConfig{}
+	file := ""
 	var initFromFile = false
 
+	// export and import subcommands go before the flags
+	command := ""
+	if len(os.Args) > 1 && (os.Args[1] == "export" || os.Args[1] == "import") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	if _, err := os.Stat(ConfigFileName); err == nil {
 		jsonFile, err := os.Open(ConfigFileName)
 		if err == nil {
@@ -47,22 +74,70 @@ func main() {
 				log.Printf("error on unmarshal config from file %s\n", err.Error())
 			} else {
 				token = config.Token
+				secret = config.Secret
+				stateless = config.Stateless
+				storage = StorageConfig{
+					Kind:   config.Storage,
+					Dir:    DataDir,
+					Driver: config.DatabaseDriver,
+					DSN:    config.DatabaseURL,
+				}
 
 				initFromFile = true
 			}
 		}
 	}
 
-	if !initFromFile {
+	if !initFromFile || command != "" {
+		flag.StringVar(&file, "file", "boards.json", "document to export boards to or import them from")
 		flag.StringVar(&token, "TOKEN", lookupEnvOrString("TOKEN", token), "telegram bot token")
+		flag.StringVar(&storage.Kind, "STORAGE", lookupEnvOrString("STORAGE", storage.Kind), "memory, file or sql, file if DATA_DIR is set")
+		flag.StringVar(&storage.Dir, "DATA_DIR", lookupEnvOrString("DATA_DIR", storage.Dir), "directory to keep boards in, in memory if empty")
+		flag.StringVar(&storage.Driver, "DATABASE_DRIVER", lookupEnvOrString("DATABASE_DRIVER", storage.Driver), "database/sql driver of sql storage, postgres if empty")
+		flag.StringVar(&storage.DSN, "DATABASE_URL", lookupEnvOrString("DATABASE_URL", storage.DSN), "data source name of sql storage")
+		flag.StringVar(&secret, "SECRET", lookupEnvOrString("SECRET", secret), "key to sign callback data with, bot token if empty")
+		flag.BoolVar(&stateless, "STATELESS", lookupEnvOrString("STATELESS", strconv.FormatBool(stateless)) == "true", "keep boards in callback data only, no storage")
 		flag.Parse()
 	}
 
+	// export reads boards of the running bot, it must not compact its journal
+	storage.ReadOnly = command == "export"
+
+	if !stateless || command == "export" {
+		store, err := openStorage(storage)
+		if err != nil {
+			log.Fatalf("error on open boards storage: %s", err)
+		}
+
+		defer store.Close()
+
+		boards = store
+	}
+
+	if command == "export" {
+		exported, err := exportToFile(file)
+		if err != nil {
+			log.Printf("error on export boards to %s: %s\n", file, err)
+
+			return
+		}
+
+		log.Printf("exported %d boards to %s\n", exported, file)
+
+		return
+	}
+
 	if token == "" {
 		log.Fatal("TOKEN env var not set")
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	if secret == "" {
+		secret = token
+	}
+
+	callbackKey = deriveCallbackKey(secret)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	opts := []bot.Option{
@@ -77,6 +152,18 @@ func main() {
 		return
 	}
 
+	if command == "import" {
+		if err := importFromFile(ctx, b, file); err != nil {
+			log.Fatalf("error on import boards from %s: %s", file, err)
+		}
+
+		return
+	}
+
+	if !stateless {
+		go watchHolds(ctx, b)
+	}
+
 	log.Println("bot started")
 
 	b.Start(ctx)
@@ -92,417 +179,549 @@ func lookupEnvOrString(key, defaultVal string) string {
 
 func handler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if update.CallbackQuery != nil {
-		cbdMessage := &CallbackData{}
+		data, ok := verifyCallback(update.CallbackQuery)
+		if !ok {
+			log.Printf("error: tampered callback data %#v from %d\n", update.CallbackQuery.Data, update.CallbackQuery.From.ID)
 
-		isNotifyPressed := false
-		setNotify := false
+			showFlashMessage(ctx, b, update.CallbackQuery.ID, "sorry, you cant't do that now")
 
-		target := ""
-		if strings.HasPrefix(update.CallbackQuery.Data, "free-") || strings.HasPrefix(update.CallbackQuery.Data, "busy-") {
-			isNotifyPressed = strings.HasPrefix(update.CallbackQuery.Data, "⚡")
+			return
+		}
 
-			target = strings.TrimPrefix(strings.TrimPrefix(update.CallbackQuery.Data, "free-"), "busy-")
-		} else {
-			if err := json.Unmarshal([]byte(update.CallbackQuery.Data), cbdMessage); err != nil {
-				log.Printf("error on unmarshal callback data %s\n", err.Error())
-			} else {
-				isNotifyPressed = strings.HasPrefix(cbdMessage.Command, "⚡")
+		update.CallbackQuery.Data = data
 
-				if slices.Contains(cbdMessage.Notify, update.CallbackQuery.From.ID) {
-					setNotify = true
-				}
+		if stateless {
+			handleStatelessCallback(ctx, b, update.CallbackQuery)
 
-				target = strings.TrimPrefix(strings.TrimPrefix(cbdMessage.Command, "free-"), "busy-")
-			}
+			return
 		}
 
-		notificationText := fmt.Sprintf(
-			"%s updated by %s %s",
-			target,
-			update.CallbackQuery.From.FirstName,
-			update.CallbackQuery.From.LastName,
-		)
-
-		if isNotifyPressed {
-			notifyState := "enabled"
-			if setNotify {
-				notifyState = "disabled"
-			}
-			notificationText = fmt.Sprintf(
-				"%s %s %s notifications",
-				update.CallbackQuery.From.FirstName,
-				update.CallbackQuery.From.LastName,
-				notifyState,
-			)
+		token, ok := parseCallbackToken(data)
+		if !ok {
+			token, ok = migrateLegacyBoard(update.CallbackQuery)
 		}
 
-		log.Printf("%#v from %d\n", notificationText, update.CallbackQuery.From.ID)
+		if !ok {
+			log.Printf("unknown callback data %#v from %d\n", update.CallbackQuery.Data, update.CallbackQuery.From.ID)
 
-		kb := &models.InlineKeyboardMarkup{
-			InlineKeyboard: [][]models.InlineKeyboardButton{},
-		}
+			showFlashMessage(ctx, b, update.CallbackQuery.ID, "sorry, you cant't do that now")
 
-		if update.CallbackQuery.Message.Type != models.MaybeInaccessibleMessageTypeMessage {
 			return
 		}
 
-		message := update.CallbackQuery.Message.Message
-
-		messageText := message.Text
-		if message.ReplyMarkup.InlineKeyboard != nil {
-			buttons := []models.InlineKeyboardButton{}
-			items := []string{}
-
-			notifyButtonPresent := &CallbackData{}
-			notifyUsers := []int64{}
-			for _, subitems := range message.ReplyMarkup.InlineKeyboard {
-				for _, subitem := range subitems {
-					callbackData := subitem.CallbackData
-
-					cbd := &CallbackData{}
-
-					if err := json.Unmarshal([]byte(callbackData), cbd); err == nil {
-						if strings.HasPrefix(cbd.Command, "⚡") {
-							notifyButtonPresent = cbd
-							foundInNotify := false
-
-							if cbd.Notify != nil {
-								for _, i := range cbd.Notify {
-									if cbd.Command == cbdMessage.Command {
-										if i != update.CallbackQuery.From.ID {
-											notifyUsers = append(notifyUsers, i)
-										} else {
-											foundInNotify = true
-										}
-									} else {
-										notifyUsers = append(notifyUsers, i)
-									}
-								}
-							}
-
-							if cbd.Command == cbdMessage.Command {
-								if !foundInNotify {
-									notifyUsers = append(notifyUsers, update.CallbackQuery.From.ID)
-								}
-							}
-
-							cbd.Command = "⚡"
-							cbd.Notify = notifyUsers
-
-							if len(cbd.Notify) > 0 {
-								cbd.Command = fmt.Sprintf("⚡%d", len(cbd.Notify))
-							}
-						}
-					}
-				}
-			}
+		handleBoardCallback(ctx, b, update.CallbackQuery, token)
 
-			for _, subitems := range message.ReplyMarkup.InlineKeyboard {
-				for _, subitem := range subitems {
-					callbackData := subitem.CallbackData
-					// fmt.Printf("%#v\n", i.(map[string]interface{}))
-					text := subitem.Text
-
-					cbd := &CallbackData{}
-
-					if err := json.Unmarshal([]byte(callbackData), cbd); err != nil {
-						log.Printf("error on unmarshal callback data %s\n", err.Error())
-						if callbackData == update.CallbackQuery.Data {
-							cbd.User = shortenUsername(callbackData, update.CallbackQuery.From.FirstName, update.CallbackQuery.From.LastName)
-
-							if strings.HasPrefix(callbackData, "busy-") {
-								text = strings.Replace(text, "🟢 ", "🟢", 1)
-								text = strings.Replace(text, "🟢", "🏗️", 1)
-								cbd.Command = strings.Replace(callbackData, "busy-", "free-", 1)
-							} else if strings.HasPrefix(callbackData, "free-") {
-								text = strings.Replace(text, "🏗️ ", "🏗️", 1)
-								text = strings.Replace(text, "🏗️", "🟢", 1)
-								cbd.Command = strings.Replace(callbackData, "free-", "busy-", 1)
-							}
-						} else {
-							cbd.Command = callbackData
-						}
-					} else {
-						if cbd.Command == cbdMessage.Command {
-							if !strings.HasPrefix(cbd.Command, "⚡") {
-								cbd.User = shortenUsername(cbd.Command, update.CallbackQuery.From.FirstName, update.CallbackQuery.From.LastName)
-
-								if strings.HasPrefix(cbd.Command, "busy-") {
-									text = strings.Replace(text, "🟢 ", "🟢", 1)
-									text = strings.Replace(text, "🟢", "🏗️", 1)
-									cbd.Command = strings.Replace(cbd.Command, "busy-", "free-", 1)
-								} else if strings.HasPrefix(cbd.Command, "free-") {
-									text = strings.Replace(text, "🏗️ ", "🏗️", 1)
-									text = strings.Replace(text, "🏗️", "🟢", 1)
-									cbd.Command = strings.Replace(cbd.Command, "free-", "busy-", 1)
-								}
-
-								if len(notifyUsers) > 0 {
-									for _, userID := range notifyUsers {
-										if update.CallbackQuery.From.ID != userID {
-											_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
-												ChatID: userID,
-												Text:   fmt.Sprintf("%s status updated by %s", text, cbd.User),
-											})
-										}
-									}
-								}
-							}
-						}
-					}
-
-					if !strings.HasPrefix(cbd.Command, "⚡") {
-						itemText := text
-						if strings.HasPrefix(cbd.Command, "free-") && cbd.User != "" {
-							itemText = fmt.Sprintf("%s (%s)", text, cbd.User)
-						}
-
-						items = append(items, itemText)
-
-						cbdToSend, err := json.Marshal(cbd)
-						if err != nil {
-							log.Printf("%#v, err %s\n", cbd, err)
-
-							return
-						}
-
-						minified := minifyJson(cbdToSend)
-						if !checkStringLimit(minified, 64) {
-							log.Printf("error: callback_data too long. %s\n", cbdToSend)
-
-							showFlashMessage(ctx, b, update.CallbackQuery.ID, "sorry, you cant't do that now")
-
-							return
-						}
-
-						buttons = append(
-							buttons,
-							models.InlineKeyboardButton{
-								CallbackData: minified,
-								Text:         text,
-							},
-						)
-					}
-				}
-			}
+		return
+	}
 
-			if len(items) > 0 {
-				messageText = strings.Join(items, "  ")
-			}
+	if update.Message == nil {
+		return
+	}
 
-			kb.InlineKeyboard = [][]models.InlineKeyboardButton{buttons}
+	switch commandWord(update.Message.Text) {
+	case "/create":
+		handleCreate(ctx, b, update.Message)
+	case "/export":
+		handleExport(ctx, b, update.Message)
+	case "/import":
+		handleImport(ctx, b, update.Message)
+	case "/history":
+		handleHistory(ctx, b, update.Message)
+	case "/repair":
+		handleRepair(ctx, b, update.Message)
+	case "/add":
+		handleAdd(ctx, b, update.Message)
+	case "/remove":
+		handleRemove(ctx, b, update.Message)
+	case "/rename":
+		handleRename(ctx, b, update.Message)
+	case "/title":
+		handleTitle(ctx, b, update.Message)
+	case "/layout":
+		handleLayout(ctx, b, update.Message)
+	case "/mine":
+		handleMine(ctx, b, update.Message)
+	case "/status":
+		handleStatus(ctx, b, update.Message)
+	case "/template":
+		handleTemplate(ctx, b, update.Message)
+	case "/clone":
+		handleClone(ctx, b, update.Message)
+	case "/close":
+		handleClose(ctx, b, update.Message)
+	case "/delete":
+		handleDelete(ctx, b, update.Message)
+	case "/take":
+		handleTake(ctx, b, update.Message, actionTake)
+	case "/state":
+		handleTake(ctx, b, update.Message, actionState)
+	case "/queue":
+		handleTake(ctx, b, update.Message, actionQueue)
+	case "/bookings":
+		handleBookings(ctx, b, update.Message)
+	case "/book":
+		handleBook(ctx, b, update.Message, false)
+	case "/unbook":
+		handleBook(ctx, b, update.Message, true)
+	case "/releaseall":
+		handleReleaseAll(ctx, b, update.Message)
+	case "/release":
+		handleTake(ctx, b, update.Message, actionRelease)
+	}
+}
 
-			if notifyButtonPresent.Command == "" {
-				notifyButtonPresent.Command = "⚡"
-			}
+func handleBoardCallback(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, token callbackToken) {
+	board, notificationText, err := pressButton(ctx, b, token, query.From, "")
 
-			cbdToSend, err := json.Marshal(notifyButtonPresent)
-			if err == nil {
-				minified := minifyJson(cbdToSend)
-				if !checkStringLimit(minified, 64) {
-					log.Printf("error: callback_data too long. %s\n", cbdToSend)
+	switch {
+	case errors.Is(err, errBoardNotFound):
+		showFlashMessage(ctx, b, query.ID, "this board is no longer available")
 
-					showFlashMessage(ctx, b, update.CallbackQuery.ID, "sorry, you cant't do that now")
+		return
+	case err != nil && !errors.Is(err, errNotModified):
+		log.Printf("error on update board %s: %s\n", token.BoardID, err)
 
-					return
-				}
+		showFlashMessage(ctx, b, query.ID, "sorry, you cant't do that now")
 
-				kb.InlineKeyboard = append(
-					kb.InlineKeyboard,
-					[]models.InlineKeyboardButton{
-						{
-							CallbackData: minified,
-							Text:         notifyButtonPresent.Command,
-						},
-					},
-				)
-			} else {
-				log.Printf("%#v, err %s\n", notifyButtonPresent, err)
-			}
-		}
+		return
+	}
 
-		editedMessage := &bot.EditMessageTextParams{
-			ChatID:      message.Chat.ID,
-			MessageID:   message.ID,
-			Text:        messageText,
-			ReplyMarkup: kb,
-		}
+	// buttons of confirmations and choices are pressed once
+	switch pressed := query.Message.Message; {
+	case token.Action == actionReleaseMine:
+		refreshMinePanel(ctx, b, query)
+	case token.Action == actionQueue:
+		// everybody in the chat may line up with the same button
+	case pressed != nil && (pressed.Chat.ID != board.ChatID || pressed.ID != board.MessageID):
+		closeConfirmation(ctx, b, query, notificationText)
+	}
 
-		_, err := b.EditMessageText(ctx, editedMessage)
-		if err != nil {
-			log.Printf("error on edit message %s, %#v %#v\n", err.Error(), editedMessage, editedMessage.ReplyMarkup)
+	if token.Action == actionTake && err == nil {
+		offerHoldTimes(ctx, b, board, board.resource(token.ResourceID), query.From)
+	}
+
+	// hide Loading... message and show who pressed button
+	showFlashMessage(ctx, b, query.ID, notificationText)
+}
+
+// pressButton applies a press of token on a stored board by user, buttons and
+// text commands go the same way: the board message is rendered again and
+// subscribers are notified. Returns the board and the text for the presser,
+// errNotModified when the board already was in the wanted state.
+func pressButton(ctx context.Context, b *bot.Bot, token callbackToken, user models.User, note string) (*Board, string, error) {
+	// presses on the same board are applied and rendered one by one
+	unlock := boardLocks.Lock(token.BoardID)
+	defer unlock()
+
+	var (
+		changed          *Resource
+		notificationText string
+	)
+
+	board, err := updateBoard(boards, token.BoardID, user, func(board *Board) error {
+		var err error
+
+		changed, notificationText, err = applyAction(board, token, user)
+
+		if err == nil && (token.Action == actionTake || token.Action == actionState) && note != "" && changed.holderOf(user.ID) != nil {
+			changed.holderOf(user.ID).Note = note
 		}
 
-		// hide Loading... message and show who pressed button
-		showFlashMessage(ctx, b, update.CallbackQuery.ID, notificationText)
+		return err
+	})
 
-		return
+	switch {
+	case errors.Is(err, errNotModified):
+		// the message shows stale state, bring it up to date
+		editBoardMessage(ctx, b, board)
+
+		return board, notificationText, err
+	case err != nil:
+		return board, "", err
 	}
 
-	if update.Message != nil && strings.HasPrefix(update.Message.Text, "/create") {
-		message := strings.Trim(regexp.MustCompile(`\s+`).ReplaceAllString(update.Message.Text, " "), " ")
-		parts := strings.Fields(message)
+	log.Printf("%#v from %d\n", notificationText, user.ID)
 
-		log.Printf("message %#v from %d\n", message, update.Message.Chat.ID)
+	editBoardMessage(ctx, b, board)
 
-		if len(parts) < 2 {
-			_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "you must send command in format /create name1 name2 nameN",
-			})
+	notifySubscribers(ctx, b, board, changed, user)
 
-			return
+	sendOffers(ctx, b, board.ID)
+
+	return board, notificationText, nil
+}
+
+// applyAction applies a pressed button to the board and returns the changed
+// resource and the text for the presser, errNotModified when the keyboard
+// the user saw was stale
+func applyAction(board *Board, token callbackToken, user models.User) (*Resource, string, error) {
+	switch token.Action {
+	case actionNotify:
+		notifyState := "disabled"
+		if board.toggleNotify(user.ID) {
+			notifyState = "enabled"
 		}
 
-		messageText := ""
+		return nil, fmt.Sprintf("%s %s notifications", fullName(user), notifyState), nil
+	case actionTake, actionRelease, actionState, actionSlot:
+		resource := board.resource(token.ResourceID)
+		if resource == nil {
+			return nil, "this item was removed from the board", errNotModified
+		}
 
-		kb := &models.InlineKeyboardMarkup{
-			InlineKeyboard: [][]models.InlineKeyboardButton{},
+		if resource.shared() {
+			return applySlot(board, resource, token, user)
 		}
 
-		buttons := []models.InlineKeyboardButton{}
-		items := []string{}
-		for _, v := range parts[1:] {
-			text := "🟢" + v
-			callbackData := CallbackData{
-				Command: "busy-" + v,
-			}
+		// the resource was made exclusive since the button was drawn
+		if token.Action == actionSlot {
+			token.Action = actionTake
+		}
+
+		// the keyboard the user saw may show a hold that is gone by now
+		token, hold, expected := token.expectedHolder()
+		if expected && resource.Holder == nil {
+			return nil, fmt.Sprintf("%s was already released", resource.Name), errNotModified
+		}
 
-			cbd, err := json.Marshal(callbackData)
-			if err != nil {
-				_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: update.Message.Chat.ID,
-					Text:   "Failed to create buttons",
-				})
+		if expected && !hold.matches(resource.Holder) {
+			return nil, fmt.Sprintf("%s was taken again by %s", resource.Name, resource.Holder.Name), errNotModified
+		}
 
-				return
+		// only the holder releases, others pressing the busy button line up for it
+		if token.Action == actionRelease && resource.Holder != nil && resource.Holder.ID != user.ID {
+			if stateless || !expected {
+				return nil, fmt.Sprintf("%s is taken by %s, only they can release it", resource.Name, resource.Holder.Name), errNotModified
 			}
 
-			items = append(items, text)
+			token.Action = actionQueue
+			text, err := applyQueue(board, token, user, time.Now())
 
-			minified := minifyJson(cbd)
-			if !checkStringLimit(minified, 64) {
-				log.Printf("error: callback_data too long. %s\n", cbd)
+			return nil, text, err
+		}
 
-				showFlashMessage(ctx, b, update.CallbackQuery.ID, "sorry, you cant't do that now")
+		state := 0
+		if token.Action == actionState {
+			var err error
 
-				return
+			if state, err = strconv.Atoi(token.Arg); err != nil || state < 0 || state >= len(board.states()) {
+				return nil, "this state was removed from the board", errNotModified
 			}
 
-			buttons = append(
-				buttons,
-				models.InlineKeyboardButton{
-					CallbackData: minified,
-					Text:         text,
-				},
-			)
+			if board.stateOf(resource) == state {
+				return nil, fmt.Sprintf("%s is %s already", resource.Name, board.stateLabel(resource)), errNotModified
+			}
 		}
 
-		if len(items) > 0 {
-			messageText = strings.Join(items, "  ")
+		// a held state of a free resource takes it first
+		take := token.Action == actionTake || (state > 0 && resource.Holder == nil)
+
+		if waiter := resource.offeredTo(); take && waiter != nil && waiter.ID != user.ID {
+			return nil, fmt.Sprintf("%s is kept for %s, the first in line", resource.Name, waiter.Name), errNotModified
 		}
 
-		notifyButtonPresent := &CallbackData{
-			Command: "⚡",
+		if booking := resource.activeBooking(time.Now()); take && resource.Holder == nil && booking != nil && booking.UserID != user.ID {
+			return nil, fmt.Sprintf("%s is booked by %s until %s", resource.Name, booking.Name, booking.End.Local().Format("15:04")), errNotModified
 		}
 
-		cbdToSend, err := json.Marshal(notifyButtonPresent)
-		if err != nil {
-			log.Printf("%#v, err %s\n", notifyButtonPresent, err)
+		// the keyboard the user saw may be stale, tell what happened instead
+		if take && !board.take(resource, user) {
+			return nil, fmt.Sprintf("%s was already taken by %s", resource.Name, resource.Holder.Name), errNotModified
+		}
 
-			return
+		if (token.Action == actionRelease || token.Action == actionState && state == 0) && !board.release(resource) {
+			return nil, fmt.Sprintf("%s was already released", resource.Name), errNotModified
 		}
 
-		minified := minifyJson(cbdToSend)
-		if !checkStringLimit(minified, 64) {
-			log.Printf("error: callback_data too long. %s\n", cbdToSend)
+		if state > 0 {
+			board.setState(resource, state, user)
+		}
 
-			return
+		return resource, fmt.Sprintf("%s updated by %s", resource.Name, fullName(user)), nil
+	case actionHoldFor, actionExtend:
+		text, err := applyHold(board, token, user, time.Now())
+
+		return nil, text, err
+	case actionQueue, actionSkip:
+		text, err := applyQueue(board, token, user, time.Now())
+
+		return nil, text, err
+	case actionReleaseMine, actionReleaseNow:
+		resource := board.resource(token.ResourceID)
+		if resource == nil {
+			return nil, "this item was removed from the board", errNotModified
 		}
 
-		buttons = append(
-			buttons,
-			models.InlineKeyboardButton{
-				CallbackData: minified,
-				Text:         notifyButtonPresent.Command,
-			},
-		)
+		if !board.releaseBy(resource, user.ID) {
+			return nil, fmt.Sprintf("you don't hold %s any more", resource.Name), errNotModified
+		}
 
-		kb.InlineKeyboard = [][]models.InlineKeyboardButton{buttons}
+		return resource, fmt.Sprintf("%s updated by %s", resource.Name, fullName(user)), nil
+	case actionRemove:
+		resource := board.resource(token.ResourceID)
+		if resource == nil {
+			return nil, "this item was removed from the board", errNotModified
+		}
 
-		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:      update.Message.Chat.ID,
-			Text:        messageText,
-			ReplyMarkup: kb,
-		})
+		if len(board.Resources) == 1 {
+			return nil, errLastResource.Error(), errNotModified
+		}
+
+		board.removeResource(resource.ID)
+
+		return nil, fmt.Sprintf("%s removed by %s", resource.Name, fullName(user)), nil
 	}
+
+	return nil, "", fmt.Errorf("unknown action %q", token.Action)
 }
 
-func showFlashMessage(ctx context.Context, b *bot.Bot, callbackQueryID, text string) {
-	// hide Loading... message and show who pressed button
-	_, _ = b.AnswerCallbackQuery(
-		ctx,
-		&bot.AnswerCallbackQueryParams{
-			CallbackQueryID: callbackQueryID,
-			Text:            text,
-		},
-	)
+// notifySubscribers sends new state of changed resource to everybody subscribed but user
+func notifySubscribers(ctx context.Context, b *bot.Bot, board *Board, changed *Resource, user models.User) {
+	if changed == nil {
+		return
+	}
+
+	for _, userID := range board.Notify {
+		if userID != user.ID {
+			_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: userID,
+				Text:   fmt.Sprintf("%s status updated by %s", board.stateText(changed), fullName(user)),
+			})
+		}
+	}
 }
 
-func minifyJson(input []byte) string {
-	r := bytes.NewBufferString(string(input))
-	w := &bytes.Buffer{}
+func handleCreate(ctx context.Context, b *bot.Bot, message *models.Message) {
+	log.Printf("message %#v from %d\n", message.Text, message.Chat.ID)
+
+	args := commandArgs(message.Text)
 
-	m := jsonminifier.Minifier{KeepNumbers: true}
+	// "/create @name" posts a saved template
+	if name, ok := strings.CutPrefix(args, "@"); ok && !strings.ContainsFunc(name, unicode.IsSpace) {
+		board, ok := templateBoard(ctx, b, message, name)
+		if !ok {
+			return
+		}
 
-	errMinify := m.Minify(nil, w, r, nil)
-	if errMinify != nil {
-		return string(input)
+		board.ChatTitle = message.Chat.Title
+
+		if _, err := postBoard(ctx, b, board, sender(message)); err != nil {
+			log.Printf("error on create board %s\n", err.Error())
+
+			replyText(ctx, b, message, "Failed to create buttons")
+		}
+
+		return
 	}
 
-	return w.String()
-}
+	// "/create [🟢free 🏗️busy 🔴broken] dev1 dev2" sets the states of the board
+	states, args, err := cutStates(args)
+	if err != nil {
+		replyText(ctx, b, message, fmt.Sprintf("can't create the board: %s", err))
 
-func checkStringLimit(input string, limit int) bool {
-	return utf8.RuneCountInString(input) <= limit
+		return
+	}
+
+	if stateless && len(states) > 0 {
+		replyText(ctx, b, message, "custom states need a storage, stateless boards are free or busy")
+
+		return
+	}
+
+	rows, err := parseRows(args)
+	if err != nil {
+		replyText(ctx, b, message, fmt.Sprintf("can't create the board: %s", err))
+
+		return
+	}
+
+	if len(rows) == 0 {
+		replyText(ctx, b, message, "you must send command in format /create name1 \"name 2\" nameN, | starts a new row")
+
+		return
+	}
+
+	if stateless && hasCapacity(rows) {
+		replyText(ctx, b, message, "shared items need a storage, stateless items are free or busy")
+
+		return
+	}
+
+	board := newBoard(message.Chat.ID, nil)
+	board.ChatTitle = message.Chat.Title
+	board.States = states
+
+	for _, row := range rows {
+		board.addRow(row)
+	}
+
+	if !stateless {
+		settings, err := boards.Settings(message.Chat.ID)
+		if err != nil {
+			log.Printf("error on chat settings %d: %s\n", message.Chat.ID, err)
+		} else {
+			board.Layout = settings.Layout
+		}
+	}
+
+	if _, err := postBoard(ctx, b, board, sender(message)); err != nil {
+		log.Printf("error on create board %s\n", err.Error())
+
+		replyText(ctx, b, message, "Failed to create buttons")
+	}
 }
 
-// shorten text on button to limit 64 chars
-func shortenUsername(command, name, lastname string) string {
-	// 18 chars is allocated to struct {"c": "", "u": ""}
+// postBoard sends a new message with the board to its chat and stores the board,
+// actor is who created it
+func postBoard(ctx context.Context, b *bot.Bot, board *Board, actor models.User) (*Board, error) {
+	if stateless {
+		kb, err := board.statelessKeyboard()
+		if err != nil {
+			return nil, err
+		}
 
-	name = toLatin(name)
-	lastname = toLatin(lastname)
+		sent, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      board.ChatID,
+			Text:        board.text(),
+			ReplyMarkup: kb,
+		})
+		if err != nil {
+			return nil, err
+		}
 
-	limit := 64 - 18 - len(command)
+		board.MessageID = sent.ID
 
-	if limit <= 0 {
-		return ""
+		return board, nil
 	}
 
-	if len(name) <= 0 && len(lastname) <= 0 {
-		return ""
+	if board.CreatedBy == 0 {
+		board.CreatedBy = actor.ID
 	}
 
-	if len(name)+len(lastname) < limit {
-		return name + " " + lastname
+	board, err := boards.Create(board, boardEvents(nil, board, actor)...)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(name) > 0 {
-		if len(name) < limit-3 {
-			return name + " " + string([]rune(lastname)[0:1]) + "."
+	sent, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      board.ChatID,
+		Text:        board.text(),
+		ReplyMarkup: board.keyboard(),
+	})
+	if err != nil {
+		if err := boards.Delete(board.ID, deleteEvent(board.ID, actor)); err != nil {
+			log.Printf("error on delete board %s: %s\n", board.ID, err)
 		}
 
-		if len(name) > limit {
-			if len([]rune(name)) >= limit {
-				return string([]rune(name)[0:limit])
-			}
+		return nil, err
+	}
+
+	posted := board.clone()
+	posted.MessageID = sent.ID
+
+	if err := boards.Save(posted, boardEvents(board, posted, actor)...); err != nil {
+		return nil, err
+	}
+
+	board = posted
+
+	refreshStatus(ctx, b, board.ChatID)
+
+	return board, nil
+}
+
+// editBoardMessage renders the board in its message and in the summary of the chat
+func editBoardMessage(ctx context.Context, b *bot.Bot, board *Board) {
+	defer refreshStatus(ctx, b, board.ChatID)
+
+	for attempt := 1; ; attempt++ {
+		editedMessage := &bot.EditMessageTextParams{
+			ChatID:      board.ChatID,
+			MessageID:   board.MessageID,
+			Text:        board.text(),
+			ReplyMarkup: board.keyboard(),
 		}
 
-		if len(lastname) > limit {
-			return string([]rune(lastname)[0:limit])
+		_, err := b.EditMessageText(ctx, editedMessage)
+		if err == nil || strings.Contains(err.Error(), "message is not modified") {
+			return
 		}
+
+		log.Printf("error on edit message %s, %#v %#v\n", err.Error(), editedMessage, editedMessage.ReplyMarkup)
+
+		if attempt == editAttempts || ctx.Err() != nil {
+			return
+		}
+
+		fresh, err := boards.Get(board.ID)
+		if err != nil {
+			return
+		}
+
+		board = fresh
+	}
+}
+
+// repliedBoard returns the stored board the message replies to
+func repliedBoard(message *models.Message) (*Board, bool) {
+	if message.ReplyToMessage == nil {
+		return nil, false
+	}
+
+	board, err := boards.GetByMessage(message.Chat.ID, message.ReplyToMessage.ID)
+	if err != nil {
+		return nil, false
+	}
+
+	return board, true
+}
+
+// commandWord is the command the text starts with, "/history@bot dev1"
+// gives "/history"
+func commandWord(text string) string {
+	text = strings.TrimSpace(text)
+
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		text = text[:i]
 	}
 
-	return ""
+	name, _, _ := strings.Cut(text, "@")
+
+	return name
+}
+
+// commandArgs returns text after the command, "/history@bot dev1" gives "dev1"
+func commandArgs(text string) string {
+	text = strings.TrimSpace(text)
+
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(text[i:])
+}
+
+// sender is the user who sent the message, channel posts have none
+func sender(message *models.Message) models.User {
+	if message.From == nil {
+		return models.User{}
+	}
+
+	return *message.From
+}
+
+func showFlashMessage(ctx context.Context, b *bot.Bot, callbackQueryID, text string) {
+	// hide Loading... message and show who pressed button
+	_, _ = b.AnswerCallbackQuery(
+		ctx,
+		&bot.AnswerCallbackQueryParams{
+			CallbackQueryID: callbackQueryID,
+			Text:            text,
+		},
+	)
+}
+
+func checkStringLimit(input string, limit int) bool {
+	return utf8.RuneCountInString(input) <= limit
 }
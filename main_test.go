@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -35,6 +41,26 @@ type getUpdatesResponse struct {
 }
 
 func (s *serverMock) handler(rw http.ResponseWriter, req *http.Request) {
+	reqBody, errReadBody := io.ReadAll(req.Body)
+	if errReadBody != nil {
+		panic(errReadBody)
+	}
+	defer req.Body.Close()
+
+	hook, okHook := s.hooks[req.URL.String()]
+	if okHook {
+		s.hooksCalls[req.URL.String()]++
+		resp, errData := json.Marshal(hook(reqBody))
+		if errData != nil {
+			panic(errData)
+		}
+		_, err := rw.Write(resp)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	if req.URL.String() == "/bottest_token/getMe" {
 		_, err := rw.Write([]byte(`{"ok":true,"result":{}}`))
 		if err != nil {
@@ -61,26 +87,6 @@ func (s *serverMock) handler(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	reqBody, errReadBody := io.ReadAll(req.Body)
-	if errReadBody != nil {
-		panic(errReadBody)
-	}
-	defer req.Body.Close()
-
-	hook, okHook := s.hooks[req.URL.String()]
-	if okHook {
-		s.hooksCalls[req.URL.String()]++
-		resp, errData := json.Marshal(hook(reqBody))
-		if errData != nil {
-			panic(errData)
-		}
-		_, err := rw.Write(resp)
-		if err != nil {
-			panic(err)
-		}
-		return
-	}
-
 	d, ok := s.custom[req.URL.String()]
 	if !ok {
 		panic("answer not found for request: " + req.URL.String())
@@ -124,6 +130,25 @@ func (s *serverMock) handlerGetUpdates(rw http.ResponseWriter) {
 	}
 }
 
+// formValue reads a field of the multipart form requests are sent in
+func formValue(body []byte, name string) string {
+	boundary, _, _ := bytes.Cut(body, []byte("\r\n"))
+	r := multipart.NewReader(bytes.NewReader(body), strings.TrimPrefix(string(boundary), "--"))
+
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			return ""
+		}
+
+		if part.FormName() == name {
+			data, _ := io.ReadAll(part)
+
+			return string(data)
+		}
+	}
+}
+
 func newServerMock() *serverMock {
 	s := &serverMock{
 		custom:     map[string]any{},
@@ -136,101 +161,6 @@ func newServerMock() *serverMock {
 	return s
 }
 
-func Test_shortenButtonText(t *testing.T) {
-	type args struct {
-		command  string
-		name     string
-		lastname string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
-		{
-			name: "empty",
-			args: args{
-				command:  "free-testing-1",
-				name:     "",
-				lastname: "",
-			},
-			want: "",
-		},
-		{
-			name: "normal",
-			args: args{
-				command:  "free-testing-1",
-				name:     "veryveryveryveryvery",
-				lastname: "veryveryveryveryveryveryveryvery2",
-			},
-			want: "veryveryveryveryvery v.",
-		},
-		{
-			name: "long",
-			args: args{
-				command:  "free-testing-1",
-				name:     "veryveryveryveryvery1",
-				lastname: "veryveryveryveryveryveryveryvery",
-			},
-			want: "veryveryveryveryvery1 v.",
-		},
-		{
-			name: "long name",
-			args: args{
-				command:  "free-testing-1",
-				name:     "veryveryveryveryveryveryveryveryveryveryveryvery",
-				lastname: "veryveryveryveryveryveryveryvery",
-			},
-			want: "veryveryveryveryveryveryveryvery",
-		},
-		{
-			name: "long lastname",
-			args: args{
-				command:  "free-testing-1",
-				name:     "1veryveryveryveryveryveryveryver",
-				lastname: "2veryveryveryveryveryveryveryveryveryveryveryveryveryveryveryveryveryveryveryveryveryveryveryvery",
-			},
-			want: "2veryveryveryveryveryveryveryver",
-		},
-		{
-			name: "normal",
-			args: args{
-				command:  "free-testing-1",
-				name:     "Firstname",
-				lastname: "Firstname",
-			},
-			want: "Firstname Firstname",
-		},
-		{
-			name: "normal cyrrilic",
-			args: args{
-				command:  "free-testing-1",
-				name:     "ИмяОтчество",
-				lastname: "Фамилия",
-			},
-			want: "UmяOтчecтвo Фamuлuя",
-		},
-		{
-			name: "long cyrrilic name",
-			args: args{
-				command:  "free-testing-1",
-				name:     "ИмяОтчество12345678901234567890123123123123123123123123123131231223131231231231312312123123123123123123123",
-				lastname: "Фамилия",
-			},
-			want: "UmяOтчecтвo123456789012345678901",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := shortenUsername(tt.args.command, tt.args.name, tt.args.lastname)
-
-			if got != tt.want {
-				t.Errorf("shortenUsername(%s, %s, %s) = %v, want %v", tt.args.command, tt.args.name, tt.args.lastname, got, tt.want)
-			}
-		})
-	}
-}
-
 func Test_handler(t *testing.T) {
 	s := newServerMock()
 	defer s.Close()
@@ -341,39 +271,6 @@ func Test_handler(t *testing.T) {
 	}
 }
 
-func Test_minifyJson(t *testing.T) {
-	type args struct {
-		input []byte
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
-		{
-			name: "good json",
-			args: args{
-				input: []byte(`{"c": "c"}`),
-			},
-			want: `{"c":"c"}`,
-		},
-		{
-			name: "bad json",
-			args: args{
-				input: []byte(`{"c": "c"`),
-			},
-			want: `{"c": "c"`,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := minifyJson(tt.args.input); got != tt.want {
-				t.Errorf("minifyJson() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func Test_checkStringLimit(t *testing.T) {
 	type args struct {
 		input string
@@ -409,3 +306,239 @@ func Test_checkStringLimit(t *testing.T) {
 		})
 	}
 }
+
+func Test_commandWord(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "", want: ""},
+		{text: "/add", want: "/add"},
+		{text: "/add@bot dev3", want: "/add"},
+		{text: "/address dev3", want: "/address"},
+		{text: "/releaseall\n", want: "/releaseall"},
+		{text: " /book\tdev1", want: "/book"},
+	}
+	for _, tt := range tests {
+		if got := commandWord(tt.text); got != tt.want {
+			t.Errorf("commandWord(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func Test_handlerBoard(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		return map[string]any{
+			"ok":     true,
+			"result": map[string]any{"message_id": 7, "chat": map[string]any{"id": 1}},
+		}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+
+	handler(ctx, b, &models.Update{
+		Message: &models.Message{
+			Text: "/create dev1 a-very-long-resource-name-that-did-not-fit-into-callback-data",
+			Chat: models.Chat{ID: 1},
+		},
+	})
+
+	board, err := boards.GetByMessage(1, 7)
+	if err != nil {
+		t.Fatalf("board was not stored")
+	}
+
+	presses := []struct {
+		user   models.User
+		button models.InlineKeyboardButton
+	}{
+		{
+			user:   models.User{ID: 2},
+			button: board.keyboard().InlineKeyboard[1][0],
+		},
+		{
+			user:   models.User{ID: 1, FirstName: "Veryveryveryveryvery", LastName: "Longlonglonglonglonglonglong"},
+			button: board.keyboard().InlineKeyboard[0][1],
+		},
+	}
+	for _, press := range presses {
+		handler(ctx, b, &models.Update{
+			CallbackQuery: &models.CallbackQuery{
+				Data: press.button.CallbackData,
+				From: press.user,
+				Message: models.MaybeInaccessibleMessage{
+					Type:    models.MaybeInaccessibleMessageTypeMessage,
+					Message: &models.Message{ID: 7, Chat: models.Chat{ID: 1}},
+				},
+			},
+		})
+	}
+
+	board, _ = boards.Get(board.ID)
+
+	holder := board.Resources[1].Holder
+	if holder == nil || holder.Name != "Veryveryveryveryvery Longlonglonglonglonglonglong" {
+		t.Errorf("holder = %#v", holder)
+	}
+
+	if len(board.Notify) != 1 || board.Notify[0] != 2 {
+		t.Errorf("notify = %v, want [2]", board.Notify)
+	}
+
+	// the board, the subscriber notified and the times of the hold offered
+	if s.hooksCalls["/bottest_token/sendMessage"] != 3 {
+		t.Errorf("sendMessage calls = %d, want 3", s.hooksCalls["/bottest_token/sendMessage"])
+	}
+}
+
+func Test_handleBoardCallback_race(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	s.custom["/bottest_token/sendMessage"] = map[string]any{"ok": true, "result": map[string]any{}}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	board, _ := boards.Create(newBoard(1, []string{"dev1"}))
+	board.MessageID = 100
+
+	if err := boards.Save(board); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	// everybody presses the same buttons of the same keyboard at once
+	kb := board.keyboard()
+	users := 50
+
+	wg := sync.WaitGroup{}
+	for i := 1; i <= users; i++ {
+		for _, button := range []models.InlineKeyboardButton{kb.InlineKeyboard[1][0], kb.InlineKeyboard[0][0]} {
+			wg.Add(1)
+
+			go func(user models.User, data string) {
+				defer wg.Done()
+
+				handler(context.Background(), b, &models.Update{
+					CallbackQuery: &models.CallbackQuery{
+						Data: data,
+						From: user,
+						Message: models.MaybeInaccessibleMessage{
+							Type:                models.MaybeInaccessibleMessageTypeInaccessibleMessage,
+							InaccessibleMessage: &models.InaccessibleMessage{MessageID: 100, Chat: models.Chat{ID: 1}},
+						},
+					},
+				})
+			}(models.User{ID: int64(i), FirstName: "user"}, button.CallbackData)
+		}
+	}
+
+	wg.Wait()
+
+	got, _ := boards.Get(board.ID)
+
+	// one version per applied press: all subscriptions and exactly one take
+	if want := board.Version + int64(users) + 1; got.Version != want {
+		t.Errorf("Version = %d, want %d", got.Version, want)
+	}
+
+	seen := map[int64]bool{}
+	for _, userID := range got.Notify {
+		seen[userID] = true
+	}
+
+	if len(got.Notify) != users || len(seen) != users {
+		t.Errorf("notify = %v, want %d unique users", got.Notify, users)
+	}
+
+	if got.Resources[0].Holder == nil {
+		t.Errorf("resource was not taken")
+	}
+
+	// a release on a keyboard drawn before the item changed hands twice
+	// must not free the hold of the new holder
+	a := models.User{ID: 1001, FirstName: "A"}
+	bUser := models.User{ID: 1002, FirstName: "B"}
+	c := models.User{ID: 1003, FirstName: "C"}
+
+	board, _ = boards.Create(newBoard(1, []string{"dev"}))
+	ctx := context.Background()
+	take := callbackToken{BoardID: board.ID, ResourceID: 1, Action: actionTake}
+
+	board, _, _ = pressButton(ctx, b, take, a, "")
+	stale, _ := parseCallbackToken(trustedCallbackData(1, board.keyboard().InlineKeyboard[0][0].CallbackData))
+
+	_, _, _ = pressButton(ctx, b, stale, a, "")
+	_, _, _ = pressButton(ctx, b, take, c, "")
+
+	if _, text, err := pressButton(ctx, b, stale, bUser, ""); !errors.Is(err, errNotModified) || text != "dev was taken again by C" {
+		t.Errorf("stale release = %q, %v", text, err)
+	}
+
+	if got, _ := boards.Get(board.ID); got.Resources[0].Holder == nil || got.Resources[0].Holder.ID != c.ID {
+		t.Errorf("holder = %#v, want C", got.Resources[0].Holder)
+	}
+
+	// nor the new hold of the same user who released and took it again
+	_, _, _ = pressButton(ctx, b, callbackToken{BoardID: board.ID, ResourceID: 1, Action: actionRelease}, c, "")
+	board, _, _ = pressButton(ctx, b, take, a, "")
+	stale, _ = parseCallbackToken(trustedCallbackData(1, board.keyboard().InlineKeyboard[0][0].CallbackData))
+
+	_, _, _ = pressButton(ctx, b, stale, a, "")
+	time.Sleep(2 * time.Millisecond)
+	_, _, _ = pressButton(ctx, b, take, a, "")
+
+	if _, text, err := pressButton(ctx, b, stale, bUser, ""); !errors.Is(err, errNotModified) || text != "dev was taken again by A" {
+		t.Errorf("stale release of a new hold = %q, %v", text, err)
+	}
+}
+
+func Test_handleCreate(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	replies := []string{}
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		replies = append(replies, formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 9, "chat": map[string]any{"id": 9}}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "/create", want: "you must send command in format /create name1 \"name 2\" nameN, | starts a new row"},
+		{text: "/create | |", want: "you must send command in format /create name1 \"name 2\" nameN, | starts a new row"},
+		{text: `/create dev1 "Staging EU`, want: `can't create the board: item 2 "Staging EU" has no closing quote`},
+		{text: "/create\ndev1\nDev1", want: `can't create the board: item 2 "Dev1" repeats item 1`},
+		{text: `/create "Staging EU" "Staging US" dev`, want: "🟢Staging EU  🟢Staging US  🟢dev"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			replies = replies[:0]
+
+			handler(context.Background(), b, &models.Update{Message: &models.Message{Text: tt.text, Chat: models.Chat{ID: 9}}})
+
+			if len(replies) != 1 || replies[0] != tt.want {
+				t.Errorf("replies = %q, want %q", replies, tt.want)
+			}
+		})
+	}
+}
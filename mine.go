@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// handleMine answers /mine in the private chat with the panel of everything
+// the user holds across chats
+func handleMine(ctx context.Context, b *bot.Bot, message *models.Message) {
+	if message.Chat.Type != models.ChatTypePrivate {
+		replyText(ctx, b, message, "send /mine to me in a private chat")
+
+		return
+	}
+
+	if stateless {
+		replyText(ctx, b, message, "the bot keeps no boards in stateless mode, look for 🏗️ in your chats")
+
+		return
+	}
+
+	text, kb, err := minePanel(sender(message).ID, time.Now())
+	if err != nil {
+		log.Printf("error on holds of %d: %s\n", message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	params := &bot.SendMessageParams{
+		ChatID: message.Chat.ID,
+		Text:   text,
+	}
+
+	if len(kb.InlineKeyboard) > 0 {
+		params.ReplyMarkup = kb
+	}
+
+	if _, err := b.SendMessage(ctx, params); err != nil {
+		log.Printf("error on send message %s\n", err)
+	}
+}
+
+// minePanel lists resources held by userID with a release button for each,
+// buttons are signed for the private chat, which has the ID of the user
+func minePanel(userID int64, now time.Time) (string, *models.InlineKeyboardMarkup, error) {
+	held, err := boards.HeldBy(userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	lines := []string{}
+	kb := &models.InlineKeyboardMarkup{}
+
+	for _, board := range held {
+		for _, resource := range board.Resources {
+			holder := resource.holderOf(userID)
+			if holder == nil {
+				continue
+			}
+
+			lines = append(lines, fmt.Sprintf("%s · %s · %s", board.itemText(resource), board.chatLabel(), heldFor(now.Sub(holder.Since))))
+
+			kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+				{
+					Text:         fmt.Sprintf("release %s · %s", resource.Name, board.chatLabel()),
+					CallbackData: signCallback(userID, callbackToken{BoardID: board.ID, ResourceID: resource.ID, Action: actionReleaseMine}.String()),
+				},
+			})
+		}
+	}
+
+	if len(lines) == 0 {
+		return "you hold nothing", kb, nil
+	}
+
+	return "you hold:\n" + strings.Join(lines, "\n"), kb, nil
+}
+
+// refreshMinePanel renders the panel the query was pressed in again
+func refreshMinePanel(ctx context.Context, b *bot.Bot, query *models.CallbackQuery) {
+	pressed := query.Message.Message
+	if pressed == nil {
+		return
+	}
+
+	text, kb, err := minePanel(query.From.ID, time.Now())
+	if err != nil {
+		log.Printf("error on holds of %d: %s\n", query.From.ID, err)
+
+		return
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      pressed.Chat.ID,
+		MessageID:   pressed.ID,
+		Text:        text,
+		ReplyMarkup: kb,
+	})
+	if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		log.Printf("error on edit message %s\n", err)
+	}
+}
+
+// chatLabel names the chat of the board for lists outside of it
+func (board *Board) chatLabel() string {
+	if board.ChatTitle != "" {
+		return board.ChatTitle
+	}
+
+	return "chat " + strconv.FormatInt(board.ChatID, 10)
+}
+
+// heldFor is a short human duration, "2h 5m"
+func heldFor(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+
+	return fmt.Sprintf("%dd %dh", int(d.Hours())/24, int(d.Hours())%24)
+}
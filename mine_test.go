@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_heldFor(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 30 * time.Second, want: "just now"},
+		{d: 5 * time.Minute, want: "5m"},
+		{d: 2*time.Hour + 5*time.Minute, want: "2h 5m"},
+		{d: 50 * time.Hour, want: "2d 2h"},
+	}
+	for _, tt := range tests {
+		if got := heldFor(tt.d); got != tt.want {
+			t.Errorf("heldFor(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func Test_handleMine(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	var (
+		replies []string
+		markup  string
+		edits   []string
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		replies = append(replies, formValue(body, "text"))
+		markup = formValue(body, "reply_markup")
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	user := models.User{ID: 11, FirstName: "Bob"}
+	other := models.User{ID: 12, FirstName: "Eve"}
+
+	team := newBoard(-110, []string{"dev1", "dev2"})
+	team.ChatTitle = "Team"
+	team.MessageID = 1100
+	team.take(team.Resources[0], user)
+	team.take(team.Resources[1], other)
+	team.Resources[0].Holder.Since = time.Now().Add(-2*time.Hour - 5*time.Minute)
+	team, _ = boards.Create(team)
+
+	ops := newBoard(-111, []string{"qa"})
+	ops.MessageID = 1110
+	ops.take(ops.Resources[0], user)
+	_, _ = boards.Create(ops)
+
+	private := models.Chat{ID: user.ID, Type: models.ChatTypePrivate}
+
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/mine", Chat: models.Chat{ID: -110, Type: models.ChatTypeSupergroup}, From: &user}})
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/mine", Chat: private, From: &user}})
+
+	want := []string{
+		"send /mine to me in a private chat",
+		"you hold:\n🏗️dev1 (Bob) · Team · 2h 5m\n🏗️qa (Bob) · chat -111 · just now",
+	}
+	if fmt.Sprint(replies) != fmt.Sprint(want) {
+		t.Fatalf("replies = %q, want %q", replies, want)
+	}
+
+	panel := &models.InlineKeyboardMarkup{}
+	if err := json.Unmarshal([]byte(markup), panel); err != nil || len(panel.InlineKeyboard) != 2 {
+		t.Fatalf("panel = %q, %v", markup, err)
+	}
+
+	press := func(button models.InlineKeyboardButton) {
+		handler(ctx, b, &models.Update{
+			CallbackQuery: &models.CallbackQuery{
+				Data: button.CallbackData,
+				From: user,
+				Message: models.MaybeInaccessibleMessage{
+					Type:    models.MaybeInaccessibleMessageTypeMessage,
+					Message: &models.Message{ID: 5, Chat: private},
+				},
+			},
+		})
+	}
+
+	edits = nil
+
+	press(panel.InlineKeyboard[0][0])
+
+	want = []string{"-110: 🟢dev1  🏗️dev2 (Eve)", "11: you hold:\n🏗️qa (Bob) · chat -111 · just now"}
+	if fmt.Sprint(edits) != fmt.Sprint(want) {
+		t.Errorf("edits = %q, want %q", edits, want)
+	}
+
+	// somebody took it since, the stale button does not release their hold
+	_, _ = updateBoard(boards, team.ID, other, func(board *Board) error {
+		board.take(board.Resources[0], other)
+
+		return nil
+	})
+
+	press(panel.InlineKeyboard[0][0])
+
+	if got, _ := boards.Get(team.ID); got.Resources[0].Holder == nil || got.Resources[0].Holder.ID != other.ID {
+		t.Errorf("hold of another user was released: %#v", got.Resources[0].Holder)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// longest resource name in runes
+const maxNameLength = 64
+
+// rowSeparator starts a new row of buttons in a list of names
+const rowSeparator = '|'
+
+// nameError points at the item of a name list that can't be used
+type nameError struct {
+	Item   int // 1-based position in the list
+	Name   string
+	Reason string
+}
+
+func (e *nameError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("item %d %s", e.Item, e.Reason)
+	}
+
+	return fmt.Sprintf("item %d %q %s", e.Item, e.Name, e.Reason)
+}
+
+// parseNames splits command arguments into resource names, rows are ignored
+func parseNames(args string) ([]string, error) {
+	rows, err := parseRows(args)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, row := range rows {
+		names = append(names, row...)
+	}
+
+	return names, nil
+}
+
+// parseRows splits command arguments into rows of resource names. Names are
+// separated by spaces, "double quoted" names may contain spaces, \" and \\
+// are escapes, a | starts a new row. When the arguments span several lines
+// every line is one name and an empty line or a | line starts a new row.
+// Whitespace inside a name collapses into a single space.
+func parseRows(args string) ([][]string, error) {
+	var (
+		rows [][]string
+		err  error
+	)
+
+	if strings.Contains(args, "\n") {
+		rows = splitLines(args)
+	} else if rows, err = splitQuoted(args); err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+
+	for _, row := range rows {
+		for _, name := range row {
+			item := len(names) + 1
+
+			if name == "" {
+				return nil, &nameError{Item: item, Reason: "is empty"}
+			}
+
+			if utf8.RuneCountInString(name) > maxNameLength {
+				return nil, &nameError{Item: item, Name: name, Reason: fmt.Sprintf("is longer than %d characters", maxNameLength)}
+			}
+
+			// "licenses*5" is licenses with 5 slots
+			base, _ := splitCapacity(name)
+
+			for j, other := range names {
+				if other, _ = splitCapacity(other); strings.EqualFold(other, base) {
+					return nil, &nameError{Item: item, Name: name, Reason: fmt.Sprintf("repeats item %d", j+1)}
+				}
+			}
+
+			names = append(names, name)
+		}
+	}
+
+	return rows, nil
+}
+
+func splitLines(args string) [][]string {
+	rows := [][]string{{}}
+
+	for _, line := range strings.Split(args, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" || line == string(rowSeparator) {
+			rows = append(rows, []string{})
+
+			continue
+		}
+
+		rows[len(rows)-1] = append(rows[len(rows)-1], collapseSpaces(line))
+	}
+
+	return dropEmptyRows(rows)
+}
+
+func splitQuoted(args string) ([][]string, error) {
+	var (
+		rows    = [][]string{{}}
+		current strings.Builder
+		inName  bool
+		quoted  bool
+		escaped bool
+	)
+
+	endName := func() {
+		if inName {
+			rows[len(rows)-1] = append(rows[len(rows)-1], collapseSpaces(current.String()))
+			current.Reset()
+		}
+
+		inName = false
+	}
+
+	for _, r := range args {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+
+			escaped = false
+		case r == '\\':
+			inName, escaped = true, true
+		case r == '"' && quoted:
+			quoted = false
+		case r == '"' && !inName:
+			inName, quoted = true, true
+		case r == rowSeparator && !quoted:
+			endName()
+
+			rows = append(rows, []string{})
+		case unicode.IsSpace(r) && !quoted:
+			endName()
+		default:
+			current.WriteRune(r)
+
+			inName = true
+		}
+	}
+
+	if escaped {
+		current.WriteRune('\\')
+	}
+
+	if quoted {
+		item := 1
+		for _, row := range rows {
+			item += len(row)
+		}
+
+		return nil, &nameError{Item: item, Name: collapseSpaces(current.String()), Reason: "has no closing quote"}
+	}
+
+	endName()
+
+	return dropEmptyRows(rows), nil
+}
+
+// dropEmptyRows removes rows left by repeated or trailing separators
+func dropEmptyRows(rows [][]string) [][]string {
+	kept := [][]string{}
+
+	for _, row := range rows {
+		if len(row) > 0 {
+			kept = append(kept, row)
+		}
+	}
+
+	return kept
+}
+
+func collapseSpaces(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_parseNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		want    string
+		wantErr string
+	}{
+		{name: "empty", args: "", want: "[]"},
+		{name: "words", args: "dev1   dev2\tdev3", want: `["dev1" "dev2" "dev3"]`},
+		{name: "quoted", args: `dev1 "Staging  EU" prod`, want: `["dev1" "Staging EU" "prod"]`},
+		{name: "escapes", args: `"say \"hi\"" back\\slash a\ b`, want: `["say \"hi\"" "back\\slash" "a b"]`},
+		{name: "trailing backslash", args: `dev\`, want: `["dev\\"]`},
+		{name: "lines", args: "Staging EU\n\n  prod \"main\"  \nqa", want: `["Staging EU" "prod \"main\"" "qa"]`},
+		{name: "unterminated quote", args: `dev1 "Staging EU`, wantErr: `item 2 "Staging EU" has no closing quote`},
+		{name: "empty quotes", args: `dev1 ""`, wantErr: "item 2 is empty"},
+		{name: "duplicate", args: "dev1 dev2 DEV1", wantErr: `item 3 "DEV1" repeats item 1`},
+		{name: "too long", args: "dev1 " + strings.Repeat("я", maxNameLength+1), wantErr: "item 2 \"" + strings.Repeat("я", maxNameLength+1) + "\" is longer than 64 characters"},
+		{name: "longest", args: strings.Repeat("я", maxNameLength), want: fmt.Sprintf("[%q]", strings.Repeat("я", maxNameLength))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNames(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("parseNames() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseNames() error = %v", err)
+			}
+
+			if fmt.Sprintf("%q", got) != tt.want {
+				t.Errorf("parseNames() = %q, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_commandArgs(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "/create", want: ""},
+		{text: "/create@bot dev1 dev2 ", want: "dev1 dev2"},
+		{text: "/create\nStaging EU\nprod", want: "Staging EU\nprod"},
+	}
+	for _, tt := range tests {
+		if got := commandArgs(tt.text); got != tt.want {
+			t.Errorf("commandArgs(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+// a released resource is kept for the first in line this long
+const offerWindow = 10 * time.Minute
+
+// Waiter is a user lined up for a busy resource
+type Waiter struct {
+	ID    int64     `json:"id"`
+	Name  string    `json:"name,omitempty"`
+	Since time.Time `json:"since"`
+	// OfferedUntil is set when the resource was released for the waiter,
+	// nobody else can take it until then
+	OfferedUntil time.Time `json:"offered_until,omitzero"`
+	// Told is set once the waiter was sent the offer
+	Told bool `json:"told,omitempty"`
+}
+
+// joinQueue lines user up for the resource, returns the place in line
+// or 0 if the user is in line already
+func (resource *Resource) joinQueue(user models.User, now time.Time) int {
+	if resource.queuePlace(user.ID) > 0 {
+		return 0
+	}
+
+	resource.Queue = append(resource.Queue, &Waiter{ID: user.ID, Name: fullName(user), Since: now})
+
+	return len(resource.Queue)
+}
+
+// leaveQueue removes the user from the line, the resource kept for them
+// is offered to the next one
+func (resource *Resource) leaveQueue(userID int64) bool {
+	i := resource.queuePlace(userID) - 1
+	if i < 0 {
+		return false
+	}
+
+	resource.Queue = slices.Delete(resource.Queue, i, i+1)
+
+	if i == 0 && resource.Holder == nil {
+		resource.offer(time.Now())
+	}
+
+	return true
+}
+
+// queuePlace is the place of the user in line starting from 1, 0 if not in it
+func (resource *Resource) queuePlace(userID int64) int {
+	return slices.IndexFunc(resource.Queue, func(w *Waiter) bool { return w.ID == userID }) + 1
+}
+
+// offer keeps the free resource for the first in line
+func (resource *Resource) offer(now time.Time) {
+	if resource.Holder != nil || len(resource.Queue) == 0 || !resource.Queue[0].OfferedUntil.IsZero() {
+		return
+	}
+
+	resource.Queue[0].OfferedUntil = now.Add(offerWindow)
+	resource.Queue[0].Told = false
+}
+
+// offeredTo is the waiter the free resource is kept for
+func (resource *Resource) offeredTo() *Waiter {
+	if resource.Holder != nil || len(resource.Queue) == 0 || resource.Queue[0].OfferedUntil.IsZero() {
+		return nil
+	}
+
+	return resource.Queue[0]
+}
+
+// queueText shows how many wait for the resource, besides the one it is kept for
+func (resource *Resource) queueText() string {
+	waiting := len(resource.Queue)
+	if resource.offeredTo() != nil {
+		waiting--
+	}
+
+	if waiting == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" ⏳%d", waiting)
+}
+
+// applyQueue joins or leaves the line for a busy resource, or skips the
+// turn of the presser when the resource is kept for them
+func applyQueue(board *Board, token callbackToken, user models.User, now time.Time) (string, error) {
+	resource := board.resource(token.ResourceID)
+	if resource == nil {
+		return "this item was removed from the board", errNotModified
+	}
+
+	if token.Action == actionSkip {
+		waiter := resource.offeredTo()
+		if waiter == nil || waiter.ID != user.ID {
+			return fmt.Sprintf("%s is not kept for you any more", resource.Name), errNotModified
+		}
+
+		resource.leaveQueue(user.ID)
+		board.UpdatedAt = now
+
+		return fmt.Sprintf("you skipped %s", resource.Name), nil
+	}
+
+	switch {
+	case resource.shared():
+		return fmt.Sprintf("%s is shared, there is no line for its slots", resource.Name), errNotModified
+	case resource.Holder != nil && resource.Holder.ID == user.ID:
+		return fmt.Sprintf("you hold %s already", resource.Name), errNotModified
+	case resource.leaveQueue(user.ID):
+		board.UpdatedAt = now
+
+		return fmt.Sprintf("you left the line for %s", resource.Name), nil
+	case resource.Holder == nil && resource.offeredTo() == nil:
+		return fmt.Sprintf("%s is free, take it", resource.Name), errNotModified
+	}
+
+	place := resource.joinQueue(user, now)
+	board.UpdatedAt = now
+
+	return fmt.Sprintf("you are number %d in line for %s", place, resource.Name), nil
+}
+
+// sendOffers tells waiters a resource is kept for them, with buttons to
+// take or skip it. Waiters the bot can't write to lose their turn.
+// Must be called with the board locked.
+func sendOffers(ctx context.Context, b *bot.Bot, boardID string) {
+	for {
+		board, err := boards.Get(boardID)
+		if err != nil {
+			return
+		}
+
+		var (
+			resource *Resource
+			waiter   *Waiter
+		)
+
+		for _, r := range board.Resources {
+			if w := r.offeredTo(); w != nil && !w.Told {
+				resource, waiter = r, w
+
+				break
+			}
+		}
+
+		if resource == nil {
+			return
+		}
+
+		button := func(text, action string) models.InlineKeyboardButton {
+			return models.InlineKeyboardButton{
+				Text:         text,
+				CallbackData: signCallback(waiter.ID, callbackToken{BoardID: board.ID, ResourceID: resource.ID, Action: action}.String()),
+			}
+		}
+
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: waiter.ID,
+			Text:   fmt.Sprintf("%s · %s is free, it's yours until %s", resource.Name, board.chatLabel(), waiter.OfferedUntil.Local().Format("15:04")),
+			ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+				{button("take "+resource.Name, actionTake), button("skip", actionSkip)},
+			}},
+		})
+
+		told := err == nil
+		if !told {
+			log.Printf("error on offer %s to %d: %s\n", resource.Name, waiter.ID, err)
+		}
+
+		board, err = updateBoard(boards, boardID, models.User{}, func(board *Board) error {
+			r := board.resource(resource.ID)
+			if r == nil || r.offeredTo() == nil || r.offeredTo().ID != waiter.ID {
+				return errNotModified
+			}
+
+			if told {
+				r.offeredTo().Told = true
+			} else {
+				r.leaveQueue(waiter.ID)
+			}
+
+			return nil
+		})
+		if err != nil {
+			if !errors.Is(err, errNotModified) {
+				log.Printf("error on offer %s: %s\n", boardID, err)
+			}
+
+			return
+		}
+
+		if !told {
+			editBoardMessage(ctx, b, board)
+		}
+	}
+}
+
+// expireOffers takes the turn away from waiters who did not answer in time
+// and offers the resources to the next ones
+func expireOffers(ctx context.Context, b *bot.Bot, boardID string, now time.Time) {
+	unlock := boardLocks.Lock(boardID)
+	defer unlock()
+
+	var missed []*Waiter
+
+	board, err := updateBoard(boards, boardID, models.User{}, func(board *Board) error {
+		missed = nil
+
+		for _, resource := range board.Resources {
+			if waiter := resource.offeredTo(); waiter != nil && !now.Before(waiter.OfferedUntil) {
+				missed = append(missed, waiter)
+				resource.leaveQueue(waiter.ID)
+			}
+		}
+
+		if len(missed) == 0 {
+			return errNotModified
+		}
+
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errNotModified) {
+			log.Printf("error on expire offers of %s: %s\n", boardID, err)
+		}
+
+		return
+	}
+
+	for _, waiter := range missed {
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: waiter.ID,
+			Text:   fmt.Sprintf("your turn passed · %s", board.chatLabel()),
+		})
+	}
+
+	editBoardMessage(ctx, b, board)
+	sendOffers(ctx, b, boardID)
+}
+
+// replyQueueButton replies to /take of a busy resource with a button
+// to line up for it, anyone in the chat may press it
+func replyQueueButton(ctx context.Context, b *bot.Bot, message *models.Message, text string, board *Board, resource *Resource) {
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: message.Chat.ID,
+		Text:   text,
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{
+				{
+					Text:         "⏳ line up for " + resource.Name,
+					CallbackData: signCallback(message.Chat.ID, callbackToken{BoardID: board.ID, ResourceID: resource.ID, Action: actionQueue}.String()),
+				},
+			},
+		}},
+	})
+	if err != nil {
+		log.Printf("error on send message %s\n", err)
+	}
+}
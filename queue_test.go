@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_applyQueue(t *testing.T) {
+	now := time.Date(2024, 5, 6, 15, 0, 0, 0, time.Local)
+	ann := models.User{ID: 1, FirstName: "Ann"}
+	bob := models.User{ID: 2, FirstName: "Bob"}
+	cid := models.User{ID: 3, FirstName: "Cid"}
+
+	board := newBoard(1, []string{"dev1", "dev2"})
+	board.take(board.Resources[0], ann)
+
+	tests := []struct {
+		name    string
+		token   callbackToken
+		user    models.User
+		want    string
+		wantErr bool
+	}{
+		{name: "holder", token: callbackToken{ResourceID: 1, Action: actionQueue}, user: ann, want: "you hold dev1 already", wantErr: true},
+		{name: "free", token: callbackToken{ResourceID: 2, Action: actionQueue}, user: bob, want: "dev2 is free, take it", wantErr: true},
+		{name: "join", token: callbackToken{ResourceID: 1, Action: actionQueue}, user: bob, want: "you are number 1 in line for dev1"},
+		{name: "join second", token: callbackToken{ResourceID: 1, Action: actionQueue}, user: cid, want: "you are number 2 in line for dev1"},
+		{name: "skip before the release", token: callbackToken{ResourceID: 1, Action: actionSkip}, user: bob, want: "dev1 is not kept for you any more", wantErr: true},
+		{name: "removed", token: callbackToken{ResourceID: 5, Action: actionQueue}, user: bob, want: "this item was removed from the board", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyQueue(board, tt.token, tt.user, now)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("applyQueue() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if got := board.itemText(board.Resources[0]); got != "🏗️dev1 (Ann) ⏳2" {
+		t.Errorf("itemText() = %q", got)
+	}
+
+	board.release(board.Resources[0])
+
+	waiter := board.Resources[0].offeredTo()
+	if waiter == nil || waiter.ID != bob.ID {
+		t.Fatalf("offeredTo() = %#v", waiter)
+	}
+
+	if want := "🟢dev1 (kept for Bob until " + waiter.OfferedUntil.Local().Format("15:04") + ") ⏳1"; board.itemText(board.Resources[0]) != want {
+		t.Errorf("itemText() = %q, want %q", board.itemText(board.Resources[0]), want)
+	}
+
+	if board.take(board.Resources[0], cid) {
+		t.Errorf("the item kept for Bob is taken by Cid")
+	}
+
+	if got, err := applyQueue(board, callbackToken{ResourceID: 1, Action: actionSkip}, bob, now); got != "you skipped dev1" || err != nil {
+		t.Errorf("applyQueue(skip) = %q, %v", got, err)
+	}
+
+	if waiter := board.Resources[0].offeredTo(); waiter == nil || waiter.ID != cid.ID {
+		t.Fatalf("offeredTo() after skip = %#v", waiter)
+	}
+
+	if !board.take(board.Resources[0], cid) || len(board.Resources[0].Queue) != 0 {
+		t.Errorf("resource = %#v", board.Resources[0])
+	}
+}
+
+func Test_applyAction_busyButton(t *testing.T) {
+	ann := models.User{ID: 1, FirstName: "Ann"}
+	bob := models.User{ID: 2, FirstName: "Bob"}
+
+	board := newBoard(1, []string{"dev1"})
+	resource := board.Resources[0]
+	board.take(resource, ann)
+
+	tests := []struct {
+		name    string
+		token   callbackToken
+		user    models.User
+		want    string
+		wantErr bool
+	}{
+		{name: "press by another user", token: board.pressToken(resource), user: bob, want: "you are number 1 in line for dev1"},
+		{name: "release by another user", token: callbackToken{ResourceID: 1, Action: actionRelease}, user: bob, want: "dev1 is taken by Ann, only they can release it", wantErr: true},
+		{name: "press by the holder", token: board.pressToken(resource), user: ann, want: "dev1 updated by Ann"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got, err := applyAction(board, tt.token, tt.user)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("applyAction() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if waiter := resource.offeredTo(); resource.Holder != nil || waiter == nil || waiter.ID != bob.ID {
+		t.Errorf("resource = %#v, offered to %#v", resource, waiter)
+	}
+}
+
+func Test_handleQueue(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	const chatID = 230
+
+	var (
+		messages []string
+		markups  []string
+		edits    []string
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "chat_id")+": "+formValue(body, "text"))
+		markups = append(markups, formValue(body, "reply_markup"))
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 2300, "chat": map[string]any{"id": chatID}}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	ann := &models.User{ID: 23, FirstName: "Ann"}
+	bob := &models.User{ID: 24, FirstName: "Bob"}
+	cid := &models.User{ID: 25, FirstName: "Cid"}
+
+	send := func(from *models.User, text string) {
+		messages, markups, edits = nil, nil, nil
+
+		handler(ctx, b, &models.Update{Message: &models.Message{Text: text, Chat: models.Chat{ID: chatID}, From: from}})
+	}
+	press := func(from *models.User, chat models.Chat, markup string) {
+		messages, markups, edits = nil, nil, nil
+
+		kb := &models.InlineKeyboardMarkup{}
+		if err := json.Unmarshal([]byte(markup), kb); err != nil || len(kb.InlineKeyboard) == 0 {
+			t.Fatalf("markup = %q, %v", markup, err)
+		}
+
+		handler(ctx, b, &models.Update{
+			CallbackQuery: &models.CallbackQuery{
+				Data: kb.InlineKeyboard[0][len(kb.InlineKeyboard[0])-1].CallbackData,
+				From: *from,
+				Message: models.MaybeInaccessibleMessage{
+					Type:    models.MaybeInaccessibleMessageTypeMessage,
+					Message: &models.Message{ID: 2301, Chat: chat},
+				},
+			},
+		})
+	}
+
+	send(ann, "/queue")
+
+	if want := "[230: you must send command in format /queue name]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	send(ann, "/create dev1 dev2")
+	send(ann, "/take dev1")
+
+	// the reply to a take of a busy item lines up whoever presses it
+	send(bob, "/take dev1")
+
+	if want := "[230: dev1 was already taken by Ann]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	press(bob, models.Chat{ID: chatID}, markups[0])
+
+	send(cid, "/queue dev1")
+
+	if want := "[230: you are number 2 in line for dev1]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	if want := "[230: 🏗️dev1 (Ann) ⏳2  🟢dev2]"; fmt.Sprint(edits) != want {
+		t.Errorf("edits = %q, want %q", edits, want)
+	}
+
+	// the first in line is offered the released item
+	send(ann, "/release dev1")
+
+	board, _ := boards.GetByMessage(chatID, 2300)
+	waiter := board.Resources[0].offeredTo()
+
+	if waiter == nil || waiter.ID != bob.ID || !waiter.Told {
+		t.Fatalf("offeredTo() = %#v", waiter)
+	}
+
+	offer, until := markups[0], waiter.OfferedUntil.Local().Format("15:04")
+	wantMessages := []string{
+		"24: dev1 · chat 230 is free, it's yours until " + until,
+		"230: dev1 updated by Ann",
+	}
+
+	if fmt.Sprint(messages) != fmt.Sprint(wantMessages) {
+		t.Errorf("messages = %q, want %q", messages, wantMessages)
+	}
+
+	send(cid, "/take dev1")
+
+	if want := "[230: dev1 is kept for Bob, the first in line]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	// skip passes the turn to the next one
+	press(bob, models.Chat{ID: bob.ID, Type: models.ChatTypePrivate}, offer)
+
+	if want := "[25: dev1 · chat 230 is free, it's yours until " + until + "]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	// the turn passes when the offer is not answered in time
+	messages, edits = nil, nil
+
+	checkHolds(ctx, b, time.Now().Add(offerWindow+time.Minute))
+
+	if want := "[25: your turn passed · chat 230]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	if want := "[230: 🟢dev1  🟢dev2]"; fmt.Sprint(edits) != want {
+		t.Errorf("edits = %q, want %q", edits, want)
+	}
+}
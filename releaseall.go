@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// releasedOn is what one board lost in /releaseall
+type releasedOn struct {
+	Board     *Board
+	Resources []*Resource
+}
+
+// handleReleaseAll answers /releaseall, frees everything the user holds on
+// boards of the chat, or in all chats when sent in the private chat
+func handleReleaseAll(ctx context.Context, b *bot.Bot, message *models.Message) {
+	if stateless {
+		replyText(ctx, b, message, "the bot keeps no boards in stateless mode, release items with the buttons")
+
+		return
+	}
+
+	chatID := message.Chat.ID
+	if message.Chat.Type == models.ChatTypePrivate {
+		chatID = 0
+	}
+
+	user := sender(message)
+
+	released, err := releaseAll(ctx, b, user, chatID)
+	if err != nil {
+		log.Printf("error on release all of %d: %s\n", user.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	if len(released) == 0 {
+		replyText(ctx, b, message, "you hold nothing here")
+
+		return
+	}
+
+	notifyReleased(ctx, b, released, user)
+
+	names := []string{}
+
+	for _, r := range released {
+		for _, resource := range r.Resources {
+			if chatID == 0 {
+				names = append(names, fmt.Sprintf("%s · %s", resource.Name, r.Board.chatLabel()))
+			} else {
+				names = append(names, resource.Name)
+			}
+		}
+	}
+
+	replyText(ctx, b, message, "released "+strings.Join(names, ", "))
+}
+
+// releaseAll releases resources held by user on boards of the chat, of all
+// chats if chatID is 0, and renders every changed board
+func releaseAll(ctx context.Context, b *bot.Bot, user models.User, chatID int64) ([]releasedOn, error) {
+	held, err := boards.HeldBy(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	released := []releasedOn{}
+
+	for _, board := range held {
+		if chatID != 0 && board.ChatID != chatID {
+			continue
+		}
+
+		r, err := releaseBoard(ctx, b, board.ID, user)
+
+		switch {
+		case errors.Is(err, errNotModified), errors.Is(err, errBoardNotFound):
+			// released or removed since it was listed
+		case err != nil:
+			return released, err
+		default:
+			released = append(released, r)
+		}
+	}
+
+	return released, nil
+}
+
+func releaseBoard(ctx context.Context, b *bot.Bot, boardID string, user models.User) (releasedOn, error) {
+	unlock := boardLocks.Lock(boardID)
+	defer unlock()
+
+	var changed []*Resource
+
+	board, err := updateBoard(boards, boardID, user, func(board *Board) error {
+		changed = nil
+
+		for _, resource := range board.Resources {
+			if board.releaseBy(resource, user.ID) {
+				changed = append(changed, resource)
+			}
+		}
+
+		if len(changed) == 0 {
+			return errNotModified
+		}
+
+		return nil
+	})
+	if err != nil {
+		return releasedOn{}, err
+	}
+
+	editBoardMessage(ctx, b, board)
+	sendOffers(ctx, b, board.ID)
+
+	return releasedOn{Board: board, Resources: changed}, nil
+}
+
+// notifyReleased sends every subscriber one message with all released
+// resources of boards they are subscribed to
+func notifyReleased(ctx context.Context, b *bot.Bot, released []releasedOn, user models.User) {
+	var subscribers []int64
+
+	items := map[int64][]string{}
+
+	for _, r := range released {
+		for _, userID := range r.Board.Notify {
+			if userID == user.ID {
+				continue
+			}
+
+			if _, ok := items[userID]; !ok {
+				subscribers = append(subscribers, userID)
+			}
+
+			for _, resource := range r.Resources {
+				items[userID] = append(items[userID], r.Board.buttonText(resource))
+			}
+		}
+	}
+
+	for _, userID := range subscribers {
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: userID,
+			Text:   fmt.Sprintf("%s status updated by %s", strings.Join(items[userID], ", "), fullName(user)),
+		})
+	}
+}
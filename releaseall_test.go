@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+func Test_handleReleaseAll(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	var messages, edits []string
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "message_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	user := models.User{ID: 21, FirstName: "Ann"}
+	other := models.User{ID: 24, FirstName: "Eve"}
+
+	create := func(chatID int64, messageID int, names []string, subscriber int64, held ...int) {
+		board := newBoard(chatID, names)
+		board.MessageID = messageID
+		board.Notify = []int64{subscriber, user.ID}
+
+		for i, resource := range board.Resources {
+			holder := other
+			if slices.Contains(held, i) {
+				holder = user
+			}
+
+			board.take(resource, holder)
+		}
+
+		_, _ = boards.Create(board)
+	}
+
+	create(-210, 2101, []string{"dev1", "dev2"}, 22, 0)
+	create(-210, 2102, []string{"qa"}, 22, 0)
+	create(-211, 2111, []string{"ops", "db"}, 23, 0, 1)
+	create(-212, 2121, []string{"stage"}, 22)
+
+	group := models.Chat{ID: -210, Type: models.ChatTypeSupergroup}
+	private := models.Chat{ID: user.ID, Type: models.ChatTypePrivate}
+
+	tests := []struct {
+		name      string
+		chat      models.Chat
+		want      []string
+		wantEdits []string
+	}{
+		{
+			name:      "boards of the group",
+			chat:      group,
+			want:      []string{"22: 🟢dev1, 🟢qa status updated by Ann", "-210: released dev1, qa"},
+			wantEdits: []string{"2101: 🟢dev1  🏗️dev2 (Eve)", "2102: 🟢qa"},
+		},
+		{
+			name:      "nothing left in the group",
+			chat:      group,
+			want:      []string{"-210: you hold nothing here"},
+			wantEdits: nil,
+		},
+		{
+			name:      "all chats",
+			chat:      private,
+			want:      []string{"23: 🟢ops, 🟢db status updated by Ann", "21: released ops · chat -211, db · chat -211"},
+			wantEdits: []string{"2111: 🟢ops  🟢db"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, edits = nil, nil
+
+			handler(context.Background(), b, &models.Update{Message: &models.Message{Text: "/releaseall", Chat: tt.chat, From: &user}})
+
+			if fmt.Sprint(messages) != fmt.Sprint(tt.want) {
+				t.Errorf("messages = %q, want %q", messages, tt.want)
+			}
+
+			if fmt.Sprint(edits) != fmt.Sprint(tt.wantEdits) {
+				t.Errorf("edits = %q, want %q", edits, tt.wantEdits)
+			}
+		})
+	}
+
+	if list, _ := boards.HeldBy(other.ID); len(list) != 2 {
+		t.Errorf("holds of another user were released, %d boards left", len(list))
+	}
+}
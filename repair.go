@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// handleRepair answers /repair sent as a reply to a board: the board is taken
+// from the store or, when the bot does not know it, rebuilt from the callback
+// data of its buttons, then text and keyboard are rendered again
+func handleRepair(ctx context.Context, b *bot.Bot, message *models.Message) {
+	broken := message.ReplyToMessage
+	if broken == nil {
+		replyText(ctx, b, message, "reply /repair to a board message")
+
+		return
+	}
+
+	unlock := boardLocks.Lock(fmt.Sprintf("%d/%d", broken.Chat.ID, broken.ID))
+	defer unlock()
+
+	board, corrections, err := repairedBoard(broken, sender(message))
+	if err != nil {
+		log.Printf("error on repair %d/%d: %s\n", broken.Chat.ID, broken.ID, err)
+
+		replyText(ctx, b, message, "can't find a board in this message")
+
+		return
+	}
+
+	if !stateless {
+		// presses lock the board by ID, take its state once they are done
+		unlockBoard := boardLocks.Lock(board.ID)
+		defer unlockBoard()
+
+		if fresh, err := boards.Get(board.ID); err == nil {
+			board = fresh
+		}
+	}
+
+	kb, err := renderKeyboard(board)
+	if err != nil {
+		log.Printf("error on repair %d/%d: %s\n", broken.Chat.ID, broken.ID, err)
+
+		replyText(ctx, b, message, "sorry, this board can't be repaired")
+
+		return
+	}
+
+	corrections = append(corrections, messageCorrections(broken, board.text(), kb)...)
+	if len(corrections) == 0 {
+		replyText(ctx, b, message, "board is consistent, nothing to repair")
+
+		return
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      board.ChatID,
+		MessageID:   board.MessageID,
+		Text:        board.text(),
+		ReplyMarkup: kb,
+	})
+	if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		log.Printf("error on repair %d/%d: %s\n", broken.Chat.ID, broken.ID, err)
+
+		replyText(ctx, b, message, "failed to update the board message")
+
+		return
+	}
+
+	replyText(ctx, b, message, "board repaired:\n- "+strings.Join(corrections, "\n- "))
+}
+
+// repairedBoard returns the best known state of the board in message,
+// stored state wins over the keyboard, a board known only by its keyboard
+// is imported into the store
+func repairedBoard(message *models.Message, actor models.User) (*Board, []string, error) {
+	if !stateless {
+		board, err := boards.GetByMessage(message.Chat.ID, message.ID)
+		if err == nil {
+			return board, nil, nil
+		}
+
+		if !errors.Is(err, errBoardNotFound) {
+			return nil, nil, err
+		}
+	}
+
+	board, ok := boardFromMessage(message)
+	if !ok {
+		return nil, nil, errBoardNotFound
+	}
+
+	if stateless {
+		return board, nil, nil
+	}
+
+	board, err := boards.Create(board, boardEvents(nil, board, actor)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return board, []string{"board was restored from its buttons"}, nil
+}
+
+func renderKeyboard(board *Board) (*models.InlineKeyboardMarkup, error) {
+	if stateless {
+		return board.statelessKeyboard()
+	}
+
+	return board.keyboard(), nil
+}
+
+// messageCorrections lists what differs between the message and the board
+// rendered as text and kb
+func messageCorrections(message *models.Message, text string, kb *models.InlineKeyboardMarkup) []string {
+	corrections := []string{}
+
+	if message.Text != text {
+		shownTitle, shownItems := splitText(message.Text)
+		title, items := splitText(text)
+
+		if shownTitle != title {
+			corrections = append(corrections, fmt.Sprintf("title showed %q instead of %q", shownTitle, title))
+		}
+
+		if len(shownItems) != len(items) {
+			corrections = append(corrections, "text was out of date")
+		}
+
+		for i := 0; i < len(items) && len(shownItems) == len(items); i++ {
+			if shownItems[i] != items[i] {
+				corrections = append(corrections, fmt.Sprintf("text showed %s instead of %s", shownItems[i], items[i]))
+			}
+		}
+	}
+
+	shown := []models.InlineKeyboardButton{}
+	if message.ReplyMarkup != nil {
+		for _, row := range message.ReplyMarkup.InlineKeyboard {
+			shown = append(shown, row...)
+		}
+	}
+
+	rendered := []models.InlineKeyboardButton{}
+	for _, row := range kb.InlineKeyboard {
+		rendered = append(rendered, row...)
+	}
+
+	stale := 0
+
+	for i, button := range rendered {
+		if i >= len(shown) {
+			corrections = append(corrections, fmt.Sprintf("button %s was missing", button.Text))
+
+			continue
+		}
+
+		if shown[i].Text != button.Text {
+			corrections = append(corrections, fmt.Sprintf("button %s was shown as %s", button.Text, shown[i].Text))
+
+			continue
+		}
+
+		if shown[i].CallbackData != button.CallbackData {
+			stale++
+		}
+	}
+
+	if len(shown) > len(rendered) {
+		corrections = append(corrections, fmt.Sprintf("%d unknown buttons were removed", len(shown)-len(rendered)))
+	}
+
+	if stale > 0 {
+		corrections = append(corrections, fmt.Sprintf("%d buttons had outdated data", stale))
+	}
+
+	return corrections
+}
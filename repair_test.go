@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_messageCorrections(t *testing.T) {
+	board := newBoard(1, []string{"dev1", "dev2"})
+	board.ID = "r"
+	board.take(board.Resources[1], models.User{ID: 3, FirstName: "user"})
+
+	stale := newBoard(1, []string{"dev1", "dev2"})
+	stale.ID = "r"
+
+	tests := []struct {
+		name    string
+		message *models.Message
+		want    string
+	}{
+		{
+			name:    "consistent",
+			message: &models.Message{Text: board.text(), ReplyMarkup: board.keyboard()},
+			want:    "[]",
+		},
+		{
+			name:    "failed edit",
+			message: &models.Message{Text: stale.text(), ReplyMarkup: stale.keyboard()},
+			want:    "[text showed 🟢dev2 instead of 🏗️dev2 (user) button 🏗️dev2 was shown as 🟢dev2]",
+		},
+		{
+			name:    "text edited",
+			message: &models.Message{Text: "something else", ReplyMarkup: board.keyboard()},
+			want:    "[text was out of date]",
+		},
+		{
+			name:    "keyboard lost",
+			message: &models.Message{Text: board.text()},
+			want:    "[button 🟢dev1 was missing button 🏗️dev2 was missing button ⚡ was missing]",
+		},
+		{
+			name: "legacy keyboard",
+			message: &models.Message{
+				Text: board.text(),
+				ReplyMarkup: &models.InlineKeyboardMarkup{
+					InlineKeyboard: [][]models.InlineKeyboardButton{
+						{{Text: "🟢dev1", CallbackData: "free-dev1"}, {Text: "🏗️dev2", CallbackData: "busy-dev2"}},
+						{{Text: "⚡", CallbackData: "⚡"}, {Text: "extra", CallbackData: "extra"}},
+					},
+				},
+			},
+			want: "[1 unknown buttons were removed 3 buttons had outdated data]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageCorrections(tt.message, board.text(), board.keyboard()); fmt.Sprint(got) != tt.want {
+				t.Errorf("messageCorrections() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_handleRepair(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	replies := []string{}
+	edits := 0
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		replies = append(replies, formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits++
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+
+	stored, _ := boards.Create(newBoard(40, []string{"dev1", "dev2"}))
+	stored.MessageID = 400
+
+	shown := stored.clone()
+
+	stored.take(stored.Resources[0], models.User{ID: 3, FirstName: "user"})
+
+	if err := boards.Save(stored); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	tests := []struct {
+		name      string
+		broken    *models.Message
+		want      string
+		wantEdits int
+	}{
+		{
+			name:   "not a reply",
+			broken: nil,
+			want:   "reply /repair to a board message",
+		},
+		{
+			name:      "stored board out of sync",
+			broken:    &models.Message{ID: 400, Chat: models.Chat{ID: 40}, Text: shown.text(), ReplyMarkup: shown.keyboard()},
+			want:      "board repaired:\n- text showed 🟢dev1 instead of 🏗️dev1 (user)\n- button 🏗️dev1 was shown as 🟢dev1",
+			wantEdits: 1,
+		},
+		{
+			name:   "stored board in sync",
+			broken: &models.Message{ID: 400, Chat: models.Chat{ID: 40}, Text: stored.text(), ReplyMarkup: stored.keyboard()},
+			want:   "board is consistent, nothing to repair",
+		},
+		{
+			name: "unknown legacy board",
+			broken: &models.Message{
+				ID:   401,
+				Chat: models.Chat{ID: 40},
+				Text: "🏗️prod (admin)",
+				ReplyMarkup: &models.InlineKeyboardMarkup{
+					InlineKeyboard: [][]models.InlineKeyboardButton{{{Text: "🏗️prod", CallbackData: "free-prod"}}},
+				},
+			},
+			want:      "board repaired:\n- board was restored from its buttons",
+			wantEdits: 1,
+		},
+		{
+			name:   "not a board",
+			broken: &models.Message{ID: 402, Chat: models.Chat{ID: 40}, Text: "hello"},
+			want:   "can't find a board in this message",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies = replies[:0]
+			edits = 0
+
+			handler(ctx, b, &models.Update{
+				Message: &models.Message{Text: "/repair", Chat: models.Chat{ID: 40}, ReplyToMessage: tt.broken},
+			})
+
+			if len(replies) != 1 || !strings.HasPrefix(replies[0], tt.want) {
+				t.Errorf("replies = %q, want %q", replies, tt.want)
+			}
+
+			if edits != tt.wantEdits {
+				t.Errorf("edits = %d, want %d", edits, tt.wantEdits)
+			}
+		})
+	}
+
+	restored, err := boards.GetByMessage(40, 401)
+	if err != nil || restored.Resources[0].Holder == nil || restored.Resources[0].Holder.Name != "admin" {
+		t.Errorf("restored board = %#v, %v", restored, err)
+	}
+}
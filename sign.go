@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	signatureSeparator = "."
+	// truncated HMAC, 6 bytes in base64url
+	signatureLen = 8
+)
+
+// callbackKey signs callback_data, main derives it from the bot token or SECRET
+var callbackKey = deriveCallbackKey("")
+
+// deriveCallbackKey turns a secret into the key, so the secret itself
+// is never used for anything else than deriving
+func deriveCallbackKey(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("telegram-busy-buttons callback_data"))
+
+	return mac.Sum(nil)
+}
+
+// callbackSignature binds data to the chat it is sent to,
+// a button copied into another chat does not verify
+func callbackSignature(chatID int64, data string) string {
+	mac := hmac.New(sha256.New, callbackKey)
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(chatID)))
+	mac.Write([]byte(data))
+
+	return payloadEncoding.EncodeToString(mac.Sum(nil)[:payloadEncoding.DecodedLen(signatureLen)])
+}
+
+func signCallback(chatID int64, data string) string {
+	return data + signatureSeparator + callbackSignature(chatID, data)
+}
+
+// splitSignedCallback returns data without the signature if the signature is valid
+func splitSignedCallback(chatID int64, signed string) (string, bool) {
+	cut := len(signed) - signatureLen - len(signatureSeparator)
+	if cut < 0 || signed[cut:cut+len(signatureSeparator)] != signatureSeparator {
+		return signed, false
+	}
+
+	data := signed[:cut]
+	if !hmac.Equal([]byte(signed[cut+len(signatureSeparator):]), []byte(callbackSignature(chatID, data))) {
+		return signed, false
+	}
+
+	return data, true
+}
+
+// trustedCallbackData strips a valid signature off data of a button of chatID,
+// data of buttons read from a message keyboard is trusted without one
+func trustedCallbackData(chatID int64, data string) string {
+	data, _ = splitSignedCallback(chatID, data)
+
+	return data
+}
+
+// verifyCallback returns callback data of the press without signature.
+// Unsigned data is accepted only when it is a button of the pressed message,
+// as with boards sent before signing, anything else was forged by the client.
+func verifyCallback(query *models.CallbackQuery) (string, bool) {
+	chatID := int64(0)
+
+	var message *models.Message
+
+	switch query.Message.Type {
+	case models.MaybeInaccessibleMessageTypeMessage:
+		if query.Message.Message != nil {
+			message = query.Message.Message
+			chatID = message.Chat.ID
+		}
+	case models.MaybeInaccessibleMessageTypeInaccessibleMessage:
+		if query.Message.InaccessibleMessage != nil {
+			chatID = query.Message.InaccessibleMessage.Chat.ID
+		}
+	}
+
+	if data, ok := splitSignedCallback(chatID, query.Data); ok {
+		return data, true
+	}
+
+	if message != nil && message.ReplyMarkup != nil {
+		for _, row := range message.ReplyMarkup.InlineKeyboard {
+			for _, button := range row {
+				if button.CallbackData == query.Data {
+					return query.Data, true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_splitSignedCallback(t *testing.T) {
+	signed := signCallback(1, "1a:2:t")
+
+	tests := []struct {
+		name   string
+		chatID int64
+		data   string
+		want   string
+		ok     bool
+	}{
+		{name: "valid", chatID: 1, data: signed, want: "1a:2:t", ok: true},
+		{name: "other chat", chatID: 2, data: signed, want: signed},
+		{name: "changed data", chatID: 1, data: "1a:3:t" + signed[6:], want: "1a:3:t" + signed[6:]},
+		{name: "unsigned", chatID: 1, data: "1a:2:t", want: "1a:2:t"},
+		{name: "short", chatID: 1, data: ".", want: "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := splitSignedCallback(tt.chatID, tt.data)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("splitSignedCallback() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	if len(signed) != len("1a:2:t")+len(signatureSeparator)+signatureLen {
+		t.Errorf("signCallback() = %s", signed)
+	}
+}
+
+func Test_verifyCallback(t *testing.T) {
+	message := &models.Message{
+		Chat: models.Chat{ID: 1},
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{
+					{Text: "🟢host.example", CallbackData: "busy-host.abcdefgh"},
+					{Text: "⚡1", CallbackData: `{"c":"⚡1","n":[42]}`},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+		ok   bool
+	}{
+		{name: "signed", data: signCallback(1, "1a:0:n"), want: "1a:0:n", ok: true},
+		{name: "signed for another chat", data: signCallback(2, "1a:0:n")},
+		{name: "legacy button of the message", data: `{"c":"⚡1","n":[42]}`, want: `{"c":"⚡1","n":[42]}`, ok: true},
+		{name: "legacy looking signed", data: "busy-host.abcdefgh", want: "busy-host.abcdefgh", ok: true},
+		{name: "forged notify list", data: `{"c":"⚡1","n":[42,100500]}`},
+		{name: "forged holder", data: `{"c":"free-host.example","u":"somebody else"}`},
+		{name: "unsigned token", data: "1a:0:n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := verifyCallback(&models.CallbackQuery{
+				Data: tt.data,
+				Message: models.MaybeInaccessibleMessage{
+					Type:    models.MaybeInaccessibleMessageTypeMessage,
+					Message: message,
+				},
+			})
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("verifyCallback() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func Test_handler_forgedCallback(t *testing.T) {
+	stateless = true
+	defer func() { stateless = false }()
+
+	s := newServerMock()
+	defer s.Close()
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	board := newBoard(1, []string{"dev1"})
+
+	kb, err := board.statelessKeyboard()
+	if err != nil {
+		t.Fatalf("statelessKeyboard() error %s", err)
+	}
+
+	// a modified client presses a button with its own subscribers
+	forged, _, _ := encodePayload(callbackPayload{Command: cmdTake}, []int64{100500, 100501})
+
+	handler(context.Background(), b, &models.Update{
+		CallbackQuery: &models.CallbackQuery{
+			Data: forged,
+			From: models.User{ID: 2},
+			Message: models.MaybeInaccessibleMessage{
+				Type:    models.MaybeInaccessibleMessageTypeMessage,
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: board.text(), ReplyMarkup: kb},
+			},
+		},
+	})
+
+	if s.hooksCalls["/bottest_token/sendMessage"] != 0 || s.hooksCalls["/bottest_token/editMessageText"] != 0 {
+		t.Errorf("forged press was applied: %v", s.hooksCalls)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+// stateless boards keep the whole state in the message, nothing is stored by the bot
+var stateless = false
+
+// boardFromMessage rebuilds a board from the keyboard and text of a message,
+// buttons may carry binary payloads or either of the legacy formats
+func boardFromMessage(message *models.Message) (*Board, bool) {
+	if message.ReplyMarkup == nil {
+		return nil, false
+	}
+
+	board := newBoard(message.Chat.ID, nil)
+	board.ChatTitle = message.Chat.Title
+	board.MessageID = message.ID
+
+	if message.Date > 0 {
+		board.CreatedAt = time.Unix(int64(message.Date), 0)
+	}
+
+	title, items := splitText(message.Text)
+	board.Title = title
+
+	for i, row := range message.ReplyMarkup.InlineKeyboard {
+		for _, button := range row {
+			p, err := decodePayload(trustedCallbackData(board.ChatID, button.CallbackData))
+			if err != nil {
+				continue
+			}
+
+			for _, userID := range p.Notify {
+				if !slices.Contains(board.Notify, userID) {
+					board.Notify = append(board.Notify, userID)
+				}
+			}
+
+			if p.Command == cmdNotify {
+				continue
+			}
+
+			name := p.Name
+			if name == "" {
+				name = resourceNameFromButton(button.Text)
+			}
+
+			// the rows shown become explicit, the layout is not in the message
+			resource := board.addResource(name)
+			resource.Row = i
+
+			if p.Command == cmdRelease {
+				// the message text has the full name, payload only a short one
+				holder := legacyHolderFromText(items, button.Text)
+				if holder == "" {
+					holder = p.Holder
+				}
+
+				resource.Holder = &Holder{ID: p.HolderID, Name: holder, Since: board.CreatedAt}
+			}
+		}
+	}
+
+	if len(board.Resources) == 0 {
+		return nil, false
+	}
+
+	return board, true
+}
+
+// pressedResource finds the resource a payload was pressed on,
+// binary payloads know the position, legacy ones the name
+func pressedResource(board *Board, p callbackPayload) *Resource {
+	if p.Name != "" {
+		for _, resource := range board.Resources {
+			if resource.Name == p.Name {
+				return resource
+			}
+		}
+
+		return nil
+	}
+
+	if p.Index < len(board.Resources) {
+		return board.Resources[p.Index]
+	}
+
+	return nil
+}
+
+// payloadToken is the token of the same press on a stored board
+func payloadToken(resource *Resource, p callbackPayload) callbackToken {
+	if p.Command == cmdRelease {
+		return callbackToken{ResourceID: resource.ID, Action: actionRelease}.withHolder(resource.Holder)
+	}
+
+	return callbackToken{ResourceID: resource.ID, Action: actionTake}
+}
+
+func resourceNameFromButton(text string) string {
+	text = strings.TrimPrefix(text, freeEmoji)
+	text = strings.TrimPrefix(text, busyEmoji)
+
+	return strings.TrimSpace(text)
+}
+
+// statelessKeyboard renders the board with its state packed into callback_data
+func (board *Board) statelessKeyboard() (*models.InlineKeyboardMarkup, error) {
+	data, notify, err := encodeKeyboardPayloads(board)
+	if err != nil {
+		return nil, err
+	}
+
+	kb := &models.InlineKeyboardMarkup{}
+	i := 0
+
+	for _, row := range board.rows() {
+		buttons := make([]models.InlineKeyboardButton, 0, len(row))
+
+		for _, resource := range row {
+			buttons = append(
+				buttons,
+				models.InlineKeyboardButton{
+					CallbackData: signCallback(board.ChatID, data[i]),
+					Text:         board.buttonText(resource),
+				},
+			)
+			i++
+		}
+
+		kb.InlineKeyboard = append(kb.InlineKeyboard, buttons)
+	}
+
+	kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+		{
+			CallbackData: signCallback(board.ChatID, notify),
+			Text:         board.notifyText(),
+		},
+	})
+
+	return kb, nil
+}
+
+func handleStatelessCallback(ctx context.Context, b *bot.Bot, query *models.CallbackQuery) {
+	user := query.From
+
+	p, err := decodePayload(query.Data)
+	if err != nil || query.Message.Type != models.MaybeInaccessibleMessageTypeMessage || query.Message.Message == nil {
+		log.Printf("unknown callback data %#v from %d\n", query.Data, user.ID)
+
+		showFlashMessage(ctx, b, query.ID, "sorry, you cant't do that now")
+
+		return
+	}
+
+	message := query.Message.Message
+
+	unlock := boardLocks.Lock(fmt.Sprintf("%d/%d", message.Chat.ID, message.ID))
+	defer unlock()
+
+	board, ok := boardFromMessage(message)
+	if !ok {
+		showFlashMessage(ctx, b, query.ID, "sorry, you cant't do that now")
+
+		return
+	}
+
+	token := callbackToken{Action: actionNotify}
+
+	if p.Command != cmdNotify {
+		resource := pressedResource(board, p)
+		if resource == nil {
+			showFlashMessage(ctx, b, query.ID, "this item was removed from the board")
+
+			return
+		}
+
+		token = payloadToken(resource, p)
+	}
+
+	changed, notificationText, err := applyAction(board, token, user)
+	if err != nil && !errors.Is(err, errNotModified) {
+		log.Printf("error on press %s\n", err)
+
+		return
+	}
+
+	if err := editStatelessMessage(ctx, b, board); err != nil {
+		log.Printf("error: %s, %d subscribers\n", err, len(board.Notify))
+
+		showFlashMessage(ctx, b, query.ID, "sorry, you cant't do that now")
+
+		return
+	}
+
+	log.Printf("%#v from %d\n", notificationText, user.ID)
+
+	notifySubscribers(ctx, b, board, changed, user)
+
+	// hide Loading... message and show who pressed button
+	showFlashMessage(ctx, b, query.ID, notificationText)
+}
+
+// editStatelessMessage renders the board into its message,
+// errBoardFull when the state does not fit into the buttons any more
+func editStatelessMessage(ctx context.Context, b *bot.Bot, board *Board) error {
+	kb, err := board.statelessKeyboard()
+	if err != nil {
+		return err
+	}
+
+	editedMessage := &bot.EditMessageTextParams{
+		ChatID:      board.ChatID,
+		MessageID:   board.MessageID,
+		Text:        board.text(),
+		ReplyMarkup: kb,
+	}
+
+	if _, err := b.EditMessageText(ctx, editedMessage); err != nil {
+		log.Printf("error on edit message %s, %#v %#v\n", err.Error(), editedMessage, editedMessage.ReplyMarkup)
+	}
+
+	return nil
+}
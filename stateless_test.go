@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_handleStatelessCallback(t *testing.T) {
+	stateless = true
+	defer func() { stateless = false }()
+
+	board := newBoard(-100, []string{"dev1", "dev2"})
+	board.MessageID = 5
+
+	kb, err := board.statelessKeyboard()
+	if err != nil {
+		t.Fatalf("statelessKeyboard() error %s", err)
+	}
+
+	message := &models.Message{
+		ID:          board.MessageID,
+		Chat:        models.Chat{ID: board.ChatID},
+		Text:        board.text(),
+		ReplyMarkup: kb,
+	}
+
+	s := newServerMock()
+	defer s.Close()
+
+	// every edit becomes the message the next press is made on
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		message.Text = formValue(body, "text")
+		message.ReplyMarkup = &models.InlineKeyboardMarkup{}
+
+		if err := json.Unmarshal([]byte(formValue(body, "reply_markup")), message.ReplyMarkup); err != nil {
+			t.Errorf("reply_markup error %s", err)
+		}
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	press := func(user models.User, row, col int) {
+		handler(context.Background(), b, &models.Update{
+			CallbackQuery: &models.CallbackQuery{
+				Data: message.ReplyMarkup.InlineKeyboard[row][col].CallbackData,
+				From: user,
+				Message: models.MaybeInaccessibleMessage{
+					Type:    models.MaybeInaccessibleMessageTypeMessage,
+					Message: message,
+				},
+			},
+		})
+	}
+
+	for i := int64(1); i <= 12; i++ {
+		press(models.User{ID: 1000000000 + i}, 1, 0)
+	}
+
+	press(models.User{ID: 7, FirstName: "Константин", LastName: "Константинопольский-Щедрин"}, 0, 1)
+
+	if got, want := message.Text, "🟢dev1  🏗️dev2 (Константин Константинопольский-Щедрин)"; got != want {
+		t.Errorf("text = %v, want %v", got, want)
+	}
+
+	for _, row := range message.ReplyMarkup.InlineKeyboard {
+		for _, button := range row {
+			if len(button.CallbackData) > callbackDataLimit {
+				t.Errorf("callback_data %s is %d bytes", button.CallbackData, len(button.CallbackData))
+			}
+		}
+	}
+
+	got, _ := boardFromMessage(message)
+	if len(got.Notify) != 12 || got.Resources[1].Holder.ID != 7 {
+		t.Errorf("board = %#v", got)
+	}
+
+	if s.hooksCalls["/bottest_token/sendMessage"] != 12 {
+		t.Errorf("sendMessage calls = %d, want 12", s.hooksCalls["/bottest_token/sendMessage"])
+	}
+
+	// only the holder releases
+	press(models.User{ID: 8}, 0, 1)
+
+	if got, _ := boardFromMessage(message); got.Resources[1].Holder == nil || got.Resources[1].Holder.ID != 7 {
+		t.Errorf("board after release by another user = %#v", got)
+	}
+
+	// releasing keeps everything else
+	press(models.User{ID: 7}, 0, 1)
+
+	if got, _ := boardFromMessage(message); got.Resources[1].Holder != nil || len(got.Notify) != 12 {
+		t.Errorf("board after release = %#v", got)
+	}
+}
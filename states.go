@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+// most states a board may have
+const maxStates = 8
+
+// longest state label in runes
+const maxStateLabelLength = 16
+
+var errBadStates = errors.New("states must be like [🟢free 🏗️busy 🔴broken], an emoji and a one word label each, the first one is free, 2 to 8 states")
+
+// State is one of the states resources of a board cycle through, the first
+// state of a board is free, the rest are held by someone
+type State struct {
+	Emoji string `json:"emoji"`
+	Label string `json:"label"`
+}
+
+func (s State) String() string {
+	return s.Emoji + s.Label
+}
+
+// defaultStates are the states of boards that set none
+var defaultStates = []State{{Emoji: freeEmoji, Label: stateFree}, {Emoji: busyEmoji, Label: stateBusy}}
+
+// states are the states of the board in order
+func (board *Board) states() []State {
+	if len(board.States) == 0 {
+		return defaultStates
+	}
+
+	return board.States
+}
+
+// stateOf is the index of the state the resource is in, 0 for free
+func (board *Board) stateOf(resource *Resource) int {
+	// shared resources are busy once all slots are taken
+	if resource.shared() {
+		if resource.full() {
+			return 1
+		}
+
+		return 0
+	}
+
+	if resource.Holder == nil {
+		return 0
+	}
+
+	// holds older than state sets are busy
+	if s := resource.Holder.State; s > 0 && s < len(board.states()) {
+		return s
+	}
+
+	return 1
+}
+
+// stateLabel is the label of the state the resource is in
+func (board *Board) stateLabel(resource *Resource) string {
+	return board.states()[board.stateOf(resource)].Label
+}
+
+// stateIndex finds the state called label ignoring case
+func (board *Board) stateIndex(label string) (int, bool) {
+	i := slices.IndexFunc(board.states(), func(s State) bool { return strings.EqualFold(s.Label, label) })
+
+	return i, i >= 0
+}
+
+// stateLabels lists the labels of the states of the board
+func (board *Board) stateLabels() string {
+	labels := make([]string, 0, len(board.states()))
+	for _, s := range board.states() {
+		labels = append(labels, s.Label)
+	}
+
+	return strings.Join(labels, ", ")
+}
+
+// stateText is the button text of the resource, with the label
+// of the state for custom states
+func (board *Board) stateText(resource *Resource) string {
+	if len(board.States) == 0 {
+		return board.buttonText(resource)
+	}
+
+	return board.buttonText(resource) + " " + board.stateLabel(resource)
+}
+
+// pressToken is the token of a press on the button of the resource,
+// a press moves the resource to the next state
+func (board *Board) pressToken(resource *Resource) callbackToken {
+	token := callbackToken{BoardID: board.ID, ResourceID: resource.ID, Action: actionTake}
+
+	// who presses is not known ahead, the press takes or returns their slot
+	if resource.shared() {
+		token.Action = actionSlot
+
+		return token
+	}
+
+	switch next := (board.stateOf(resource) + 1) % len(board.states()); {
+	case next == 0:
+		token.Action = actionRelease
+	case next > 1:
+		token.Action, token.Arg = actionState, strconv.Itoa(next)
+	}
+
+	// releases and state changes are for the hold the keyboard shows
+	if token.Action != actionTake {
+		token = token.withHolder(resource.Holder)
+	}
+
+	return token
+}
+
+// setState moves the held resource to another held state, the user who
+// does it becomes the holder
+func (board *Board) setState(resource *Resource, state int, user models.User) {
+	now := time.Now()
+
+	if resource.Holder.ID != user.ID {
+		resource.Holder = &Holder{ID: user.ID, Name: fullName(user)}
+	}
+
+	// holds with a time limit are for being busy, not for the other states
+	resource.Holder.State = state
+	resource.Holder.Since = now
+	resource.Holder.Until = time.Time{}
+	resource.Holder.Warned = false
+	board.UpdatedAt = now
+}
+
+// parseStates reads a state set like "🟢free 🏗️busy 🔴broken"
+func parseStates(args string) ([]State, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 2 || len(fields) > maxStates {
+		return nil, errBadStates
+	}
+
+	states := make([]State, 0, len(fields))
+
+	for _, field := range fields {
+		i := strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+		if i <= 0 {
+			return nil, errBadStates
+		}
+
+		s := State{Emoji: field[:i], Label: strings.ToLower(field[i:])}
+
+		if utf8.RuneCountInString(s.Label) > maxStateLabelLength || strings.ContainsFunc(s.Label, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+		}) {
+			return nil, errBadStates
+		}
+
+		for _, other := range states {
+			if other.Emoji == s.Emoji || other.Label == s.Label {
+				return nil, fmt.Errorf("state %s is there twice", s)
+			}
+		}
+
+		states = append(states, s)
+	}
+
+	// boards with the default states store none
+	if slices.Equal(states, defaultStates) {
+		return nil, nil
+	}
+
+	return states, nil
+}
+
+// cutStates takes the state set in brackets off the start of /create arguments
+func cutStates(args string) ([]State, string, error) {
+	inside, ok := strings.CutPrefix(strings.TrimSpace(args), "[")
+	if !ok {
+		return nil, args, nil
+	}
+
+	inside, rest, ok := strings.Cut(inside, "]")
+	if !ok {
+		return nil, args, errBadStates
+	}
+
+	states, err := parseStates(inside)
+
+	return states, rest, err
+}
+
+// stateCount is how many resources are in the state called Label
+type stateCount struct {
+	Label string
+	N     int
+}
+
+// countStates adds up resources of the board by state into counts,
+// states of several boards are merged by label
+func countStates(counts []stateCount, board *Board) []stateCount {
+	for _, s := range board.states() {
+		if !slices.ContainsFunc(counts, func(c stateCount) bool { return c.Label == s.Label }) {
+			counts = append(counts, stateCount{Label: s.Label})
+		}
+	}
+
+	for _, resource := range board.Resources {
+		label := board.stateLabel(resource)
+		counts[slices.IndexFunc(counts, func(c stateCount) bool { return c.Label == label })].N++
+	}
+
+	return counts
+}
+
+// countsText is "2 free, 1 busy", states nothing is in are left out
+func countsText(counts []stateCount) string {
+	parts := []string{}
+
+	for _, c := range counts {
+		if c.N > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.N, c.Label))
+		}
+	}
+
+	if len(parts) == 0 && len(counts) > 0 {
+		return "0 " + counts[0].Label
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_parseStates(t *testing.T) {
+	tests := []struct {
+		args    string
+		want    string
+		wantErr bool
+	}{
+		{args: "🟢free 🏗️busy 🔴Broken 🔧maintenance", want: "[🟢free 🏗️busy 🔴broken 🔧maintenance]"},
+		{args: "✅open ⛔closed", want: "[✅open ⛔closed]"},
+		{args: "🟢free 🏗️busy", want: "[]"},
+		{args: "🟢free", wantErr: true},
+		{args: "free busy", wantErr: true},
+		{args: "🟢free 🟢busy", wantErr: true},
+		{args: "🟢free 🔴free", wantErr: true},
+		{args: "🟢free 🔴out!", wantErr: true},
+		{args: "🟢1 🔴2 🟠3 🟡4 🔵5 🟣6 🟤7 ⚫8 ⚪9", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			got, err := parseStates(tt.args)
+			if (err != nil) != tt.wantErr || (err == nil && fmt.Sprint(got) != tt.want) {
+				t.Errorf("parseStates() = %v, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+
+	if states, rest, err := cutStates(" [🟢free 🔴broken] dev1 | dev2"); err != nil || len(states) != 2 || rest != " dev1 | dev2" {
+		t.Errorf("cutStates() = %v, %q, %v", states, rest, err)
+	}
+
+	if _, _, err := cutStates("[🟢free 🔴broken dev1"); err == nil {
+		t.Errorf("cutStates() without ] is not an error")
+	}
+}
+
+func Test_Board_states(t *testing.T) {
+	ann := models.User{ID: 1, FirstName: "Ann"}
+	bob := models.User{ID: 2, FirstName: "Bob"}
+
+	board := newBoard(1, []string{"dev1", "dev2"})
+	board.States, _ = parseStates("🟢free 🏗️busy 🔴broken")
+
+	press := func(user models.User) (string, error) {
+		_, text, err := applyAction(board, board.pressToken(board.Resources[0]), user)
+
+		return text, err
+	}
+
+	tests := []struct {
+		user  models.User
+		want  string
+		state string
+	}{
+		{user: ann, want: "🏗️dev1 (busy by Ann)", state: "busy"},
+		{user: bob, want: "🔴dev1 (broken by Bob)", state: "broken"},
+		{user: ann, want: "🔴dev1 (broken by Bob) ⏳1", state: "broken"},
+		{user: ann, want: "🔴dev1 (broken by Bob)", state: "broken"},
+		{user: bob, want: "🟢dev1", state: "free"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			if _, err := press(tt.user); err != nil {
+				t.Fatalf("press() error = %v", err)
+			}
+
+			if got := board.itemText(board.Resources[0]); got != tt.want || board.stateLabel(board.Resources[0]) != tt.state {
+				t.Errorf("itemText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// a stale keyboard does not set the same state twice
+	board.take(board.Resources[1], ann)
+
+	token := callbackToken{ResourceID: 2, Action: actionState, Arg: "1"}
+	if _, text, err := applyAction(board, token, bob); err == nil || text != "dev2 is busy already" {
+		t.Errorf("applyAction() = %q, %v", text, err)
+	}
+
+	if got := countsText(countStates(countStates(nil, newBoard(1, []string{"qa"})), board)); got != "2 free, 1 busy" {
+		t.Errorf("countsText() = %q", got)
+	}
+}
+
+func Test_handleState(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	const chatID = 260
+
+	var (
+		messages []string
+		markups  []string
+		edits    []string
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "chat_id")+": "+formValue(body, "text"))
+		markups = append(markups, formValue(body, "reply_markup"))
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 2600, "chat": map[string]any{"id": chatID}}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	ann := &models.User{ID: 26, FirstName: "Ann"}
+	bob := &models.User{ID: 27, FirstName: "Bob"}
+
+	send := func(from *models.User, text string) {
+		messages, markups, edits = nil, nil, nil
+
+		handler(ctx, b, &models.Update{Message: &models.Message{Text: text, Chat: models.Chat{ID: chatID}, From: from}})
+	}
+
+	send(ann, "/create [🟢free] dev1")
+
+	if want := "[260: can't create the board: " + errBadStates.Error() + "]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	send(ann, "/create [🟢free 🏗️busy 🔴broken 🔧maintenance] dev1 dev2")
+
+	board, _ := boards.GetByMessage(chatID, 2600)
+	board, _ = updateBoard(boards, board.ID, *bob, func(board *Board) error {
+		board.toggleNotify(bob.ID)
+
+		return nil
+	})
+
+	// buttons show the emoji of the states
+	kb := &models.InlineKeyboardMarkup{}
+	if err := json.Unmarshal([]byte(markups[0]), kb); err != nil || kb.InlineKeyboard[0][0].Text != "🟢dev1" {
+		t.Fatalf("markup = %q, %v", markups[0], err)
+	}
+
+	tests := []struct {
+		text      string
+		from      *models.User
+		want      []string
+		wantEdits []string
+	}{
+		{text: "/state dev1", want: []string{"260: you must send command in format /state name state [note]"}},
+		{text: "/state dev1 lost", want: []string{"260: board " + board.ID + " has no state lost, its states are free, busy, broken, maintenance"}},
+		{
+			text:      "/state dev1 broken fan is dead",
+			want:      []string{"27: 🔴dev1 broken status updated by Ann", "260: dev1 updated by Ann"},
+			wantEdits: []string{"260: 🔴dev1 (broken by Ann: fan is dead)  🟢dev2"},
+		},
+		{
+			text:      "/state dev1 maintenance",
+			from:      bob,
+			want:      []string{"260: dev1 updated by Bob"},
+			wantEdits: []string{"260: 🔧dev1 (maintenance by Bob)  🟢dev2"},
+		},
+		{text: "/state dev1 maintenance", want: []string{"260: dev1 is maintenance already"}, wantEdits: []string{"260: 🔧dev1 (maintenance by Bob)  🟢dev2"}},
+		{
+			text:      "/take dev1",
+			from:      bob,
+			want:      []string{"260: dev1 was already taken by Bob"},
+			wantEdits: []string{"260: 🔧dev1 (maintenance by Bob)  🟢dev2"},
+		},
+		{
+			text:      "/state dev1 free",
+			want:      []string{"27: 🟢dev1 free status updated by Ann", "260: dev1 updated by Ann"},
+			wantEdits: []string{"260: 🟢dev1  🟢dev2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			from := ann
+			if tt.from != nil {
+				from = tt.from
+			}
+
+			send(from, tt.text)
+
+			if fmt.Sprint(messages) != fmt.Sprint(tt.want) {
+				t.Errorf("messages = %q, want %q", messages, tt.want)
+			}
+
+			if tt.wantEdits != nil && fmt.Sprint(edits) != fmt.Sprint(tt.wantEdits) {
+				t.Errorf("edits = %q, want %q", edits, tt.wantEdits)
+			}
+
+			if tt.text == "/state dev1 maintenance" && tt.from == bob {
+				board, _ = boards.Get(board.ID)
+
+				if text, _ := statusMessage([]*Board{board}); text != "1 boards, 1 free, 1 maintenance\n\ndev1, dev2: 1 free, 1 maintenance\n🔧dev1 (maintenance by Bob)" {
+					t.Errorf("statusMessage() = %q", text)
+				}
+			}
+		})
+	}
+
+	events, _ := boards.Events(board.ID, 1)
+	texts := []string{}
+
+	for _, e := range events {
+		texts = append(texts, e.text())
+	}
+
+	want := []string{"dev1 marked broken by Ann", "dev1 released by Bob", "dev1 marked maintenance by Bob", "dev1 released by Ann"}
+	if got := texts[len(texts)-len(want):]; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+
+	events, _ = boards.Events(board.ID, 0)
+	replayed := replayEvents(events)[board.ID]
+	if replayed == nil || replayed.Resources[0].Holder != nil || fmt.Sprint(replayed.States) != fmt.Sprint(board.States) {
+		t.Errorf("replayed = %#v", replayed)
+	}
+}
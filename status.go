@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// longest text of a Telegram message in runes
+const maxMessageLength = 4096
+
+// IDs of supergroups are -100 followed by the ID used in message links
+const supergroupIDShift = -1000000000000
+
+// untitled boards are labeled in the summary by this many resource names
+const statusLabelNames = 3
+
+// handleStatus answers /status with the summary of all boards of the chat,
+// the summary is pinned and kept up to date as boards change
+func handleStatus(ctx context.Context, b *bot.Bot, message *models.Message) {
+	if stateless {
+		replyText(ctx, b, message, "the bot keeps no boards in stateless mode, nothing to sum up")
+
+		return
+	}
+
+	chatID := message.Chat.ID
+
+	unlock := boardLocks.Lock(statusLockKey(chatID))
+	defer unlock()
+
+	list, err := boards.List(chatID)
+	if err != nil {
+		log.Printf("error on list boards of %d: %s\n", chatID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	if len(list) == 0 {
+		replyText(ctx, b, message, "there are no boards in this chat")
+
+		return
+	}
+
+	settings, err := boards.Settings(chatID)
+	if err != nil {
+		log.Printf("error on chat settings %d: %s\n", chatID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	text, kb := statusMessage(list)
+
+	// the pinned summary is updated in place while it exists
+	if settings.StatusMessageID != 0 && editStatusMessage(ctx, b, settings, text, kb) {
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          chatID,
+			Text:            "the summary is up to date",
+			ReplyParameters: &models.ReplyParameters{MessageID: settings.StatusMessageID, AllowSendingWithoutReply: true},
+		})
+
+		return
+	}
+
+	sent, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ReplyMarkup: kb,
+	})
+	if err != nil {
+		log.Printf("error on send message %s\n", err)
+
+		return
+	}
+
+	// pinning needs admin rights, without them the summary is still updated
+	_, err = b.PinChatMessage(ctx, &bot.PinChatMessageParams{
+		ChatID:              chatID,
+		MessageID:           sent.ID,
+		DisableNotification: true,
+	})
+	if err != nil {
+		log.Printf("error on pin message %s\n", err)
+	}
+
+	saveStatusMessageID(chatID, sent.ID)
+}
+
+// refreshStatus renders the summary of the chat again if it has one
+func refreshStatus(ctx context.Context, b *bot.Bot, chatID int64) {
+	if stateless {
+		return
+	}
+
+	unlock := boardLocks.Lock(statusLockKey(chatID))
+	defer unlock()
+
+	settings, err := boards.Settings(chatID)
+	if err != nil {
+		log.Printf("error on chat settings %d: %s\n", chatID, err)
+
+		return
+	}
+
+	if settings.StatusMessageID == 0 {
+		return
+	}
+
+	list, err := boards.List(chatID)
+	if err != nil {
+		log.Printf("error on list boards of %d: %s\n", chatID, err)
+
+		return
+	}
+
+	text, kb := statusMessage(list)
+
+	editStatusMessage(ctx, b, settings, text, kb)
+}
+
+// editStatusMessage updates the summary, a summary deleted from the chat
+// is forgotten
+func editStatusMessage(ctx context.Context, b *bot.Bot, settings *ChatSettings, text string, kb *models.InlineKeyboardMarkup) bool {
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      settings.ChatID,
+		MessageID:   settings.StatusMessageID,
+		Text:        text,
+		ReplyMarkup: kb,
+	})
+	if err == nil || strings.Contains(err.Error(), "message is not modified") {
+		return true
+	}
+
+	log.Printf("error on edit status message %s\n", err)
+
+	if strings.Contains(err.Error(), "message to edit not found") {
+		saveStatusMessageID(settings.ChatID, 0)
+	}
+
+	return false
+}
+
+// statusMessage sums up boards of a chat: counts of resources by state and
+// holders of every board, with buttons to open the boards
+func statusMessage(list []*Board) (string, *models.InlineKeyboardMarkup) {
+	kb := &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}}
+	sections := []string{}
+	total := []stateCount{}
+
+	for _, board := range list {
+		busyItems := []string{}
+
+		for _, resource := range board.Resources {
+			if len(resource.holders()) > 0 {
+				busyItems = append(busyItems, board.itemText(resource))
+			}
+		}
+
+		total = countStates(total, board)
+
+		section := fmt.Sprintf("%s: %s", board.statusLabel(), countsText(countStates(nil, board)))
+		if len(busyItems) > 0 {
+			section += "\n" + strings.Join(busyItems, "  ")
+		}
+
+		sections = append(sections, section)
+
+		if link, ok := messageLink(board.ChatID, board.MessageID); ok {
+			kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+				{Text: "open " + board.statusLabel(), URL: link},
+			})
+		}
+	}
+
+	text := fmt.Sprintf("%d boards, %s\n\n%s", len(list), countsText(total), strings.Join(sections, "\n\n"))
+
+	if runes := []rune(text); len(runes) > maxMessageLength {
+		text = string(runes[:maxMessageLength-1]) + "…"
+	}
+
+	return text, kb
+}
+
+// statusLabel names the board in the summary, untitled boards by their
+// first resources as they are seen on the message
+func (board *Board) statusLabel() string {
+	if board.Title != "" {
+		return board.Title
+	}
+
+	names := []string{}
+	for _, resource := range board.Resources[:min(len(board.Resources), statusLabelNames)] {
+		names = append(names, resource.Name)
+	}
+
+	if len(board.Resources) > statusLabelNames {
+		names = append(names, "…")
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// messageLink is the t.me link of a message, only messages of supergroups
+// and channels have links known by ID
+func messageLink(chatID int64, messageID int) (string, bool) {
+	if chatID > supergroupIDShift || messageID == 0 {
+		return "", false
+	}
+
+	return fmt.Sprintf("https://t.me/c/%d/%d", supergroupIDShift-chatID, messageID), true
+}
+
+func statusLockKey(chatID int64) string {
+	return fmt.Sprintf("status/%d", chatID)
+}
+
+// settingsLockKey serializes changes of settings of the chat, writers read
+// them under it and save them at once
+func settingsLockKey(chatID int64) string {
+	return fmt.Sprintf("settings/%d", chatID)
+}
+
+// saveStatusMessageID stores the summary message of the chat, settings are
+// read again as templates or the layout may have changed during the calls
+// to telegram
+func saveStatusMessageID(chatID int64, messageID int) {
+	unlock := boardLocks.Lock(settingsLockKey(chatID))
+	defer unlock()
+
+	settings, err := boards.Settings(chatID)
+	if err != nil {
+		log.Printf("error on chat settings %d: %s\n", chatID, err)
+
+		return
+	}
+
+	settings.StatusMessageID = messageID
+
+	if err := boards.SaveSettings(settings); err != nil {
+		log.Printf("error on chat settings %d: %s\n", chatID, err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_messageLink(t *testing.T) {
+	tests := []struct {
+		chatID    int64
+		messageID int
+		want      string
+	}{
+		{chatID: -1001234567890, messageID: 15, want: "https://t.me/c/1234567890/15"},
+		{chatID: -1001234567890, messageID: 0, want: ""},
+		{chatID: -123456, messageID: 15, want: ""},
+		{chatID: 42, messageID: 15, want: ""},
+	}
+	for _, tt := range tests {
+		if got, _ := messageLink(tt.chatID, tt.messageID); got != tt.want {
+			t.Errorf("messageLink(%d, %d) = %q, want %q", tt.chatID, tt.messageID, got, tt.want)
+		}
+	}
+}
+
+func Test_Board_statusLabel(t *testing.T) {
+	titled := newBoard(1, []string{"dev1"})
+	titled.Title = "Staging"
+
+	tests := []struct {
+		board *Board
+		want  string
+	}{
+		{board: titled, want: "Staging"},
+		{board: newBoard(1, []string{"dev1", "dev2"}), want: "dev1, dev2"},
+		{board: newBoard(1, []string{"dev1", "dev2", "dev3", "qa"}), want: "dev1, dev2, dev3, …"},
+	}
+	for _, tt := range tests {
+		if got := tt.board.statusLabel(); got != tt.want {
+			t.Errorf("statusLabel() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func Test_handleStatus(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	const chatID = -1001000000180
+
+	var (
+		messages  []string
+		markup    string
+		edits     []string
+		pinned    []string
+		messageID = 1800
+		deleted   = map[string]bool{}
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "text"))
+		markup = formValue(body, "reply_markup")
+		messageID++
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": messageID, "chat": map[string]any{"id": chatID}}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		if deleted[formValue(body, "message_id")] {
+			return map[string]any{"ok": false, "error_code": 400, "description": "Bad Request: message to edit not found"}
+		}
+
+		edits = append(edits, formValue(body, "message_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	var duringPin func()
+
+	s.hooks["/bottest_token/pinChatMessage"] = func(body []byte) any {
+		pinned = append(pinned, formValue(body, "message_id"))
+
+		if duringPin != nil {
+			duringPin()
+		}
+
+		return map[string]any{"ok": true, "result": true}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	user := &models.User{ID: 18, FirstName: "Ann"}
+	send := func(text string) {
+		messages, edits = nil, nil
+
+		handler(ctx, b, &models.Update{Message: &models.Message{Text: text, Chat: models.Chat{ID: chatID, Type: models.ChatTypeSupergroup}, From: user}})
+	}
+
+	send("/status")
+
+	if want := "[there are no boards in this chat]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	send("/create dev1 dev2")
+	send("/create qa")
+
+	send("/status")
+
+	want := "[2 boards, 3 free\n\ndev1, dev2: 2 free\n\nqa: 1 free]"
+	if fmt.Sprint(messages) != want || fmt.Sprint(pinned) != "[1804]" {
+		t.Errorf("messages = %q, pinned %v, want %q", messages, pinned, want)
+	}
+
+	kb := &models.InlineKeyboardMarkup{}
+	if err := json.Unmarshal([]byte(markup), kb); err != nil || len(kb.InlineKeyboard) != 2 {
+		t.Fatalf("keyboard = %q, %v", markup, err)
+	}
+
+	if button := kb.InlineKeyboard[0][0]; button.URL != "https://t.me/c/1000000180/1802" || button.Text != "open dev1, dev2" {
+		t.Errorf("button = %#v", button)
+	}
+
+	// changes of boards are shown in the summary
+	send("/take dev1 tests")
+
+	want = "[1802: 🏗️dev1 (Ann: tests)  🟢dev2 1804: 2 boards, 2 free, 1 busy\n\ndev1, dev2: 1 free, 1 busy\n🏗️dev1 (Ann: tests)\n\nqa: 1 free]"
+	if fmt.Sprint(edits) != want {
+		t.Errorf("edits = %q, want %q", edits, want)
+	}
+
+	send("/status")
+
+	if fmt.Sprint(messages) != "[the summary is up to date]" || len(edits) != 1 || len(pinned) != 1 {
+		t.Errorf("messages = %q, edits %q, pinned %v", messages, edits, pinned)
+	}
+
+	// a deleted summary is posted again, settings changed meanwhile are kept
+	deleted["1804"] = true
+	duringPin = func() {
+		handler(ctx, b, &models.Update{Message: &models.Message{Text: "/layout 2", Chat: models.Chat{ID: chatID, Type: models.ChatTypeSupergroup}, From: user}})
+	}
+
+	send("/status")
+
+	if len(messages) != 2 || fmt.Sprint(pinned) != "[1804 1807]" {
+		t.Errorf("messages = %q, pinned %v", messages, pinned)
+	}
+
+	if settings, _ := boards.Settings(chatID); settings.StatusMessageID != 1807 || settings.Layout.PerRow != 2 {
+		t.Errorf("settings = %#v, want summary 1807 and layout 2 per row", settings)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+// storage backends selectable with STORAGE
+const (
+	storageMemory = "memory"
+	storageFile   = "file"
+	storageSQL    = "sql"
+)
+
+// Storage keeps boards together with their holds, subscriptions and history,
+// and settings of chats.
+// Every backend must pass the conformance suite in storage_test.go.
+type Storage interface {
+	// Create assigns a new unique ID and version 1 to the board and stores it
+	// with events of its history
+	Create(board *Board, events ...Event) (*Board, error)
+	// Get returns a copy of the board or errBoardNotFound
+	Get(id string) (*Board, error)
+	// GetByMessage returns a copy of the board posted as the message or errBoardNotFound
+	GetByMessage(chatID int64, messageID int) (*Board, error)
+	// List returns boards of the chat in order of creation, all boards if chatID is 0
+	List(chatID int64) ([]*Board, error)
+	// HeldBy returns boards with resources held by the user in order of creation
+	HeldBy(userID int64) ([]*Board, error)
+	// SubscribedBy returns boards the user gets notifications of in order of creation
+	SubscribedBy(userID int64) ([]*Board, error)
+	// Save stores the board and appends events if nobody saved it since it was
+	// read, otherwise errVersionConflict is returned and nothing is changed
+	Save(board *Board, events ...Event) error
+	// Delete removes the board and appends events, deleting a missing board
+	// is not an error and appends nothing. History of the board is kept.
+	Delete(id string, events ...Event) error
+	// Events returns history of the board in order it was appended,
+	// of one resource only if resourceID is not 0
+	Events(boardID string, resourceID int) ([]Event, error)
+	// Settings returns settings of the chat, defaults if it has none saved
+	Settings(chatID int64) (*ChatSettings, error)
+	// SaveSettings replaces settings of the chat
+	SaveSettings(settings *ChatSettings) error
+	Close() error
+}
+
+// StorageConfig selects and configures the backend boards are kept in
+type StorageConfig struct {
+	Kind string
+	// Dir is where the file backend keeps its journal
+	Dir string
+	// ReadOnly reads the journal of the file backend and never writes it,
+	// export runs next to the bot this way
+	ReadOnly bool
+	// Driver and DSN are passed to sql.Open for the sql backend
+	Driver string
+	DSN    string
+}
+
+// openStorage opens the backend of config, file if only a directory is set
+// and memory if nothing is
+func openStorage(config StorageConfig) (Storage, error) {
+	kind := config.Kind
+	if kind == "" {
+		kind = storageMemory
+		if config.Dir != "" {
+			kind = storageFile
+		}
+	}
+
+	switch kind {
+	case storageMemory:
+		return newBoardStore(), nil
+	case storageFile:
+		if config.Dir == "" {
+			return nil, errors.New("file storage needs DATA_DIR")
+		}
+
+		if config.ReadOnly {
+			return readBoardStore(config.Dir)
+		}
+
+		return openBoardStore(config.Dir)
+	case storageSQL:
+		if config.DSN == "" {
+			return nil, errors.New("sql storage needs DATABASE_URL")
+		}
+
+		return openSQLStore(config.Driver, config.DSN)
+	}
+
+	return nil, fmt.Errorf("unknown storage %q", kind)
+}
+
+// updateBoard applies fn to a fresh copy of the board and saves it together
+// with the events of the change made by actor, fn is called again with fresh
+// state when another change got in between. When fn returns an error the board
+// is not saved and the error is returned.
+func updateBoard(store Storage, id string, actor models.User, fn func(board *Board) error) (*Board, error) {
+	for range updateAttempts {
+		board, err := store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		before := board.clone()
+
+		if err := fn(board); err != nil {
+			return board, err
+		}
+
+		err = store.Save(board, boardEvents(before, board, actor)...)
+		if errors.Is(err, errVersionConflict) {
+			continue
+		}
+
+		return board, err
+	}
+
+	return nil, errVersionConflict
+}
+
+// holdsResource reports whether userID holds the resource of the board
+func (board *Board) holdsResource(userID int64, resourceID int) bool {
+	resource := board.resource(resourceID)
+
+	return resource != nil && resource.holderOf(userID) != nil
+}
+
+// holds reports whether userID holds any resource of the board
+func (board *Board) holds(userID int64) bool {
+	for _, resource := range board.Resources {
+		if resource.holderOf(userID) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortBoards(list []*Board) {
+	slices.SortFunc(list, func(a, b *Board) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.ID, b.ID)
+	})
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// storageBackends opens a fresh empty Storage of every backend,
+// sql runs when TEST_DATABASE_URL points to a disposable database
+func storageBackends(t *testing.T) map[string]func(t *testing.T) Storage {
+	backends := map[string]func(t *testing.T) Storage{
+		storageMemory: func(t *testing.T) Storage {
+			return newBoardStore()
+		},
+		storageFile: func(t *testing.T) Storage {
+			s, err := openBoardStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("openBoardStore() error %s", err)
+			}
+
+			return s
+		},
+	}
+
+	if dsn := os.Getenv("TEST_DATABASE_URL"); dsn != "" {
+		backends[storageSQL] = func(t *testing.T) Storage {
+			s, err := openSQLStore(os.Getenv("TEST_DATABASE_DRIVER"), dsn)
+			if err != nil {
+				t.Fatalf("openSQLStore() error %s", err)
+			}
+
+			for _, table := range []string{"holds", "subscriptions", "boards", "chat_settings"} {
+				if _, err := s.db.Exec("DELETE FROM " + table); err != nil {
+					t.Fatalf("clean %s error %s", table, err)
+				}
+			}
+
+			return s
+		}
+	}
+
+	return backends
+}
+
+func Test_Storage(t *testing.T) {
+	suite := map[string]func(t *testing.T, s Storage){
+		"create and get":      testStorageCreateGet,
+		"get by message":      testStorageGetByMessage,
+		"list":                testStorageList,
+		"holds":               testStorageHolds,
+		"subscriptions":       testStorageSubscriptions,
+		"versions":            testStorageVersions,
+		"update":              testStorageUpdate,
+		"delete":              testStorageDelete,
+		"concurrent updates":  testStorageConcurrentUpdates,
+		"unique ids":          testStorageUniqueIDs,
+		"copies are detached": testStorageCopies,
+		"history":             testStorageHistory,
+		"chat settings":       testStorageSettings,
+	}
+
+	for backend, open := range storageBackends(t) {
+		for name, test := range suite {
+			t.Run(backend+"/"+name, func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+
+				test(t, s)
+			})
+		}
+	}
+}
+
+func testStorageSettings(t *testing.T, s Storage) {
+	settings, err := s.Settings(1)
+	if err != nil || settings.ChatID != 1 || settings.Layout != (Layout{}) {
+		t.Fatalf("Settings() of a new chat = %#v, %v", settings, err)
+	}
+
+	for _, layout := range []Layout{{Auto: true}, {PerRow: 4}} {
+		if err := s.SaveSettings(&ChatSettings{ChatID: 1, Layout: layout}); err != nil {
+			t.Fatalf("SaveSettings() error %s", err)
+		}
+
+		if got, _ := s.Settings(1); got.Layout != layout {
+			t.Errorf("Settings() = %#v, want %#v", got.Layout, layout)
+		}
+	}
+
+	if got, _ := s.Settings(2); got.ChatID != 2 || got.Layout != (Layout{}) {
+		t.Errorf("Settings() of another chat = %#v", got)
+	}
+}
+
+func testStorageCreateGet(t *testing.T, s Storage) {
+	board := newBoard(1, []string{"dev1", "dev2"})
+	board.take(board.Resources[1], models.User{ID: 3, FirstName: "name"})
+	board.toggleNotify(4)
+
+	created, err := s.Create(board)
+	if err != nil || created.ID == "" || created.Version != 1 {
+		t.Fatalf("Create() = %#v, %v", created, err)
+	}
+
+	got, err := s.Get(created.ID)
+	if err != nil {
+		t.Fatalf("Get() error %s", err)
+	}
+
+	if got.text() != board.text() || len(got.Notify) != 1 || got.Notify[0] != 4 || got.LastID != 2 {
+		t.Errorf("Get() = %#v", got)
+	}
+
+	if !got.CreatedAt.Equal(board.CreatedAt) || !got.Resources[1].Holder.Since.Equal(board.Resources[1].Holder.Since) {
+		t.Errorf("Get() times = %s %s, want %s %s", got.CreatedAt, got.Resources[1].Holder.Since, board.CreatedAt, board.Resources[1].Holder.Since)
+	}
+
+	if _, err := s.Get("missing"); !errors.Is(err, errBoardNotFound) {
+		t.Errorf("Get() of missing board error = %v, want %v", err, errBoardNotFound)
+	}
+}
+
+func testStorageGetByMessage(t *testing.T, s Storage) {
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+
+	if _, err := s.GetByMessage(1, 0); !errors.Is(err, errBoardNotFound) {
+		t.Errorf("GetByMessage() found board without message")
+	}
+
+	board.MessageID = 5
+	if err := s.Save(board); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	got, err := s.GetByMessage(1, 5)
+	if err != nil || got.ID != board.ID {
+		t.Fatalf("GetByMessage() = %#v, %v", got, err)
+	}
+
+	if _, err := s.GetByMessage(2, 5); !errors.Is(err, errBoardNotFound) {
+		t.Errorf("GetByMessage() found board of another chat")
+	}
+
+	board.MessageID = 6
+	if err := s.Save(board); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	if _, err := s.GetByMessage(1, 5); !errors.Is(err, errBoardNotFound) {
+		t.Errorf("GetByMessage() found board by its old message")
+	}
+}
+
+func testStorageList(t *testing.T, s Storage) {
+	first, _ := s.Create(newBoard(1, []string{"dev1"}))
+	_, _ = s.Create(newBoard(2, []string{"dev2"}))
+	third, _ := s.Create(newBoard(1, []string{"dev3"}))
+
+	list, err := s.List(1)
+	if err != nil || len(list) != 2 || list[0].ID != first.ID || list[1].ID != third.ID {
+		t.Errorf("List(1) = %v, %v, want %s %s", list, err, first.ID, third.ID)
+	}
+
+	if list, _ := s.List(0); len(list) != 3 {
+		t.Errorf("List(0) = %d boards, want 3", len(list))
+	}
+
+	if list, err := s.List(3); err != nil || len(list) != 0 {
+		t.Errorf("List(3) = %v, %v, want none", list, err)
+	}
+}
+
+func testStorageHolds(t *testing.T, s Storage) {
+	board, _ := s.Create(newBoard(1, []string{"dev1", "dev2"}))
+	other, _ := s.Create(newBoard(2, []string{"dev3"}))
+
+	board.take(board.Resources[0], models.User{ID: 3})
+	board.take(board.Resources[1], models.User{ID: 3})
+	other.take(other.Resources[0], models.User{ID: 4})
+
+	for _, b := range []*Board{board, other} {
+		if err := s.Save(b); err != nil {
+			t.Fatalf("Save() error %s", err)
+		}
+	}
+
+	if list, err := s.HeldBy(3); err != nil || len(list) != 1 || list[0].ID != board.ID {
+		t.Errorf("HeldBy(3) = %v, %v, want %s", list, err, board.ID)
+	}
+
+	board.release(board.Resources[0])
+	board.release(board.Resources[1])
+
+	if err := s.Save(board); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	if list, err := s.HeldBy(3); err != nil || len(list) != 0 {
+		t.Errorf("HeldBy(3) after release = %v, %v", list, err)
+	}
+
+	if list, _ := s.HeldBy(4); len(list) != 1 || list[0].ID != other.ID {
+		t.Errorf("HeldBy(4) = %v, want %s", list, other.ID)
+	}
+}
+
+func testStorageSubscriptions(t *testing.T, s Storage) {
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+	other, _ := s.Create(newBoard(2, []string{"dev2"}))
+
+	board.toggleNotify(3)
+	other.toggleNotify(3)
+
+	for _, b := range []*Board{board, other} {
+		if err := s.Save(b); err != nil {
+			t.Fatalf("Save() error %s", err)
+		}
+	}
+
+	if list, err := s.SubscribedBy(3); err != nil || len(list) != 2 {
+		t.Errorf("SubscribedBy(3) = %v, %v, want 2 boards", list, err)
+	}
+
+	board.toggleNotify(3)
+
+	if err := s.Save(board); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	if list, _ := s.SubscribedBy(3); len(list) != 1 || list[0].ID != other.ID {
+		t.Errorf("SubscribedBy(3) after unsubscribe = %v, want %s", list, other.ID)
+	}
+}
+
+func testStorageVersions(t *testing.T, s Storage) {
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+
+	first, _ := s.Get(board.ID)
+	second, _ := s.Get(board.ID)
+
+	first.toggleNotify(1)
+	if err := s.Save(first); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	if first.Version != 2 {
+		t.Errorf("Version = %d after save, want 2", first.Version)
+	}
+
+	second.toggleNotify(2)
+	if err := s.Save(second); !errors.Is(err, errVersionConflict) {
+		t.Fatalf("Save() of stale board error = %v, want %v", err, errVersionConflict)
+	}
+
+	if stored, _ := s.Get(board.ID); stored.Version != 2 || len(stored.Notify) != 1 || stored.Notify[0] != 1 {
+		t.Errorf("stale save changed the board: %#v", stored)
+	}
+}
+
+func testStorageUpdate(t *testing.T, s Storage) {
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+
+	calls := 0
+
+	updated, err := updateBoard(s, board.ID, models.User{ID: 1}, func(board *Board) error {
+		calls++
+
+		if calls == 1 {
+			// somebody else saves in between
+			other, _ := s.Get(board.ID)
+			other.toggleNotify(3)
+
+			if err := s.Save(other); err != nil {
+				t.Fatalf("Save() error %s", err)
+			}
+		}
+
+		board.toggleNotify(2)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("updateBoard() error %s", err)
+	}
+
+	if calls != 2 || len(updated.Notify) != 2 || updated.Version != 3 {
+		t.Errorf("updateBoard() = %v v%d after %d calls, want 2 subscribers v3 after 2 calls", updated.Notify, updated.Version, calls)
+	}
+
+	if _, err := updateBoard(s, board.ID, models.User{ID: 1}, func(board *Board) error { return errNotModified }); !errors.Is(err, errNotModified) {
+		t.Errorf("updateBoard() error = %v, want %v", err, errNotModified)
+	}
+
+	if stored, _ := s.Get(board.ID); stored.Version != 3 {
+		t.Errorf("Version = %d after not modified update, want 3", stored.Version)
+	}
+
+	if _, err := updateBoard(s, "missing", models.User{ID: 1}, func(board *Board) error { return nil }); !errors.Is(err, errBoardNotFound) {
+		t.Errorf("updateBoard() of missing board error = %v, want %v", err, errBoardNotFound)
+	}
+}
+
+func testStorageDelete(t *testing.T, s Storage) {
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+	board.MessageID = 5
+	board.take(board.Resources[0], models.User{ID: 3})
+	board.toggleNotify(3)
+
+	if err := s.Save(board); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	if err := s.Delete(board.ID); err != nil {
+		t.Fatalf("Delete() error %s", err)
+	}
+
+	if _, err := s.Get(board.ID); !errors.Is(err, errBoardNotFound) {
+		t.Errorf("Get() found deleted board")
+	}
+
+	if _, err := s.GetByMessage(1, 5); !errors.Is(err, errBoardNotFound) {
+		t.Errorf("GetByMessage() found deleted board")
+	}
+
+	if list, _ := s.HeldBy(3); len(list) != 0 {
+		t.Errorf("HeldBy() found deleted board")
+	}
+
+	if list, _ := s.SubscribedBy(3); len(list) != 0 {
+		t.Errorf("SubscribedBy() found deleted board")
+	}
+
+	if err := s.Save(board); !errors.Is(err, errBoardNotFound) {
+		t.Errorf("Save() of deleted board error = %v, want %v", err, errBoardNotFound)
+	}
+
+	if err := s.Delete(board.ID); err != nil {
+		t.Errorf("Delete() of deleted board error %s", err)
+	}
+}
+
+func testStorageConcurrentUpdates(t *testing.T, s Storage) {
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+
+	users := 8
+
+	wg := sync.WaitGroup{}
+	for i := 1; i <= users; i++ {
+		wg.Add(1)
+
+		go func(userID int64) {
+			defer wg.Done()
+
+			_, err := updateBoard(s, board.ID, models.User{ID: userID}, func(board *Board) error {
+				board.toggleNotify(userID)
+
+				return nil
+			})
+			if err != nil {
+				t.Errorf("updateBoard() error %s", err)
+			}
+		}(int64(i))
+	}
+
+	wg.Wait()
+
+	if got, _ := s.Get(board.ID); len(got.Notify) != users || got.Version != int64(users+1) {
+		t.Errorf("after %d concurrent updates notify = %v, version = %d", users, got.Notify, got.Version)
+	}
+}
+
+func testStorageUniqueIDs(t *testing.T, s Storage) {
+	seen := map[string]bool{}
+
+	for range 5 {
+		board, err := s.Create(newBoard(1, []string{"dev1"}))
+		if err != nil {
+			t.Fatalf("Create() error %s", err)
+		}
+
+		if seen[board.ID] {
+			t.Fatalf("Create() reused ID %s", board.ID)
+		}
+
+		seen[board.ID] = true
+
+		if err := s.Delete(board.ID); err != nil {
+			t.Fatalf("Delete() error %s", err)
+		}
+	}
+}
+
+func testStorageCopies(t *testing.T, s Storage) {
+	board, _ := s.Create(newBoard(1, []string{"dev1"}))
+
+	got, _ := s.Get(board.ID)
+	got.Resources[0].Name = "changed"
+	got.toggleNotify(1)
+
+	if stored, _ := s.Get(board.ID); stored.Resources[0].Name != "dev1" || len(stored.Notify) != 0 {
+		t.Errorf("Get() returned shared board")
+	}
+
+	board.Resources[0].Name = "changed"
+
+	if stored, _ := s.Get(board.ID); stored.Resources[0].Name != "dev1" {
+		t.Errorf("Create() kept the board passed in")
+	}
+}
+
+func testStorageHistory(t *testing.T, s Storage) {
+	user := models.User{ID: 3, FirstName: "user"}
+
+	board := newBoard(1, []string{"dev1", "dev2"})
+
+	board, err := s.Create(board, boardEvents(nil, board, user)...)
+	if err != nil {
+		t.Fatalf("Create() error %s", err)
+	}
+
+	for _, fn := range []func(board *Board) error{
+		func(board *Board) error { board.take(board.Resources[1], user); return nil },
+		func(board *Board) error { board.toggleNotify(user.ID); return nil },
+		func(board *Board) error { board.release(board.Resources[1]); return nil },
+		func(board *Board) error { board.take(board.Resources[0], user); return nil },
+	} {
+		if _, err := updateBoard(s, board.ID, user, fn); err != nil {
+			t.Fatalf("updateBoard() error %s", err)
+		}
+	}
+
+	// a stale save appends nothing
+	stale := board.clone()
+	if err := s.Save(stale, boardEvents(board, stale, user)...); !errors.Is(err, errVersionConflict) {
+		t.Fatalf("Save() of stale board error = %v, want %v", err, errVersionConflict)
+	}
+
+	events, err := s.Events(board.ID, 0)
+	if err != nil {
+		t.Fatalf("Events() error %s", err)
+	}
+
+	types := []string{}
+	for i, e := range events {
+		types = append(types, e.Type)
+
+		if e.BoardID != board.ID || e.ActorID != user.ID || (i > 0 && e.Seq <= events[i-1].Seq) {
+			t.Errorf("event %d = %#v", i, e)
+		}
+	}
+
+	if got, want := fmt.Sprint(types), "[create take subscribe release take]"; got != want {
+		t.Errorf("Events() types = %s, want %s", got, want)
+	}
+
+	if events[0].Board == nil || events[0].Board.ID != board.ID || events[1].Version != 2 || events[1].Holder == nil {
+		t.Errorf("events are not stamped: %#v %#v", events[0], events[1])
+	}
+
+	stored, _ := s.Get(board.ID)
+	replayed := replayEvents(events)[board.ID]
+
+	if replayed == nil || replayed.text() != stored.text() || fmt.Sprint(replayed.Notify) != fmt.Sprint(stored.Notify) || replayed.Version != stored.Version {
+		t.Errorf("replayed = %#v, want %#v", replayed, stored)
+	}
+
+	resourceEvents, _ := s.Events(board.ID, board.Resources[1].ID)
+	if len(resourceEvents) != 2 || resourceEvents[0].Type != eventTake || resourceEvents[1].Type != eventRelease {
+		t.Errorf("Events() of resource = %v", resourceEvents)
+	}
+
+	if err := s.Delete(board.ID, deleteEvent(board.ID, user)); err != nil {
+		t.Fatalf("Delete() error %s", err)
+	}
+
+	events, _ = s.Events(board.ID, 0)
+	if len(events) != 6 || events[5].Type != eventDelete {
+		t.Errorf("history after Delete() = %v", events)
+	}
+
+	if _, ok := replayEvents(events)[board.ID]; ok {
+		t.Errorf("deleted board is replayed")
+	}
+
+	if events, _ := s.Events("missing", 0); len(events) != 0 {
+		t.Errorf("Events() of missing board = %v", events)
+	}
+}
+
+func Test_openStorage(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		config   StorageConfig
+		wantFile bool
+		wantErr  bool
+	}{
+		{name: "memory by default", config: StorageConfig{}},
+		{name: "file when dir is set", config: StorageConfig{Dir: dir}, wantFile: true},
+		{name: "memory with dir", config: StorageConfig{Kind: storageMemory, Dir: dir}},
+		{name: "file without dir", config: StorageConfig{Kind: storageFile}, wantErr: true},
+		{name: "sql without dsn", config: StorageConfig{Kind: storageSQL}, wantErr: true},
+		{name: "unknown", config: StorageConfig{Kind: "redis"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := openStorage(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("openStorage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			defer s.Close()
+
+			store, ok := s.(*boardStore)
+			if !ok || (store.journal != nil) != tt.wantFile {
+				t.Errorf("openStorage() = %T, file %v, want file %v", s, ok && store.journal != nil, tt.wantFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+var (
+	errBoardNotFound   = errors.New("board not found")
+	errVersionConflict = errors.New("board was changed concurrently")
+	errNotModified     = errors.New("board is not modified")
+)
+
+// updateBoard gives up after this many version conflicts in a row
+const updateAttempts = 10
+
+type messageKey struct {
+	ChatID    int64
+	MessageID int
+}
+
+// boardStore is the memory and file Storage, boards are kept in maps keyed
+// by ID and by chat+message. With a journal every change is written to disk
+// before it is applied.
+type boardStore struct {
+	mu        sync.RWMutex
+	lastID    uint64
+	boards    map[string]*Board
+	byMessage map[messageKey]string
+	events    []Event
+	settings  map[int64]ChatSettings
+	journal   *journal
+}
+
+func newBoardStore() *boardStore {
+	return &boardStore{
+		boards:    map[string]*Board{},
+		byMessage: map[messageKey]string{},
+		settings:  map[int64]ChatSettings{},
+	}
+}
+
+// openBoardStore loads boards persisted in dir and keeps them there
+func openBoardStore(dir string) (*boardStore, error) {
+	s := newBoardStore()
+
+	j, err := openJournal(dir, s.apply)
+	if err != nil {
+		return nil, err
+	}
+
+	s.journal = j
+
+	// start from a clean snapshot, this also drops damaged files moved aside
+	if err := s.compact(); err != nil {
+		_ = j.Close()
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// readBoardStore loads boards persisted in dir without keeping them there,
+// files are left as they are for the bot that may be writing them
+func readBoardStore(dir string) (*boardStore, error) {
+	s := newBoardStore()
+
+	if err := replayJournal(dir, s.apply); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Create assigns a new short ID to the board and stores it
+func (s *boardStore) Create(board *Board, events ...Event) (*Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.lastID + 1
+	board.ID = strconv.FormatUint(id, 36)
+	board.Version = 1
+
+	events = stampEvents(events, board.ID, board.Version, s.nextSeq())
+
+	if err := s.commit(journalRecord{Op: opPut, LastID: id, Board: board, Events: events}); err != nil {
+		return nil, err
+	}
+
+	s.lastID = id
+	s.put(board.clone())
+	s.events = append(s.events, events...)
+
+	return board, nil
+}
+
+func (s *boardStore) Get(id string) (*Board, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	board, ok := s.boards[id]
+	if !ok {
+		return nil, errBoardNotFound
+	}
+
+	return board.clone(), nil
+}
+
+func (s *boardStore) GetByMessage(chatID int64, messageID int) (*Board, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.byMessage[messageKey{ChatID: chatID, MessageID: messageID}]
+	if !ok {
+		return nil, errBoardNotFound
+	}
+
+	return s.boards[id].clone(), nil
+}
+
+func (s *boardStore) List(chatID int64) ([]*Board, error) {
+	return s.filter(func(board *Board) bool {
+		return chatID == 0 || board.ChatID == chatID
+	}), nil
+}
+
+func (s *boardStore) HeldBy(userID int64) ([]*Board, error) {
+	return s.filter(func(board *Board) bool {
+		return board.holds(userID)
+	}), nil
+}
+
+func (s *boardStore) SubscribedBy(userID int64) ([]*Board, error) {
+	return s.filter(func(board *Board) bool {
+		return slices.Contains(board.Notify, userID)
+	}), nil
+}
+
+// filter returns copies of boards matching fn in order of creation
+func (s *boardStore) filter(fn func(board *Board) bool) []*Board {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []*Board{}
+
+	for _, board := range s.boards {
+		if fn(board) {
+			list = append(list, board.clone())
+		}
+	}
+
+	sortBoards(list)
+
+	return list
+}
+
+// Save stores the board if nobody saved it since it was read,
+// otherwise errVersionConflict is returned and nothing is changed
+func (s *boardStore) Save(board *Board, events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.boards[board.ID]
+	if !ok {
+		return errBoardNotFound
+	}
+
+	if stored.Version != board.Version {
+		return errVersionConflict
+	}
+
+	next := board.clone()
+	next.Version++
+
+	events = stampEvents(events, next.ID, next.Version, s.nextSeq())
+
+	if err := s.commit(journalRecord{Op: opPut, Board: next, Events: events}); err != nil {
+		return err
+	}
+
+	s.put(next)
+	s.events = append(s.events, events...)
+	board.Version = next.Version
+
+	return nil
+}
+
+func (s *boardStore) Delete(id string, events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	board, ok := s.boards[id]
+	if !ok {
+		return nil
+	}
+
+	events = stampEvents(events, id, board.Version, s.nextSeq())
+
+	if err := s.commit(journalRecord{Op: opDelete, ID: id, Events: events}); err != nil {
+		return err
+	}
+
+	s.remove(id)
+	s.events = append(s.events, events...)
+
+	return nil
+}
+
+func (s *boardStore) Events(boardID string, resourceID int) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []Event{}
+
+	for _, e := range s.events {
+		if e.BoardID == boardID && (resourceID == 0 || e.ResourceID == resourceID) {
+			events = append(events, e.clone())
+		}
+	}
+
+	return events, nil
+}
+
+func (s *boardStore) Settings(chatID int64) (*ChatSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings, ok := s.settings[chatID]
+	if !ok {
+		return &ChatSettings{ChatID: chatID}, nil
+	}
+
+	return &settings, nil
+}
+
+func (s *boardStore) SaveSettings(settings *ChatSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.commit(journalRecord{Op: opSettings, Settings: settings}); err != nil {
+		return err
+	}
+
+	s.settings[settings.ChatID] = *settings
+
+	return nil
+}
+
+// nextSeq is the sequence number of the next event, must be called under lock
+func (s *boardStore) nextSeq() int64 {
+	if len(s.events) == 0 {
+		return 1
+	}
+
+	return s.events[len(s.events)-1].Seq + 1
+}
+
+// Close writes a final snapshot and releases the journal
+func (s *boardStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.journal == nil {
+		return nil
+	}
+
+	if err := s.compact(); err != nil {
+		log.Printf("error on compact boards %s\n", err)
+	}
+
+	return s.journal.Close()
+}
+
+func (s *boardStore) put(board *Board) {
+	if old, ok := s.boards[board.ID]; ok {
+		delete(s.byMessage, messageKey{ChatID: old.ChatID, MessageID: old.MessageID})
+	}
+
+	s.boards[board.ID] = board
+
+	if board.MessageID != 0 {
+		s.byMessage[messageKey{ChatID: board.ChatID, MessageID: board.MessageID}] = board.ID
+	}
+}
+
+func (s *boardStore) remove(id string) {
+	if board, ok := s.boards[id]; ok {
+		delete(s.byMessage, messageKey{ChatID: board.ChatID, MessageID: board.MessageID})
+		delete(s.boards, id)
+	}
+}
+
+// apply replays a persisted record, used only while loading
+func (s *boardStore) apply(rec journalRecord) {
+	if rec.LastID > s.lastID {
+		s.lastID = rec.LastID
+	}
+
+	// journal records left by a compaction cut short carry events
+	// the snapshot already has
+	for _, e := range rec.Events {
+		if e.Seq >= s.nextSeq() {
+			s.events = append(s.events, e)
+		}
+	}
+
+	switch rec.Op {
+	case opPut:
+		if rec.Board != nil {
+			s.put(rec.Board)
+		}
+	case opDelete:
+		s.remove(rec.ID)
+	case opSettings:
+		if rec.Settings != nil {
+			s.settings[rec.Settings.ChatID] = *rec.Settings
+		}
+	}
+}
+
+// commit persists record when the store has a journal, must be called under lock
+func (s *boardStore) commit(rec journalRecord) error {
+	if s.journal == nil {
+		return nil
+	}
+
+	if err := s.journal.append(rec); err != nil {
+		return err
+	}
+
+	if s.journal.records >= compactEvery {
+		if err := s.compact(); err != nil {
+			log.Printf("error on compact boards %s\n", err)
+		}
+	}
+
+	return nil
+}
+
+// compact folds the journal into a snapshot of current boards, must be called under lock
+func (s *boardStore) compact() error {
+	records := make([]journalRecord, 0, len(s.boards)+len(s.settings)+len(s.events)/eventsPerRecord+2)
+	records = append(records, journalRecord{Op: opSeq, LastID: s.lastID})
+
+	for _, board := range s.boards {
+		records = append(records, journalRecord{Op: opPut, Board: board})
+	}
+
+	for _, settings := range s.settings {
+		records = append(records, journalRecord{Op: opSettings, Settings: &settings})
+	}
+
+	for events := s.events; len(events) > 0; {
+		chunk := events[:min(eventsPerRecord, len(events))]
+		events = events[len(chunk):]
+
+		records = append(records, journalRecord{Op: opEvents, Events: chunk})
+	}
+
+	return s.journal.compact(records)
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	// registers the postgres driver
+	_ "github.com/lib/pq"
+)
+
+// statements are written for Postgres, the only driver built in
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS board_sequence (
+		name TEXT PRIMARY KEY,
+		value BIGINT NOT NULL
+	)`,
+	`INSERT INTO board_sequence (name, value) VALUES ('boards', 0) ON CONFLICT (name) DO NOTHING`,
+	`CREATE TABLE IF NOT EXISTS boards (
+		id TEXT PRIMARY KEY,
+		chat_id BIGINT NOT NULL,
+		message_id BIGINT NOT NULL,
+		version BIGINT NOT NULL,
+		created_at BIGINT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS boards_chat ON boards (chat_id, message_id)`,
+	`CREATE TABLE IF NOT EXISTS holds (
+		board_id TEXT NOT NULL,
+		resource_id BIGINT NOT NULL,
+		user_id BIGINT NOT NULL,
+		PRIMARY KEY (board_id, resource_id, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS holds_user ON holds (user_id)`,
+	`CREATE TABLE IF NOT EXISTS subscriptions (
+		board_id TEXT NOT NULL,
+		user_id BIGINT NOT NULL,
+		PRIMARY KEY (board_id, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS subscriptions_user ON subscriptions (user_id)`,
+	`INSERT INTO board_sequence (name, value) VALUES ('events', 0) ON CONFLICT (name) DO NOTHING`,
+	`CREATE TABLE IF NOT EXISTS events (
+		seq BIGINT PRIMARY KEY,
+		board_id TEXT NOT NULL,
+		resource_id BIGINT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS events_board ON events (board_id, resource_id, seq)`,
+	`CREATE TABLE IF NOT EXISTS chat_settings (
+		chat_id BIGINT PRIMARY KEY,
+		data TEXT NOT NULL
+	)`,
+}
+
+const sqlTimeout = 10 * time.Second
+
+// sqlStore keeps every board as a JSON document next to the columns it is
+// looked up by, holds and subscriptions are indexed in tables of their own.
+// Events are rows of an insert-only table.
+type sqlStore struct {
+	db *sql.DB
+}
+
+func openSQLStore(driver, dsn string) (*sqlStore, error) {
+	if driver == "" {
+		driver = "postgres"
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqlStore{db: db}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+	defer cancel()
+
+	for _, statement := range sqlSchema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			_ = db.Close()
+
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *sqlStore) Create(board *Board, events ...Event) (*Board, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+	defer cancel()
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var id uint64
+
+		err := tx.QueryRowContext(ctx, `UPDATE board_sequence SET value = value + 1 WHERE name = 'boards' RETURNING value`).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		board.ID = strconv.FormatUint(id, 36)
+		board.Version = 1
+
+		data, err := json.Marshal(board)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO boards (id, chat_id, message_id, version, created_at, data) VALUES ($1, $2, $3, $4, $5, $6)`,
+			board.ID, board.ChatID, board.MessageID, board.Version, board.CreatedAt.UnixNano(), string(data),
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := s.index(ctx, tx, board); err != nil {
+			return err
+		}
+
+		return s.appendEvents(ctx, tx, events, board.ID, board.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return board, nil
+}
+
+func (s *sqlStore) Get(id string) (*Board, error) {
+	return s.one(`SELECT data FROM boards WHERE id = $1`, id)
+}
+
+func (s *sqlStore) GetByMessage(chatID int64, messageID int) (*Board, error) {
+	if messageID == 0 {
+		return nil, errBoardNotFound
+	}
+
+	return s.one(`SELECT data FROM boards WHERE chat_id = $1 AND message_id = $2`, chatID, messageID)
+}
+
+func (s *sqlStore) List(chatID int64) ([]*Board, error) {
+	if chatID == 0 {
+		return s.many(`SELECT data FROM boards ORDER BY created_at, id`)
+	}
+
+	return s.many(`SELECT data FROM boards WHERE chat_id = $1 ORDER BY created_at, id`, chatID)
+}
+
+func (s *sqlStore) HeldBy(userID int64) ([]*Board, error) {
+	return s.many(
+		`SELECT data FROM boards WHERE id IN (SELECT board_id FROM holds WHERE user_id = $1) ORDER BY created_at, id`,
+		userID,
+	)
+}
+
+func (s *sqlStore) SubscribedBy(userID int64) ([]*Board, error) {
+	return s.many(
+		`SELECT data FROM boards WHERE id IN (SELECT board_id FROM subscriptions WHERE user_id = $1) ORDER BY created_at, id`,
+		userID,
+	)
+}
+
+func (s *sqlStore) Save(board *Board, events ...Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+	defer cancel()
+
+	next := board.clone()
+	next.Version++
+
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(
+			ctx,
+			`UPDATE boards SET chat_id = $1, message_id = $2, version = $3, data = $4 WHERE id = $5 AND version = $6`,
+			next.ChatID, next.MessageID, next.Version, string(data), board.ID, board.Version,
+		)
+		if err != nil {
+			return err
+		}
+
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if updated == 1 {
+			if err := s.index(ctx, tx, next); err != nil {
+				return err
+			}
+
+			return s.appendEvents(ctx, tx, events, next.ID, next.Version)
+		}
+
+		var version int64
+
+		err = tx.QueryRowContext(ctx, `SELECT version FROM boards WHERE id = $1`, board.ID).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errBoardNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return errVersionConflict
+	})
+	if err != nil {
+		return err
+	}
+
+	board.Version = next.Version
+
+	return nil
+}
+
+func (s *sqlStore) Delete(id string, events ...Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+	defer cancel()
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var version int64
+
+		err := tx.QueryRowContext(ctx, `SELECT version FROM boards WHERE id = $1`, id).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := s.appendEvents(ctx, tx, events, id, version); err != nil {
+			return err
+		}
+
+		for _, statement := range []string{
+			`DELETE FROM holds WHERE board_id = $1`,
+			`DELETE FROM subscriptions WHERE board_id = $1`,
+			`DELETE FROM boards WHERE id = $1`,
+		} {
+			if _, err := tx.ExecContext(ctx, statement, id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *sqlStore) Events(boardID string, resourceID int) ([]Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+	defer cancel()
+
+	query := `SELECT data FROM events WHERE board_id = $1 ORDER BY seq`
+	args := []any{boardID}
+
+	if resourceID != 0 {
+		query = `SELECT data FROM events WHERE board_id = $1 AND resource_id = $2 ORDER BY seq`
+		args = append(args, resourceID)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := []Event{}
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		e := Event{}
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (s *sqlStore) Settings(chatID int64) (*ChatSettings, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+	defer cancel()
+
+	var data string
+
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM chat_settings WHERE chat_id = $1`, chatID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &ChatSettings{ChatID: chatID}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &ChatSettings{}
+	if err := json.Unmarshal([]byte(data), settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (s *sqlStore) SaveSettings(settings *ChatSettings) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO chat_settings (chat_id, data) VALUES ($1, $2) ON CONFLICT (chat_id) DO UPDATE SET data = excluded.data`,
+		settings.ChatID, string(data),
+	)
+
+	return err
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// index replaces holds and subscriptions rows of the board
+func (s *sqlStore) index(ctx context.Context, tx *sql.Tx, board *Board) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM holds WHERE board_id = $1`, board.ID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM subscriptions WHERE board_id = $1`, board.ID); err != nil {
+		return err
+	}
+
+	for _, resource := range board.Resources {
+		for _, holder := range resource.holders() {
+			_, err := tx.ExecContext(
+				ctx,
+				`INSERT INTO holds (board_id, resource_id, user_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+				board.ID, resource.ID, holder.ID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, userID := range board.Notify {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO subscriptions (board_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			board.ID, userID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendEvents stamps and inserts events of a change in the same transaction
+func (s *sqlStore) appendEvents(ctx context.Context, tx *sql.Tx, events []Event, boardID string, version int64) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var last int64
+
+	err := tx.QueryRowContext(
+		ctx,
+		`UPDATE board_sequence SET value = value + $1 WHERE name = 'events' RETURNING value`,
+		len(events),
+	).Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range stampEvents(events, boardID, version, last-int64(len(events))+1) {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO events (seq, board_id, resource_id, data) VALUES ($1, $2, $3, $4)`,
+			e.Seq, e.BoardID, e.ResourceID, string(data),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) one(query string, args ...any) (*Board, error) {
+	list, err := s.many(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, errBoardNotFound
+	}
+
+	return list[0], nil
+}
+
+func (s *sqlStore) many(query string, args ...any) ([]*Board, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*Board{}
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		board := &Board{}
+		if err := json.Unmarshal([]byte(data), board); err != nil {
+			return nil, err
+		}
+
+		list = append(list, board)
+	}
+
+	return list, rows.Err()
+}
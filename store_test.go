@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_openBoardStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := openBoardStore(dir)
+	if err != nil {
+		t.Fatalf("openBoardStore() error %s", err)
+	}
+
+	kept, _ := s.Create(newBoard(1, []string{"dev1", "dev2"}))
+	kept.MessageID = 10
+	kept.take(kept.Resources[1], models.User{ID: 3, FirstName: "name"})
+	kept.toggleNotify(4)
+
+	if err := s.Save(kept, Event{Type: eventTake, ResourceID: kept.Resources[1].ID}); err != nil {
+		t.Fatalf("Save() error %s", err)
+	}
+
+	deleted, _ := s.Create(newBoard(1, []string{"dev3"}))
+	if err := s.Delete(deleted.ID); err != nil {
+		t.Fatalf("Delete() error %s", err)
+	}
+
+	if err := s.SaveSettings(&ChatSettings{ChatID: 1, Layout: Layout{PerRow: 3}}); err != nil {
+		t.Fatalf("SaveSettings() error %s", err)
+	}
+
+	// no Close, as after power loss
+	s, err = openBoardStore(dir)
+	if err != nil {
+		t.Fatalf("openBoardStore() error %s", err)
+	}
+	defer s.Close()
+
+	got, err := s.GetByMessage(1, 10)
+	if err != nil {
+		t.Fatalf("board %s was lost", kept.ID)
+	}
+
+	if got.Resources[1].Holder == nil || got.Resources[1].Holder.ID != 3 || len(got.Notify) != 1 {
+		t.Errorf("board = %#v", got)
+	}
+
+	if events, _ := s.Events(kept.ID, 0); len(events) != 1 || events[0].Type != eventTake || events[0].Seq != 1 {
+		t.Errorf("history = %#v", events)
+	}
+
+	if _, err := s.Get(deleted.ID); err == nil {
+		t.Errorf("deleted board %s is back", deleted.ID)
+	}
+
+	if settings, _ := s.Settings(1); settings.Layout.PerRow != 3 {
+		t.Errorf("settings = %#v", settings)
+	}
+
+	created, _ := s.Create(newBoard(1, []string{"dev4"}))
+	if created.ID == kept.ID || created.ID == deleted.ID {
+		t.Errorf("Create() reused ID %s", created.ID)
+	}
+}
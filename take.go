@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// match is a resource found by its name on one of the boards of a chat
+type match struct {
+	Board    *Board
+	Resource *Resource
+}
+
+// matchResources finds resources of boards called name, only the closest
+// matches are returned: same name ignoring case, then the same name
+// transliterated, then names starting with it, then names containing it
+func matchResources(list []*Board, name string) []match {
+	wanted := fuzzyName(name)
+	if wanted == "" {
+		return nil
+	}
+
+	levels := make([][]match, 4)
+
+	for _, board := range list {
+		for _, resource := range board.Resources {
+			candidate := fuzzyName(resource.Name)
+			m := match{Board: board, Resource: resource}
+
+			switch {
+			case strings.EqualFold(resource.Name, name):
+				levels[0] = append(levels[0], m)
+			case candidate == wanted:
+				levels[1] = append(levels[1], m)
+			case strings.HasPrefix(candidate, wanted):
+				levels[2] = append(levels[2], m)
+			case strings.Contains(candidate, wanted):
+				levels[3] = append(levels[3], m)
+			}
+		}
+	}
+
+	for _, matches := range levels {
+		if len(matches) > 0 {
+			return matches
+		}
+	}
+
+	return nil
+}
+
+// fuzzyName is name in lower case latin lookalikes without spaces and punctuation
+func fuzzyName(name string) string {
+	name = strings.ToLower(toLatin(strings.ToLower(name)))
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+
+		return -1
+	}, name)
+}
+
+// label tells boards of a chat apart in choices
+func (board *Board) label() string {
+	if board.Title != "" {
+		return board.Title
+	}
+
+	return "board " + board.ID
+}
+
+// cutName cuts the first name off args, quoted or escaped as in /create,
+// the rest of args is returned as it is
+func cutName(args string) (string, string, bool) {
+	args = strings.TrimLeftFunc(args, unicode.IsSpace)
+	end := len(args)
+
+	inName, quoted, escaped := false, false, false
+
+scan:
+	for i, r := range args {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			inName, escaped = true, true
+		case r == '"' && quoted:
+			quoted = false
+		case r == '"' && !inName:
+			inName, quoted = true, true
+		case (r == rowSeparator || unicode.IsSpace(r)) && !quoted:
+			end = i
+
+			break scan
+		default:
+			inName = true
+		}
+	}
+
+	rows, err := splitQuoted(args[:end])
+	if err != nil || len(rows) != 1 || len(rows[0]) != 1 {
+		return "", "", false
+	}
+
+	return rows[0][0], strings.TrimSpace(args[end:]), true
+}
+
+// handleTake answers /take name [note], /release name, /queue name and
+// /state name state [note], the resource is looked up on boards of the chat
+// or on the board the message replies to
+func handleTake(ctx context.Context, b *bot.Bot, message *models.Message, action string) {
+	command := "/take name [time] [note]"
+
+	switch action {
+	case actionRelease:
+		command = "/release name"
+	case actionQueue:
+		if stateless {
+			replyText(ctx, b, message, "lines need a storage, they are not kept in stateless mode")
+
+			return
+		}
+
+		command = "/queue name"
+	case actionState:
+		if stateless {
+			replyText(ctx, b, message, "custom states need a storage, stateless boards are free or busy")
+
+			return
+		}
+
+		command = "/state name state [note]"
+	}
+
+	// the note is free text, only the name follows the rules of names
+	name, rest, ok := cutName(strings.ReplaceAll(commandArgs(message.Text), "\n", " "))
+	if !ok {
+		replyText(ctx, b, message, "you must send command in format "+command)
+
+		return
+	}
+
+	hold, state, note := "", "", ""
+
+	switch action {
+	case actionState:
+		if state, rest, ok = cutName(rest); !ok {
+			replyText(ctx, b, message, "you must send command in format "+command)
+
+			return
+		}
+
+		note = strings.Join(strings.Fields(rest), " ")
+	case actionTake:
+		// a time right after the name limits the hold, stateless boards have no timer
+		if word, after, _ := strings.Cut(rest, " "); !stateless {
+			if _, err := holdUntil(word, time.Now()); err == nil {
+				hold, rest = word, after
+			}
+		}
+
+		note = strings.Join(strings.Fields(rest), " ")
+	}
+
+	if stateless {
+		pressStateless(ctx, b, message, name, action, note)
+
+		return
+	}
+
+	list, err := chatBoards(message)
+	if err != nil {
+		log.Printf("error on list boards of %d: %s\n", message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	matches := matchResources(list, name)
+
+	switch len(matches) {
+	case 0:
+		replyText(ctx, b, message, fmt.Sprintf("there is no %s on the boards of this chat", name))
+	case 1:
+		token := callbackToken{BoardID: matches[0].Board.ID, ResourceID: matches[0].Resource.ID, Action: action}
+
+		if action == actionState {
+			i, ok := matches[0].Board.stateIndex(state)
+			if !ok {
+				replyText(ctx, b, message, fmt.Sprintf("%s has no state %s, its states are %s", matches[0].Board.label(), state, matches[0].Board.stateLabels()))
+
+				return
+			}
+
+			token.Arg = strconv.Itoa(i)
+		}
+
+		board, text, err := pressButton(ctx, b, token, sender(message), note)
+
+		// the time is set on a hold of the sender, new or not
+		if hold != "" && board != nil && board.holdsResource(sender(message).ID, token.ResourceID) {
+			token.Action, token.Arg = actionHoldFor, hold
+
+			_, text, err = pressButton(ctx, b, token, sender(message), "")
+		}
+
+		if err != nil && !errors.Is(err, errNotModified) {
+			log.Printf("error on update board %s: %s\n", token.BoardID, err)
+
+			text = "sorry, you cant't do that now"
+		}
+
+		// who can't take the item may line up for it
+		if action == actionTake && errors.Is(err, errNotModified) && board != nil {
+			if resource := board.resource(token.ResourceID); resource != nil && !board.holdsResource(sender(message).ID, resource.ID) &&
+				(resource.Holder != nil || resource.offeredTo() != nil) && resource.queuePlace(sender(message).ID) == 0 {
+				replyQueueButton(ctx, b, message, text, board, resource)
+
+				return
+			}
+		}
+
+		replyText(ctx, b, message, text)
+	default:
+		// choices carry no state
+		if action == actionState {
+			replyText(ctx, b, message, fmt.Sprintf("%d items match %s: %s, be more precise", len(matches), name, matchNames(matches)))
+
+			return
+		}
+
+		askChoice(ctx, b, message, name, matches, action)
+	}
+}
+
+// chatBoards are the boards commands look for resources on: the board
+// the message replies to or all boards of the chat
+func chatBoards(message *models.Message) ([]*Board, error) {
+	if board, ok := repliedBoard(message); ok {
+		return []*Board{board}, nil
+	}
+
+	return boards.List(message.Chat.ID)
+}
+
+// askChoice replies with a button for every match, a press goes
+// the way of a press on the board itself
+func askChoice(ctx context.Context, b *bot.Bot, message *models.Message, name string, matches []match, action string) {
+	kb := &models.InlineKeyboardMarkup{}
+
+	for _, m := range matches {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("%s · %s", m.Board.buttonText(m.Resource), m.Board.label()),
+				CallbackData: signCallback(m.Board.ChatID, callbackToken{BoardID: m.Board.ID, ResourceID: m.Resource.ID, Action: action}.String()),
+			},
+		})
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      message.Chat.ID,
+		Text:        fmt.Sprintf("%d items match %s, which one?", len(matches), name),
+		ReplyMarkup: kb,
+	})
+	if err != nil {
+		log.Printf("error on send message %s\n", err)
+	}
+}
+
+// pressStateless applies /take or /release to the board the message replies to,
+// stateless boards can't be looked up by the chat
+func pressStateless(ctx context.Context, b *bot.Bot, message *models.Message, name, action, note string) {
+	var (
+		changed *Resource
+		text    string
+		choices []match
+	)
+
+	board, err := changeStatelessBoard(ctx, b, message, func(board *Board) error {
+		matches := matchResources([]*Board{board}, name)
+		if len(matches) != 1 {
+			choices = matches
+
+			return errNotModified
+		}
+
+		var err error
+
+		changed, text, err = applyAction(board, callbackToken{ResourceID: matches[0].Resource.ID, Action: action}, sender(message))
+		if err == nil && action == actionTake && note != "" {
+			changed.Holder.Note = note
+		}
+
+		return err
+	})
+
+	switch {
+	case errors.Is(err, errNotReply):
+		text = "in stateless mode reply /take or /release to a board"
+	case errors.Is(err, errNotModified) && text == "" && len(choices) == 0:
+		text = fmt.Sprintf("there is no %s on this board", name)
+	case errors.Is(err, errNotModified) && text == "":
+		names := []string{}
+		for _, m := range choices {
+			names = append(names, m.Resource.Name)
+		}
+
+		text = fmt.Sprintf("%d items match %s: %s", len(choices), name, strings.Join(names, ", "))
+	case errors.Is(err, errBoardFull):
+		text = "the board is full, press the button instead"
+	case err != nil && !errors.Is(err, errNotModified):
+		log.Printf("error on press %s\n", err)
+
+		text = "sorry, you cant't do that now"
+	default:
+		notifySubscribers(ctx, b, board, changed, sender(message))
+	}
+
+	replyText(ctx, b, message, text)
+}
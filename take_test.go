@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_matchResources(t *testing.T) {
+	first := newBoard(1, []string{"prod-1", "dev1", "dev2", "Staging EU"})
+	second := newBoard(1, []string{"dev", "qa"})
+	list := []*Board{first, second}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "DEV", want: "[dev]"},
+		{name: "prod 1", want: "[prod-1]"},
+		{name: "Рrоd-1", want: "[prod-1]"}, // cyrillic Р and о
+		{name: "dev1", want: "[dev1]"},
+		{name: "de", want: "[dev1 dev2 dev]"},
+		{name: "eu", want: "[Staging EU]"},
+		{name: "prod-2", want: "[]"},
+		{name: "--", want: "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := []string{}
+			for _, m := range matchResources(list, tt.name) {
+				names = append(names, m.Resource.Name)
+			}
+
+			if fmt.Sprint(names) != tt.want {
+				t.Errorf("matchResources() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cutName(t *testing.T) {
+	tests := []struct {
+		args     string
+		wantName string
+		wantRest string
+		wantOK   bool
+	}{
+		{args: "", wantOK: false},
+		{args: "dev1", wantName: "dev1", wantOK: true},
+		{args: " dev1  a | b ", wantName: "dev1", wantRest: "a | b", wantOK: true},
+		{args: `"Staging EU" tests | e2e`, wantName: "Staging EU", wantRest: "tests | e2e", wantOK: true},
+		{args: `a\ b note`, wantName: "a b", wantRest: "note", wantOK: true},
+		{args: "dev1|qa", wantName: "dev1", wantRest: "|qa", wantOK: true},
+		{args: `"dev1 note`, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			name, rest, ok := cutName(tt.args)
+			if name != tt.wantName || rest != tt.wantRest || ok != tt.wantOK {
+				t.Errorf("cutName() = %q, %q, %v, want %q, %q, %v", name, rest, ok, tt.wantName, tt.wantRest, tt.wantOK)
+			}
+		})
+	}
+}
+
+func Test_handleTake(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	type sent struct {
+		chatID string
+		text   string
+		markup string
+	}
+
+	var (
+		messages  []sent
+		edits     []string
+		messageID = 800
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, sent{chatID: formValue(body, "chat_id"), text: formValue(body, "text"), markup: formValue(body, "reply_markup")})
+		messageID++
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": messageID, "chat": map[string]any{"id": 80}}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "message_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	user := &models.User{ID: 8, FirstName: "Ann"}
+
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/create prod-1 dev1 dev2", Chat: models.Chat{ID: 80}, From: user}})
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/create dev3 qa", Chat: models.Chat{ID: 80}, From: user}})
+
+	first, _ := boards.GetByMessage(80, 801)
+	_, _ = updateBoard(boards, first.ID, models.User{ID: 9}, func(board *Board) error {
+		board.toggleNotify(9)
+
+		return nil
+	})
+
+	tests := []struct {
+		name      string
+		text      string
+		reply     *models.Message
+		want      []string
+		wantEdits []string
+	}{
+		{
+			name: "usage",
+			text: "/take",
+			want: []string{"80: you must send command in format /take name [time] [note]"},
+		},
+		{
+			name:      "take with a note",
+			text:      "/take Рrоd-1 hotfix | deploy",
+			want:      []string{"9: 🏗️prod-1 status updated by Ann", "80: prod-1 updated by Ann"},
+			wantEdits: []string{"801: 🏗️prod-1 (Ann: hotfix | deploy)  🟢dev1  🟢dev2"},
+		},
+		{
+			name:      "already taken",
+			text:      "/take prod",
+			want:      []string{"80: prod-1 was already taken by Ann"},
+			wantEdits: []string{"801: 🏗️prod-1 (Ann: hotfix | deploy)  🟢dev1  🟢dev2"},
+		},
+		{
+			name:      "release",
+			text:      "/release PROD-1",
+			want:      []string{"9: 🟢prod-1 status updated by Ann", "80: prod-1 updated by Ann"},
+			wantEdits: []string{"801: 🟢prod-1  🟢dev1  🟢dev2"},
+		},
+		{
+			name: "unknown",
+			text: "/release stage",
+			want: []string{"80: there is no stage on the boards of this chat"},
+		},
+		{
+			name:      "only the replied board",
+			text:      "/take dev",
+			reply:     &models.Message{ID: 802, Chat: models.Chat{ID: 80}},
+			want:      []string{"80: dev3 updated by Ann"},
+			wantEdits: []string{"802: 🏗️dev3 (Ann)  🟢qa"},
+		},
+		{
+			name: "several match",
+			text: "/take dev",
+			want: []string{"80: 3 items match dev, which one?"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, edits = nil, nil
+
+			handler(ctx, b, &models.Update{Message: &models.Message{Text: tt.text, Chat: models.Chat{ID: 80}, From: user, ReplyToMessage: tt.reply}})
+
+			got := []string{}
+			for _, m := range messages {
+				got = append(got, m.chatID+": "+m.text)
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+
+			if fmt.Sprint(edits) != fmt.Sprint(tt.wantEdits) {
+				t.Errorf("edits = %q, want %q", edits, tt.wantEdits)
+			}
+		})
+	}
+
+	// the choice is answered with a press on one of its buttons
+	choice := &models.InlineKeyboardMarkup{}
+	if err := json.Unmarshal([]byte(messages[0].markup), choice); err != nil || len(choice.InlineKeyboard) != 3 {
+		t.Fatalf("choice = %q, %v", messages[0].markup, err)
+	}
+
+	if button := choice.InlineKeyboard[1][0]; button.Text != "🟢dev2 · board "+first.ID {
+		t.Errorf("choice button = %q", button.Text)
+	}
+
+	messages, edits = nil, nil
+
+	handler(ctx, b, &models.Update{
+		CallbackQuery: &models.CallbackQuery{
+			Data: choice.InlineKeyboard[1][0].CallbackData,
+			From: *user,
+			Message: models.MaybeInaccessibleMessage{
+				Type:    models.MaybeInaccessibleMessageTypeMessage,
+				Message: &models.Message{ID: 803, Chat: models.Chat{ID: 80}},
+			},
+		},
+	})
+
+	if want := "[801: 🟢prod-1  🟢dev1  🏗️dev2 (Ann) 803: dev2 updated by Ann]"; fmt.Sprint(edits) != want {
+		t.Errorf("edits = %q, want %q", edits, want)
+	}
+}
+
+func Test_handleTake_stateless(t *testing.T) {
+	stateless = true
+	defer func() { stateless = false }()
+
+	board := newBoard(90, []string{"dev1", "dev2"})
+	board.MessageID = 900
+
+	kb, _ := board.statelessKeyboard()
+	shown := &models.Message{ID: 900, Chat: models.Chat{ID: 90}, Text: board.text(), ReplyMarkup: kb}
+
+	s := newServerMock()
+	defer s.Close()
+
+	replies := []string{}
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		replies = append(replies, formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		shown.Text = formValue(body, "text")
+		_ = json.Unmarshal([]byte(formValue(body, "reply_markup")), shown.ReplyMarkup)
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	tests := []struct {
+		text     string
+		reply    *models.Message
+		want     string
+		wantText string
+	}{
+		{text: "/take dev1", want: "in stateless mode reply /take or /release to a board"},
+		{text: "/take dev", reply: shown, want: "2 items match dev: dev1, dev2", wantText: "🟢dev1  🟢dev2"},
+		{text: "/take dev2 tests", reply: shown, want: "dev2 updated by Ann", wantText: "🟢dev1  🏗️dev2 (Ann: tests)"},
+		{text: "/release dev2", reply: shown, want: "dev2 updated by Ann", wantText: "🟢dev1  🟢dev2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			replies = replies[:0]
+
+			handler(context.Background(), b, &models.Update{
+				Message: &models.Message{Text: tt.text, Chat: models.Chat{ID: 90}, From: &models.User{ID: 8, FirstName: "Ann"}, ReplyToMessage: tt.reply},
+			})
+
+			if len(replies) != 1 || replies[0] != tt.want {
+				t.Errorf("replies = %q, want %q", replies, tt.want)
+			}
+
+			if tt.wantText != "" && shown.Text != tt.wantText {
+				t.Errorf("text = %q, want %q", shown.Text, tt.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/exp/slices"
+)
+
+// longest template name in runes
+const maxTemplateNameLength = 32
+
+// Template is a board saved by a chat to be posted again with /create @name,
+// only the shape of the board is kept: no holders and no subscribers
+type Template struct {
+	Name   string     `json:"name"`
+	Title  string     `json:"title,omitempty"`
+	Layout Layout     `json:"layout,omitzero"`
+	States []State    `json:"states,omitempty"`
+	Rows   [][]string `json:"rows"`
+}
+
+// templateOf takes the shape of the board
+func templateOf(board *Board, name string) Template {
+	t := Template{Name: name, Title: board.Title, Layout: board.Layout, States: slices.Clone(board.States)}
+
+	for _, row := range board.explicitRows() {
+		names := make([]string, 0, len(row))
+		for _, resource := range row {
+			names = append(names, resource.nameSpec())
+		}
+
+		t.Rows = append(t.Rows, names)
+	}
+
+	return t
+}
+
+// board makes a new board of the template for the chat
+func (t Template) board(chatID int64) *Board {
+	board := newBoard(chatID, nil)
+	board.Title = t.Title
+	board.Layout = t.Layout
+	board.States = slices.Clone(t.States)
+
+	for _, row := range t.Rows {
+		board.addRow(row)
+	}
+
+	return board
+}
+
+func (t Template) String() string {
+	rows := make([]string, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		rows = append(rows, strings.Join(row, " "))
+	}
+
+	if len(t.States) > 0 {
+		states := make([]string, 0, len(t.States))
+		for _, s := range t.States {
+			states = append(states, s.String())
+		}
+
+		return t.Name + ": [" + strings.Join(states, " ") + "] " + strings.Join(rows, " | ")
+	}
+
+	return t.Name + ": " + strings.Join(rows, " | ")
+}
+
+// template returns the saved template called name, ignoring case
+func (settings *ChatSettings) template(name string) (int, bool) {
+	i := slices.IndexFunc(settings.Templates, func(t Template) bool {
+		return strings.EqualFold(t.Name, name)
+	})
+
+	return i, i >= 0
+}
+
+func validTemplateName(name string) bool {
+	if name == "" || utf8.RuneCountInString(name) > maxTemplateNameLength {
+		return false
+	}
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleTemplate answers /template save name (as a reply to a board),
+// /template list and /template delete name
+func handleTemplate(ctx context.Context, b *bot.Bot, message *models.Message) {
+	if stateless {
+		replyText(ctx, b, message, "templates need a storage, they are not kept in stateless mode")
+
+		return
+	}
+
+	command, name, _ := strings.Cut(commandArgs(message.Text), " ")
+	name = strings.TrimSpace(name)
+
+	if (command == "list") != (name == "") || strings.ContainsFunc(name, unicode.IsSpace) {
+		replyText(ctx, b, message, "you must send command in format /template save name, /template list or /template delete name")
+
+		return
+	}
+
+	unlock := boardLocks.Lock(settingsLockKey(message.Chat.ID))
+	defer unlock()
+
+	settings, err := boards.Settings(message.Chat.ID)
+	if err != nil {
+		log.Printf("error on chat settings %d: %s\n", message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	var text string
+
+	switch command {
+	case "list":
+		if len(settings.Templates) == 0 {
+			replyText(ctx, b, message, "this chat has no templates, reply /template save name to a board")
+
+			return
+		}
+
+		lines := []string{"templates of this chat:"}
+		for _, t := range settings.Templates {
+			lines = append(lines, t.String())
+		}
+
+		replyText(ctx, b, message, strings.Join(lines, "\n"))
+
+		return
+	case "save":
+		if !validTemplateName(name) {
+			replyText(ctx, b, message, fmt.Sprintf("template names are one word of letters, digits, - and _ up to %d long", maxTemplateNameLength))
+
+			return
+		}
+
+		board, ok := repliedBoard(message)
+		if !ok {
+			replyText(ctx, b, message, "reply /template save name to a board message")
+
+			return
+		}
+
+		t := templateOf(board, name)
+
+		if i, ok := settings.template(name); ok {
+			settings.Templates[i] = t
+			text = fmt.Sprintf("template %s updated", name)
+		} else {
+			settings.Templates = append(settings.Templates, t)
+			text = fmt.Sprintf("template %s saved, send /create @%s to post it", name, name)
+		}
+	case "delete":
+		i, ok := settings.template(name)
+		if !ok {
+			replyText(ctx, b, message, fmt.Sprintf("there is no template %s in this chat", name))
+
+			return
+		}
+
+		settings.Templates = slices.Delete(settings.Templates, i, i+1)
+		text = fmt.Sprintf("template %s deleted", name)
+	default:
+		replyText(ctx, b, message, "you must send command in format /template save name, /template list or /template delete name")
+
+		return
+	}
+
+	if err := boards.SaveSettings(settings); err != nil {
+		log.Printf("error on chat settings %d: %s\n", message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return
+	}
+
+	replyText(ctx, b, message, text)
+}
+
+// templateBoard makes the board for /create @name
+func templateBoard(ctx context.Context, b *bot.Bot, message *models.Message, name string) (*Board, bool) {
+	if stateless {
+		replyText(ctx, b, message, "templates need a storage, they are not kept in stateless mode")
+
+		return nil, false
+	}
+
+	settings, err := boards.Settings(message.Chat.ID)
+	if err != nil {
+		log.Printf("error on chat settings %d: %s\n", message.Chat.ID, err)
+
+		replyText(ctx, b, message, "sorry, you cant't do that now")
+
+		return nil, false
+	}
+
+	i, ok := settings.template(name)
+	if !ok {
+		replyText(ctx, b, message, fmt.Sprintf("there is no template %s in this chat, see /template list", name))
+
+		return nil, false
+	}
+
+	return settings.Templates[i].board(message.Chat.ID), true
+}
+
+// handleClone answers /clone chat sent as a reply to a board, a copy of the
+// board without holders and subscribers is posted to the chat, which is
+// @username or ID of a chat both the bot and the sender are members of
+func handleClone(ctx context.Context, b *bot.Bot, message *models.Message) {
+	args := commandArgs(message.Text)
+	if args == "" || strings.ContainsFunc(args, unicode.IsSpace) {
+		replyText(ctx, b, message, "you must send command in format /clone @chat or /clone chat_id as a reply to a board")
+
+		return
+	}
+
+	var (
+		source *Board
+		ok     bool
+	)
+
+	if stateless {
+		if message.ReplyToMessage != nil {
+			source, ok = boardFromMessage(message.ReplyToMessage)
+		}
+	} else {
+		source, ok = repliedBoard(message)
+	}
+
+	if !ok {
+		replyText(ctx, b, message, "reply /clone to a board message")
+
+		return
+	}
+
+	var chatID any = args
+	if id, err := strconv.ParseInt(args, 10, 64); err == nil {
+		chatID = id
+	}
+
+	target, err := b.GetChat(ctx, &bot.GetChatParams{ChatID: chatID})
+	if err != nil {
+		log.Printf("error on get chat %s: %s\n", args, err)
+
+		replyText(ctx, b, message, fmt.Sprintf("can't find chat %s, the bot must be a member of it", args))
+
+		return
+	}
+
+	user := sender(message)
+
+	member, err := b.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: target.ID, UserID: user.ID})
+	if err != nil || !isMember(member) {
+		replyText(ctx, b, message, fmt.Sprintf("you are not a member of %s", args))
+
+		return
+	}
+
+	board := templateOf(source, "").board(target.ID)
+	board.ChatTitle = target.Title
+
+	if _, err := postBoard(ctx, b, board, user); err != nil {
+		log.Printf("error on clone board to %d: %s\n", target.ID, err)
+
+		replyText(ctx, b, message, "failed to post the board")
+
+		return
+	}
+
+	replyText(ctx, b, message, "board cloned to "+board.chatLabel())
+}
+
+func isMember(member *models.ChatMember) bool {
+	switch member.Type {
+	case models.ChatMemberTypeOwner, models.ChatMemberTypeAdministrator, models.ChatMemberTypeMember:
+		return true
+	case models.ChatMemberTypeRestricted:
+		return member.Restricted != nil && member.Restricted.IsMember
+	}
+
+	return false
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_templateOf(t *testing.T) {
+	board := newBoard(1, nil)
+	board.Title = "Deploy"
+	board.Layout = Layout{Auto: true}
+	board.addRow([]string{"dev1", "dev2"})
+	board.addRow([]string{"stage"})
+	board.take(board.Resources[0], models.User{ID: 2})
+	board.toggleNotify(2)
+
+	tmpl := templateOf(board, "envs")
+	if got := tmpl.String(); got != "envs: dev1 dev2 | stage" {
+		t.Errorf("String() = %q", got)
+	}
+
+	posted := tmpl.board(3)
+	if posted.ChatID != 3 || posted.Title != "Deploy" || posted.Layout != board.Layout || len(posted.Notify) != 0 {
+		t.Errorf("board() = %#v", posted)
+	}
+
+	if got := fmt.Sprint(templateOf(posted, "").Rows); got != "[[dev1 dev2] [stage]]" {
+		t.Errorf("rows = %s", got)
+	}
+
+	for _, resource := range posted.Resources {
+		if resource.Holder != nil {
+			t.Errorf("%s is held by %s", resource.Name, resource.Holder.Name)
+		}
+	}
+}
+
+func Test_handleTemplate(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	const chatID = 200
+
+	var (
+		messages  []string
+		messageID = 2000
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "chat_id")+": "+formValue(body, "text"))
+		messageID++
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": messageID, "chat": map[string]any{"id": chatID}}}
+	}
+	s.hooks["/bottest_token/getChat"] = func(body []byte) any {
+		if formValue(body, "chat_id") != "@ops" {
+			return map[string]any{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}
+		}
+
+		return map[string]any{"ok": true, "result": map[string]any{"id": 201, "type": "group", "title": "Ops"}}
+	}
+	s.hooks["/bottest_token/getChatMember"] = func(body []byte) any {
+		status := "left"
+		if formValue(body, "user_id") == "20" {
+			status = "member"
+		}
+
+		return map[string]any{"ok": true, "result": map[string]any{"status": status, "user": map[string]any{"id": 1}}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	user := &models.User{ID: 20, FirstName: "Ann"}
+
+	handler(ctx, b, &models.Update{Message: &models.Message{Text: "/create dev1 dev2 | stage", Chat: models.Chat{ID: chatID}, From: user}})
+
+	tests := []struct {
+		text    string
+		from    *models.User
+		replyTo int
+		want    []string
+	}{
+		{text: "/template", want: []string{"200: you must send command in format /template save name, /template list or /template delete name"}},
+		{text: "/template list", want: []string{"200: this chat has no templates, reply /template save name to a board"}},
+		{text: "/template save envs", want: []string{"200: reply /template save name to a board message"}},
+		{text: "/template save two words", replyTo: 2001, want: []string{"200: you must send command in format /template save name, /template list or /template delete name"}},
+		{text: "/template save env$", replyTo: 2001, want: []string{"200: template names are one word of letters, digits, - and _ up to 32 long"}},
+		{text: "/template save envs", replyTo: 2001, want: []string{"200: template envs saved, send /create @envs to post it"}},
+		{text: "/template save ENVS", replyTo: 2001, want: []string{"200: template ENVS updated"}},
+		{text: "/template list", want: []string{"200: templates of this chat:\nENVS: dev1 dev2 | stage"}},
+		{text: "/create @envs", want: []string{"200: 🟢dev1  🟢dev2  🟢stage"}},
+		{text: "/create @qa", want: []string{"200: there is no template qa in this chat, see /template list"}},
+		{text: "/clone @ops", want: []string{"200: reply /clone to a board message"}},
+		{text: "/clone @nowhere", replyTo: 2001, want: []string{"200: can't find chat @nowhere, the bot must be a member of it"}},
+		{text: "/clone @ops", from: &models.User{ID: 21}, replyTo: 2001, want: []string{"200: you are not a member of @ops"}},
+		{text: "/clone @ops", replyTo: 2001, want: []string{"201: 🟢dev1  🟢dev2  🟢stage", "200: board cloned to Ops"}},
+		{text: "/template delete envs", want: []string{"200: template envs deleted"}},
+		{text: "/template delete envs", want: []string{"200: there is no template envs in this chat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			messages = nil
+
+			message := &models.Message{Text: tt.text, Chat: models.Chat{ID: chatID}, From: user}
+			if tt.from != nil {
+				message.From = tt.from
+			}
+
+			if tt.replyTo != 0 {
+				message.ReplyToMessage = &models.Message{ID: tt.replyTo, Chat: message.Chat}
+			}
+
+			handler(ctx, b, &models.Update{Message: message})
+
+			if fmt.Sprint(messages) != fmt.Sprint(tt.want) {
+				t.Errorf("messages = %q, want %q", messages, tt.want)
+			}
+		})
+	}
+
+	list, _ := boards.List(201)
+	if len(list) != 1 || list[0].ChatTitle != "Ops" || list[0].CreatedBy != user.ID || fmt.Sprint(templateOf(list[0], "").Rows) != "[[dev1 dev2] [stage]]" {
+		t.Errorf("cloned boards = %v", list)
+	}
+}
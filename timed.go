@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// the holder is warned this long before the hold ends
+const holdWarning = 10 * time.Minute
+
+// holds are checked for their end this often
+const holdCheckInterval = 30 * time.Second
+
+// longest hold with a time limit
+const maxHoldFor = 7 * 24 * time.Hour
+
+// arguments of actionHoldFor besides durations
+const (
+	holdEndOfDay = "eod"
+	holdCustom   = "custom"
+)
+
+var errBadHold = errors.New("the time must be like 45m, 2h or 1h30m, up to 7 days, or eod for the end of the day")
+
+// holdTimer is the actor of releases made when holds run out
+var holdTimer = models.User{FirstName: "time limit"}
+
+// holdOffers are the times offered after a take, in rows
+var holdOffers = [][]struct{ Text, Arg string }{
+	{{"30m", "30m"}, {"2h", "2h"}, {"until end of day", holdEndOfDay}},
+	{{"custom…", holdCustom}},
+}
+
+// holdUntil reads when a hold taken now ends, a duration or eod
+// for the end of the day in the time zone of the bot
+func holdUntil(arg string, now time.Time) (time.Time, error) {
+	if arg == holdEndOfDay {
+		local := now.Local()
+		end := time.Date(local.Year(), local.Month(), local.Day(), 23, 59, 0, 0, local.Location())
+
+		if !end.After(now) {
+			end = end.AddDate(0, 0, 1)
+		}
+
+		return end, nil
+	}
+
+	d, err := holdDuration(arg)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return now.Add(d), nil
+}
+
+func holdDuration(arg string) (time.Duration, error) {
+	d, err := time.ParseDuration(arg)
+	if err != nil || d < time.Minute || d > maxHoldFor {
+		return 0, errBadHold
+	}
+
+	return d, nil
+}
+
+// applyHold sets or moves the end of a hold of user, only the holder may
+func applyHold(board *Board, token callbackToken, user models.User, now time.Time) (string, error) {
+	resource := board.resource(token.ResourceID)
+	if resource == nil {
+		return "this item was removed from the board", errNotModified
+	}
+
+	if resource.shared() {
+		return fmt.Sprintf("%s is shared, its slots are held with no time limit", resource.Name), errNotModified
+	}
+
+	holder := resource.Holder
+	if holder == nil || holder.ID != user.ID {
+		return fmt.Sprintf("you don't hold %s any more", resource.Name), errNotModified
+	}
+
+	var (
+		until time.Time
+		err   error
+	)
+
+	switch {
+	case token.Arg == holdCustom:
+		return fmt.Sprintf("send /take %s 45m in the chat to hold it for any time", commandName(resource.Name)), errNotModified
+	case token.Action == actionExtend:
+		var d time.Duration
+
+		if d, err = holdDuration(token.Arg); err == nil {
+			until = holder.Until
+			if until.Before(now) {
+				until = now
+			}
+
+			until = until.Add(d)
+		}
+	default:
+		until, err = holdUntil(token.Arg, now)
+	}
+
+	if err != nil {
+		return err.Error(), errNotModified
+	}
+
+	if booking := resource.nextBooking(user.ID, now); booking != nil && until.After(booking.Start) {
+		return fmt.Sprintf("%s is booked by %s on %s, hold it until the start at most", resource.Name, booking.Name, slotText(booking.Start, booking.End)), errNotModified
+	}
+
+	holder.Until = until
+	holder.Warned = false
+	board.UpdatedAt = now
+
+	return fmt.Sprintf("%s is yours until %s", resource.Name, holder.untilText()), nil
+}
+
+// commandName quotes name for commands when it has spaces
+func commandName(name string) string {
+	if strings.ContainsFunc(name, unicode.IsSpace) {
+		return `"` + name + `"`
+	}
+
+	return name
+}
+
+// offerHoldTimes asks the user who just took resource in the private chat
+// for how long it is taken, the hold has no limit until answered
+func offerHoldTimes(ctx context.Context, b *bot.Bot, board *Board, resource *Resource, user models.User) {
+	// slots of shared resources are held with no time limit
+	if resource == nil || resource.shared() {
+		return
+	}
+
+	kb := &models.InlineKeyboardMarkup{}
+
+	for _, offers := range holdOffers {
+		row := []models.InlineKeyboardButton{}
+
+		for _, offer := range offers {
+			row = append(row, models.InlineKeyboardButton{
+				Text:         offer.Text,
+				CallbackData: signCallback(user.ID, callbackToken{BoardID: board.ID, ResourceID: resource.ID, Action: actionHoldFor, Arg: offer.Arg}.String()),
+			})
+		}
+
+		kb.InlineKeyboard = append(kb.InlineKeyboard, row)
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      user.ID,
+		Text:        fmt.Sprintf("%s is yours · %s, for how long?", resource.Name, board.chatLabel()),
+		ReplyMarkup: kb,
+	})
+	if err != nil {
+		// users who never started the bot can't be sent anything
+		log.Printf("error on offer hold times to %d: %s\n", user.ID, err)
+	}
+}
+
+// watchHolds releases holds that ran out and warns holders before, starts
+// bookings and passes resources kept for waiters who did not answer to the
+// next in line.
+// Everything is stored with the boards, so it outlives restarts of the bot.
+func watchHolds(ctx context.Context, b *bot.Bot) {
+	ticker := time.NewTicker(holdCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		checkHolds(ctx, b, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func checkHolds(ctx context.Context, b *bot.Bot, now time.Time) {
+	list, err := boards.List(0)
+	if err != nil {
+		log.Printf("error on list boards %s\n", err)
+
+		return
+	}
+
+	for _, board := range list {
+		expired, warn, missed, untold := false, false, false, false
+
+		for _, resource := range board.Resources {
+			if waiter := resource.offeredTo(); waiter != nil {
+				missed = missed || !now.Before(waiter.OfferedUntil)
+				untold = untold || !waiter.Told
+			}
+
+			if resource.Holder == nil || resource.Holder.Until.IsZero() {
+				continue
+			}
+
+			switch {
+			case !now.Before(resource.Holder.Until):
+				expired = true
+			case !resource.Holder.Warned && resource.Holder.Until.Sub(now) <= holdWarning:
+				warn = true
+			}
+		}
+
+		if expired {
+			expireHolds(ctx, b, board.ID, now)
+		}
+
+		if board.bookingDue(now) {
+			checkBookings(ctx, b, board.ID, now)
+		}
+
+		if warn {
+			warnHolds(ctx, b, board.ID, now)
+		}
+
+		// offers not sent before a restart are sent now
+		switch {
+		case missed:
+			expireOffers(ctx, b, board.ID, now)
+		case untold:
+			unlock := boardLocks.Lock(board.ID)
+			sendOffers(ctx, b, board.ID)
+			unlock()
+		}
+	}
+}
+
+// expireHolds releases resources of the board whose holds ran out by now
+func expireHolds(ctx context.Context, b *bot.Bot, boardID string, now time.Time) {
+	unlock := boardLocks.Lock(boardID)
+	defer unlock()
+
+	var (
+		holders []Holder
+		names   map[int64][]string
+	)
+
+	board, err := updateBoard(boards, boardID, holdTimer, func(board *Board) error {
+		holders, names = nil, map[int64][]string{}
+
+		for _, resource := range board.Resources {
+			holder := resource.Holder
+			if holder == nil || holder.Until.IsZero() || now.Before(holder.Until) {
+				continue
+			}
+
+			if _, ok := names[holder.ID]; !ok {
+				holders = append(holders, *holder)
+			}
+
+			names[holder.ID] = append(names[holder.ID], resource.Name)
+			board.release(resource)
+		}
+
+		if len(holders) == 0 {
+			return errNotModified
+		}
+
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errNotModified) {
+			log.Printf("error on expire holds of %s: %s\n", boardID, err)
+		}
+
+		return
+	}
+
+	editBoardMessage(ctx, b, board)
+	sendOffers(ctx, b, board.ID)
+
+	for _, holder := range holders {
+		released := names[holder.ID]
+
+		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: holder.ID,
+			Text:   fmt.Sprintf("your time ran out, %s released · %s", strings.Join(released, ", "), board.chatLabel()),
+		})
+
+		for _, userID := range board.Notify {
+			if userID != holder.ID {
+				_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID: userID,
+					Text:   fmt.Sprintf("%s%s released, time of %s ran out", freeEmoji, strings.Join(released, ", "+freeEmoji), holder.Name),
+				})
+			}
+		}
+	}
+}
+
+// warnHolds tells holders of the board whose holds end soon, with buttons
+// to extend or release at once, every hold is warned about once
+func warnHolds(ctx context.Context, b *bot.Bot, boardID string, now time.Time) {
+	unlock := boardLocks.Lock(boardID)
+	defer unlock()
+
+	var warned []*Resource
+
+	board, err := updateBoard(boards, boardID, holdTimer, func(board *Board) error {
+		warned = nil
+
+		for _, resource := range board.Resources {
+			holder := resource.Holder
+			if holder != nil && !holder.Until.IsZero() && !holder.Warned && now.Before(holder.Until) && holder.Until.Sub(now) <= holdWarning {
+				holder.Warned = true
+				warned = append(warned, resource)
+			}
+		}
+
+		if len(warned) == 0 {
+			return errNotModified
+		}
+
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errNotModified) {
+			log.Printf("error on warn holds of %s: %s\n", boardID, err)
+		}
+
+		return
+	}
+
+	for _, resource := range warned {
+		holderID := resource.Holder.ID
+
+		button := func(text, action, arg string) models.InlineKeyboardButton {
+			return models.InlineKeyboardButton{
+				Text:         text,
+				CallbackData: signCallback(holderID, callbackToken{BoardID: board.ID, ResourceID: resource.ID, Action: action, Arg: arg}.String()),
+			}
+		}
+
+		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: holderID,
+			Text:   fmt.Sprintf("your hold of %s · %s ends at %s", resource.Name, board.chatLabel(), resource.Holder.untilText()),
+			ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+				{button("+30m", actionExtend, "30m"), button("+2h", actionExtend, "2h")},
+				{button("release now", actionReleaseNow, "")},
+			}},
+		})
+		if err != nil {
+			log.Printf("error on warn %d: %s\n", holderID, err)
+		}
+	}
+}
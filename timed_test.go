@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func Test_holdUntil(t *testing.T) {
+	now := time.Date(2024, 5, 6, 15, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		arg     string
+		want    time.Time
+		wantErr bool
+	}{
+		{arg: "30m", want: now.Add(30 * time.Minute)},
+		{arg: "1h30m", want: now.Add(90 * time.Minute)},
+		{arg: "eod", want: time.Date(2024, 5, 6, 23, 59, 0, 0, time.Local)},
+		{arg: "30s", wantErr: true},
+		{arg: "200h", wantErr: true},
+		{arg: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := holdUntil(tt.arg, now)
+			if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+				t.Errorf("holdUntil() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	late := time.Date(2024, 5, 6, 23, 59, 30, 0, time.Local)
+	if got, _ := holdUntil("eod", late); !got.Equal(time.Date(2024, 5, 7, 23, 59, 0, 0, time.Local)) {
+		t.Errorf("holdUntil(eod) after the end of the day = %v", got)
+	}
+}
+
+func Test_applyHold(t *testing.T) {
+	now := time.Date(2024, 5, 6, 15, 0, 0, 0, time.Local)
+	ann := models.User{ID: 1, FirstName: "Ann"}
+
+	board := newBoard(1, []string{"dev1", "dev2"})
+	board.take(board.Resources[0], ann)
+	board.Resources[0].Holder.Since = now
+
+	tests := []struct {
+		name    string
+		token   callbackToken
+		user    models.User
+		want    string
+		wantErr bool
+	}{
+		{name: "not the holder", token: callbackToken{ResourceID: 1, Action: actionHoldFor, Arg: "2h"}, user: models.User{ID: 2}, want: "you don't hold dev1 any more", wantErr: true},
+		{name: "free", token: callbackToken{ResourceID: 2, Action: actionHoldFor, Arg: "2h"}, user: ann, want: "you don't hold dev2 any more", wantErr: true},
+		{name: "custom", token: callbackToken{ResourceID: 1, Action: actionHoldFor, Arg: holdCustom}, user: ann, want: "send /take dev1 45m in the chat to hold it for any time", wantErr: true},
+		{name: "hold for", token: callbackToken{ResourceID: 1, Action: actionHoldFor, Arg: "2h"}, user: ann, want: "dev1 is yours until 17:00"},
+		{name: "extend", token: callbackToken{ResourceID: 1, Action: actionExtend, Arg: "30m"}, user: ann, want: "dev1 is yours until 17:30"},
+		{name: "extend to another day", token: callbackToken{ResourceID: 1, Action: actionExtend, Arg: "8h"}, user: ann, want: "dev1 is yours until May 7 01:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board.Resources[0].Holder.Warned = true
+
+			got, err := applyHold(board, tt.token, tt.user, now)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("applyHold() = %q, %v, want %q", got, err, tt.want)
+			}
+
+			if err == nil && board.Resources[0].Holder.Warned {
+				t.Errorf("a new end is warned about again")
+			}
+		})
+	}
+
+	if got := board.itemText(board.Resources[0]); got != "🏗️dev1 (Ann, until May 7 01:30)" {
+		t.Errorf("itemText() = %q", got)
+	}
+}
+
+func Test_checkHolds(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	var (
+		messages []string
+		markups  []string
+		edits    []string
+	)
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "chat_id")+": "+formValue(body, "text"))
+		markups = append(markups, formValue(body, "reply_markup"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+	s.hooks["/bottest_token/editMessageText"] = func(body []byte) any {
+		edits = append(edits, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	ann := models.User{ID: 211, FirstName: "Ann"}
+	bob := models.User{ID: 212, FirstName: "Bob"}
+
+	board := newBoard(-210, []string{"dev1", "dev2", "dev3"})
+	board.ChatTitle = "Team"
+	board.MessageID = 2100
+	board.Notify = []int64{bob.ID, 213}
+	board.take(board.Resources[0], ann)
+	board.take(board.Resources[1], ann)
+	board.take(board.Resources[2], bob)
+	board.Resources[0].Holder.Until = now.Add(-time.Minute)
+	board.Resources[1].Holder.Until = now.Add(-time.Second)
+	board.Resources[2].Holder.Until = now.Add(5 * time.Minute)
+	board, _ = boards.Create(board)
+
+	checkHolds(ctx, b, now)
+
+	until := board.Resources[2].Holder.untilText()
+	wantMessages := []string{
+		"211: your time ran out, dev1, dev2 released · Team",
+		"212: 🟢dev1, 🟢dev2 released, time of Ann ran out",
+		"213: 🟢dev1, 🟢dev2 released, time of Ann ran out",
+		"212: your hold of dev3 · Team ends at " + until,
+	}
+	if fmt.Sprint(messages) != fmt.Sprint(wantMessages) {
+		t.Errorf("messages = %q, want %q", messages, wantMessages)
+	}
+
+	if want := "[-210: 🟢dev1  🟢dev2  🏗️dev3 (Bob, until " + until + ")]"; fmt.Sprint(edits) != want {
+		t.Errorf("edits = %q, want %q", edits, want)
+	}
+
+	// warnings are sent once, even after a restart
+	messages, edits = nil, nil
+
+	checkHolds(ctx, b, now.Add(time.Minute))
+
+	if len(messages) != 0 || len(edits) != 0 {
+		t.Errorf("messages = %q, edits = %q", messages, edits)
+	}
+
+	events, _ := boards.Events(board.ID, 1)
+	if last := events[len(events)-1]; last.text() != "dev1 released by time limit" {
+		t.Errorf("last event of dev1 = %q", last.text())
+	}
+
+	// extend is pressed in the private chat with the holder
+	warning := &models.InlineKeyboardMarkup{}
+	if err := json.Unmarshal([]byte(markups[3]), warning); err != nil || len(warning.InlineKeyboard) != 2 {
+		t.Fatalf("warning = %q, %v", markups[3], err)
+	}
+
+	handler(ctx, b, &models.Update{
+		CallbackQuery: &models.CallbackQuery{
+			Data: warning.InlineKeyboard[0][1].CallbackData,
+			From: bob,
+			Message: models.MaybeInaccessibleMessage{
+				Type:    models.MaybeInaccessibleMessageTypeMessage,
+				Message: &models.Message{ID: 2100, Chat: models.Chat{ID: bob.ID, Type: models.ChatTypePrivate}},
+			},
+		},
+	})
+
+	extended, _ := boards.Get(board.ID)
+	if holder := extended.Resources[2].Holder; holder.Warned || !holder.Until.Equal(board.Resources[2].Holder.Until.Add(2*time.Hour)) {
+		t.Errorf("holder = %#v", holder)
+	}
+
+	if want := "212: dev3 is yours until " + extended.Resources[2].Holder.untilText(); edits[len(edits)-1] != want {
+		t.Errorf("edits = %q, want %q", edits, want)
+	}
+}
+
+func Test_handleTake_time(t *testing.T) {
+	s := newServerMock()
+	defer s.Close()
+
+	var messages []string
+
+	s.hooks["/bottest_token/sendMessage"] = func(body []byte) any {
+		messages = append(messages, formValue(body, "chat_id")+": "+formValue(body, "text"))
+
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 2200, "chat": map[string]any{"id": 220}}}
+	}
+
+	b, err := bot.New("test_token", bot.WithServerURL(s.URL()), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	ctx := context.Background()
+	user := &models.User{ID: 22, FirstName: "Ann"}
+	send := func(text string) {
+		messages = nil
+
+		handler(ctx, b, &models.Update{Message: &models.Message{Text: text, Chat: models.Chat{ID: 220}, From: user}})
+	}
+
+	send("/create dev1 dev2")
+	send("/take dev1 2h hotfix")
+
+	board, _ := boards.GetByMessage(220, 2200)
+	holder := board.Resources[0].Holder
+
+	if holder == nil || holder.Note != "hotfix" || holder.Until.Sub(holder.Since).Round(time.Minute) != 2*time.Hour {
+		t.Fatalf("holder = %#v", holder)
+	}
+
+	if want := "[220: dev1 is yours until " + holder.untilText() + "]"; fmt.Sprint(messages) != want {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	// the time of a hold taken already is changed
+	send("/take dev1 eod")
+
+	board, _ = boards.GetByMessage(220, 2200)
+	if until, _ := holdUntil("eod", time.Now()); !board.Resources[0].Holder.Until.Equal(until) || board.Resources[0].Holder.Note != "hotfix" {
+		t.Errorf("holder = %#v", board.Resources[0].Holder)
+	}
+
+	events, _ := boards.Events(board.ID, 1)
+	if last := events[len(events)-1]; last.text() != "dev1 held until "+board.Resources[0].Holder.untilText()+" by Ann" {
+		t.Errorf("last event = %q", last.text())
+	}
+}